@@ -0,0 +1,187 @@
+// aibench_compare compares benchmark results, as written by the runners -json-out-file
+// option, against a baseline result. It prints the latency quantiles and throughput
+// deltas of each result, and exits with a non zero status when a regression exceeds
+// the configured thresholds.
+//
+// Usage:
+//
+//	aibench_compare [flags] BASELINE.json RESULT.json [RESULT.json ...]
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/RedisAI/aibench/inference"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Program option vars:
+var (
+	quantilesList           string
+	maxLatencyRegression    float64
+	maxThroughputRegression float64
+	includeWarmup           bool
+)
+
+// Parse args:
+func init() {
+	flag.StringVar(&quantilesList, "quantiles", "50,95,99,99.9,100", "Comma separated list of latency quantiles (0-100) to compare.")
+	flag.Float64Var(&maxLatencyRegression, "max-latency-regression", 10.0, "Max increase, in percent, of any compared latency quantile over the baseline. Negative disables the check.")
+	flag.Float64Var(&maxThroughputRegression, "max-throughput-regression", 5.0, "Max decrease, in percent, of the overall inference rate under the baseline. Negative disables the check.")
+	flag.BoolVar(&includeWarmup, "include-warmup", false, "Compare the overall inference rate including the warmup (default false).")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] BASELINE.json RESULT.json [RESULT.json ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+// result is a loaded TestResult, with its decoded overall latency histogram
+type result struct {
+	fileName  string
+	rate      float64
+	histogram *hdrhistogram.Histogram
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	quantiles, err := parseQuantiles(quantilesList)
+	if err != nil {
+		log.Fatalf("Invalid -quantiles: %v", err)
+	}
+	results := make([]result, flag.NArg())
+	for i, fileName := range flag.Args() {
+		results[i], err = loadResult(fileName)
+		if err != nil {
+			log.Fatalf("Error loading %s: %v", fileName, err)
+		}
+	}
+
+	baseline := results[0]
+	regressions := 0
+	for _, candidate := range results[1:] {
+		regressions += compare(baseline, candidate, quantiles)
+	}
+	if regressions > 0 {
+		fmt.Printf("%d regressions over the thresholds\n", regressions)
+		os.Exit(1)
+	}
+	fmt.Println("No regressions over the thresholds")
+}
+
+func parseQuantiles(list string) ([]float64, error) {
+	quantiles := make([]float64, 0)
+	for _, field := range strings.Split(list, ",") {
+		quantile, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		if quantile < 0 || quantile > 100 {
+			return nil, fmt.Errorf("quantile %g is not in [0, 100]", quantile)
+		}
+		quantiles = append(quantiles, quantile)
+	}
+	return quantiles, nil
+}
+
+func loadResult(fileName string) (result, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return result{fileName: fileName}, err
+	}
+	return parseResult(fileName, data, includeWarmup)
+}
+
+// parseResult decodes the overall inference rate and latency histogram of a TestResult
+func parseResult(fileName string, data []byte, includeWarmup bool) (result, error) {
+	r := result{fileName: fileName}
+	var testResult inference.TestResult
+	if err := json.Unmarshal(data, &testResult); err != nil {
+		return r, err
+	}
+	rates := testResult.OverallRates
+	if includeWarmup {
+		rates = testResult.OverallRatesIncludingWarmup
+	}
+	rate, ok := rates["overallOpsRate"].(float64)
+	if !ok {
+		return r, fmt.Errorf("the result has no overallOpsRate")
+	}
+	r.rate = rate
+	var err error
+	r.histogram, err = decodeHistogram(testResult.OverallQuantiles["EncodedHistogram"])
+	if err != nil {
+		return r, fmt.Errorf("decoding the overall latency histogram: %v", err)
+	}
+	return r, nil
+}
+
+// decodeHistogram decodes an EncodedHistogram, which goes through JSON as the base64 of the
+// histogram compressed encoding, itself in base64
+func decodeHistogram(encoded interface{}) (*hdrhistogram.Histogram, error) {
+	encodedStr, ok := encoded.(string)
+	if !ok || len(encodedStr) == 0 {
+		return nil, fmt.Errorf("the result has no EncodedHistogram")
+	}
+	compressed, err := base64.StdEncoding.DecodeString(encodedStr)
+	if err != nil {
+		return nil, err
+	}
+	return hdrhistogram.Decode(compressed)
+}
+
+// compare prints the deltas of candidate over baseline, and returns the number of regressions over the thresholds
+func compare(baseline, candidate result, quantiles []float64) int {
+	regressions := 0
+	fmt.Printf("%s vs %s:\n", candidate.fileName, baseline.fileName)
+	fmt.Printf("%20s %15s %15s %15s %10s\n", "Metric", "Baseline", "Result", "Delta", "Change")
+	for _, quantile := range quantiles {
+		base := float64(baseline.histogram.ValueAtQuantile(quantile)) / 10e2
+		value := float64(candidate.histogram.ValueAtQuantile(quantile)) / 10e2
+		change := percentChange(base, value)
+		regression := maxLatencyRegression >= 0 && change > maxLatencyRegression
+		if regression {
+			regressions++
+		}
+		printDelta(fmt.Sprintf("q%g lat. (msec)", quantile), base, value, change, regression)
+	}
+	change := percentChange(baseline.rate, candidate.rate)
+	regression := maxThroughputRegression >= 0 && -change > maxThroughputRegression
+	if regression {
+		regressions++
+	}
+	printDelta("Inference Rate", baseline.rate, candidate.rate, change, regression)
+	fmt.Println()
+	return regressions
+}
+
+// percentChange returns the change of value over base, in percent. Any change over a zero
+// base is infinite, so that it is caught by the thresholds
+func percentChange(base, value float64) float64 {
+	if base == 0 {
+		if value == 0 {
+			return 0
+		}
+		return math.Inf(int(math.Copysign(1, value)))
+	}
+	return (value - base) / base * 100.0
+}
+
+func printDelta(metric string, base, value, change float64, regression bool) {
+	mark := ""
+	if regression {
+		mark = " REGRESSION"
+	}
+	fmt.Printf("%20s %15.3f %15.3f %+15.3f %+9.2f%%%s\n", metric, base, value, value-base, change, mark)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"math"
+	"testing"
+)
+
+// encodedHistogram returns the JSON EncodedHistogram of a latency histogram holding values, in microseconds
+func encodedHistogram(t *testing.T, values ...int64) string {
+	histogram := hdrhistogram.New(1, 30000000, 3)
+	for _, value := range values {
+		_ = histogram.RecordValue(value)
+	}
+	encoded, err := histogram.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(encoded)
+}
+
+func TestParseResult(t *testing.T) {
+	histogram := encodedHistogram(t, 1000, 2000)
+	tests := []struct {
+		name          string
+		json          string
+		includeWarmup bool
+		wantRate      float64
+		wantErr       bool
+	}{
+		{"valid", fmt.Sprintf(`{"OverallRates":{"overallOpsRate":100},"OverallQuantiles":{"EncodedHistogram":%q}}`, histogram), false, 100, false},
+		{"with warmup", fmt.Sprintf(`{"OverallRates":{"overallOpsRate":100},"OverallRatesIncludingWarmup":{"overallOpsRate":90},"OverallQuantiles":{"EncodedHistogram":%q}}`, histogram), true, 90, false},
+		{"missing rate", fmt.Sprintf(`{"OverallRates":{},"OverallQuantiles":{"EncodedHistogram":%q}}`, histogram), false, 0, true},
+		{"missing warmup rate", fmt.Sprintf(`{"OverallRates":{"overallOpsRate":100},"OverallQuantiles":{"EncodedHistogram":%q}}`, histogram), true, 0, true},
+		{"rate not a number", fmt.Sprintf(`{"OverallRates":{"overallOpsRate":"100"},"OverallQuantiles":{"EncodedHistogram":%q}}`, histogram), false, 0, true},
+		{"missing histogram", `{"OverallRates":{"overallOpsRate":100},"OverallQuantiles":{}}`, false, 0, true},
+		{"invalid histogram", `{"OverallRates":{"overallOpsRate":100},"OverallQuantiles":{"EncodedHistogram":"not base64"}}`, false, 0, true},
+		{"invalid json", `{`, false, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseResult("result.json", []byte(tt.json), tt.includeWarmup)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResult() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.rate != tt.wantRate || got.histogram.TotalCount() != 2) {
+				t.Errorf("parseResult() rate = %v with %d latencies, want %v with 2", got.rate, got.histogram.TotalCount(), tt.wantRate)
+			}
+		})
+	}
+}
+
+func TestPercentChange(t *testing.T) {
+	tests := []struct {
+		base, value float64
+		want        float64
+	}{
+		{100, 110, 10},
+		{100, 90, -10},
+		{0, 0, 0},
+		{0, 5, math.Inf(1)},
+		{0, -5, math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		if got := percentChange(tt.base, tt.value); got != tt.want {
+			t.Errorf("percentChange(%v, %v) = %v, want %v", tt.base, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	maxLatencyRegression, maxThroughputRegression = 10, 5
+	quantiles := []float64{50, 100}
+	baseline := result{fileName: "baseline.json", rate: 100}
+	tests := []struct {
+		name            string
+		baseLatencies   []int64
+		latencies       []int64
+		baseRate, rate  float64
+		wantRegressions int
+	}{
+		{"same", []int64{1000, 2000}, []int64{1000, 2000}, 100, 100, 0},
+		{"within the thresholds", []int64{1000, 2000}, []int64{1050, 2100}, 100, 96, 0},
+		{"slower max", []int64{1000, 2000}, []int64{1000, 4000}, 100, 100, 1},
+		{"slower and lower rate", []int64{1000, 2000}, []int64{2000, 4000}, 100, 50, 3},
+		{"higher rate", []int64{1000, 2000}, []int64{1000, 2000}, 100, 200, 0},
+		{"zero baseline rate", []int64{1000, 2000}, []int64{1000, 2000}, 0, 100, 0},
+		{"zero rate", []int64{1000, 2000}, []int64{1000, 2000}, 100, 0, 1},
+		{"zero baseline latency", []int64{0, 0}, []int64{1000, 1000}, 100, 100, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline.rate, baseline.histogram = tt.baseRate, hdrhistogram.New(1, 30000000, 3)
+			for _, value := range tt.baseLatencies {
+				_ = baseline.histogram.RecordValue(value)
+			}
+			candidate := result{fileName: "result.json", rate: tt.rate, histogram: hdrhistogram.New(1, 30000000, 3)}
+			for _, value := range tt.latencies {
+				_ = candidate.histogram.RecordValue(value)
+			}
+			if got := compare(baseline, candidate, quantiles); got != tt.wantRegressions {
+				t.Errorf("compare() = %d regressions, want %d", got, tt.wantRegressions)
+			}
+		})
+	}
+}
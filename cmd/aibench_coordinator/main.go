@@ -0,0 +1,88 @@
+// aibench_coordinator coordinates a distributed benchmark, run by several benchmark runners
+// (the agents) started with -coordinator-addr pointing to it, e.g. on different client hosts.
+// The agents start together once all of them registered, send the stats of each reporting period,
+// and stop together once any of them is done. Their results are merged into one json result.
+//
+// Usage:
+//
+//	aibench_coordinator -agents 2 -json-out-file result.json
+//	aibench_run_inference_redisai_vision -coordinator-addr COORDINATOR:8090 ...  # on each client host
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/RedisAI/aibench/inference"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Program option vars:
+var (
+	listenAddr   string
+	agents       int
+	startDelay   time.Duration
+	agentTimeout time.Duration
+	jsonOutFile  string
+)
+
+// Parse args:
+func init() {
+	flag.StringVar(&listenAddr, "listen-addr", ":8090", "Address (host:port) to listen for the agents on.")
+	flag.IntVar(&agents, "agents", 2, "Number of agents of the benchmark, which starts once all of them registered.")
+	flag.DurationVar(&startDelay, "start-delay", 2*time.Second, "Delay between the last agent registration and the benchmark start, so that every agent is ready.")
+	flag.DurationVar(&agentTimeout, "agent-timeout", time.Minute, "Time after which a registered agent that sent nothing is dropped, aborting the benchmark. It must be larger than the agents -reporting-period. 0 waits for the agents forever.")
+	flag.StringVar(&jsonOutFile, "json-out-file", "", "Name of json output file to output the merged benchmark results. If not set, will not print to json.")
+	flag.Parse()
+}
+
+func main() {
+	if agents < 1 {
+		log.Fatal("-agents must be at least 1")
+	}
+	coordinator := inference.NewCoordinator(agents, startDelay, agentTimeout, os.Stdout)
+	server := &http.Server{Addr: listenAddr, Handler: coordinator.Handler()}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error listening on %s: %v", listenAddr, err)
+		}
+	}()
+	fmt.Printf("Waiting for %d agents on %s\n", agents, listenAddr)
+
+	result, err := coordinator.Wait()
+	// let the last replies, e.g. to POST /done, reach the agents
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if shutdownErr := server.Shutdown(ctx); shutdownErr != nil {
+		log.Printf("Error shutting down the coordinator server: %v", shutdownErr)
+	}
+	cancel()
+	if err != nil {
+		log.Fatalf("Error merging the agents results: %v", err)
+	}
+	fmt.Printf("Merged the results of %d agents, %d workers\n", len(result.Agents), result.Workers)
+	fmt.Printf("Overall inference rate: %.2f inferences/sec\n", result.OverallRates["overallOpsRate"])
+	if quantiles, ok := result.OverallQuantiles["AllQueries"].(map[string]float64); ok {
+		fmt.Printf("Overall latency (msec): p50 %.3f, p95 %.3f, p99 %.3f, p99.9 %.3f, max %.3f\n",
+			quantiles["q50"], quantiles["q95"], quantiles["q99"], quantiles["q999"], quantiles["q100"])
+	}
+
+	if len(jsonOutFile) > 0 {
+		_, _ = fmt.Printf("Saving JSON results to %s\n", jsonOutFile)
+		file, err := json.MarshalIndent(result, "", " ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = ioutil.WriteFile(jsonOutFile, file, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if result.Aborted {
+		log.Fatalf("Benchmark aborted: %s\n", result.AbortReason)
+	}
+}
@@ -31,6 +31,7 @@ func (d *FTSSimulator) populateTransaction(p *serialize.Transaction) bool {
 	p.Id = record.Id
 	p.TransactionValues = record.TransactionValues
 	p.ReferenceValues = record.ReferenceValues
+	p.Class = record.Class
 
 	ret := d.recordIndex < d.maxTransactions
 	atomic.AddUint64(&d.recordIndex, 1)
@@ -89,7 +90,12 @@ func (c *AibenchSimulatorConfig) NewSimulator(limit uint64, inputFilename string
 			crc := make([]byte, 2)
 			binary.LittleEndian.PutUint16(crc, radix.CRC16(buf))
 
-			transactions = append(transactions, serialize.Transaction{Id: buf, TransactionValues: qbytes, ReferenceValues: refBytes, Slot: crc})
+			// the Class column, when present, labels the transaction as genuine (0) or fraudulent (1)
+			class := ""
+			if len(line) > 30 {
+				class = line[30]
+			}
+			transactions = append(transactions, serialize.Transaction{Id: buf, TransactionValues: qbytes, ReferenceValues: refBytes, Slot: crc, Class: class})
 			if debug > 0 {
 				if transactionCount%1000 == 0 {
 					fmt.Fprintln(os.Stderr, "At transaction "+strconv.Itoa(int(transactionCount)))
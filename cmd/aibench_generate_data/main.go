@@ -15,6 +15,7 @@ import (
 	"github.com/RedisAI/aibench/cmd/aibench_generate_data/common"
 	"github.com/RedisAI/aibench/cmd/aibench_generate_data/fraud"
 	"github.com/RedisAI/aibench/cmd/aibench_generate_data/serialize"
+	"github.com/RedisAI/aibench/inference"
 )
 
 const (
@@ -54,6 +55,7 @@ var (
 	maxDataPoints                  uint64
 	outputFileName                 string
 	inputFileName                  string
+	labelsOutputFileName           string
 )
 
 // validateGroups checks validity of combination groupID and totalGroups
@@ -125,6 +127,7 @@ func init() {
 	flag.Uint64Var(&maxDataPoints, "max-transactions", 0, "Limit the number of transcactions to parse, 0 = no limit")
 	flag.StringVar(&inputFileName, "input-file", "", "File name to read the data from")
 	flag.StringVar(&outputFileName, "output-file", "", "File name to write generated data to")
+	flag.StringVar(&labelsOutputFileName, "labels-output-file", "", "File name to write the labelled class of the generated transactions to, one-hot encoded, one line per transaction, to check the model accuracy of the runners against with -golden-file. These are not the outputs of a reference run, see the runners -golden-out-file")
 
 	flag.Parse()
 
@@ -159,10 +162,35 @@ func main() {
 	cfg := getConfig(useCase)
 	sim := cfg.NewSimulator(maxDataPoints, inputFileName, debug)
 	serializer := getSerializer(format)
-	runSimulator(sim, serializer, out, interleavedGenerationGroupID, interleavedGenerationGroupsNum)
+	var golden *bufio.Writer
+	if len(labelsOutputFileName) > 0 {
+		golden = GetBufferedWriter(labelsOutputFileName)
+		if _, err := fmt.Fprintln(golden, inference.GoldenLabelsHeader); err != nil {
+			fatal("can not write the labels header: %s", err)
+		}
+		defer func() {
+			err := golden.Flush()
+			if err != nil {
+				fatal(err.Error())
+			}
+		}()
+	}
+	runSimulator(sim, serializer, out, golden, interleavedGenerationGroupID, interleavedGenerationGroupsNum)
 }
 
-func runSimulator(sim common.Simulator, serializer serialize.TransactionSerializer, out io.Writer, groupID, totalGroups uint) {
+// goldenLine returns the labelled class of a transaction as a golden file line, one-hot encoded, empty
+// when the transaction isn't labelled
+func goldenLine(p *serialize.Transaction) string {
+	switch strings.TrimSpace(p.Class) {
+	case "0":
+		return "1,0"
+	case "1":
+		return "0,1"
+	}
+	return ""
+}
+
+func runSimulator(sim common.Simulator, serializer serialize.TransactionSerializer, out io.Writer, golden io.Writer, groupID, totalGroups uint) {
 	currGroupID := uint(0)
 	point := serialize.NewTransaction()
 	for !sim.Finished() {
@@ -180,6 +208,12 @@ func runSimulator(sim common.Simulator, serializer serialize.TransactionSerializ
 				fatal("can not serialize point: %s", err)
 				return
 			}
+			if golden != nil {
+				if _, err := fmt.Fprintln(golden, goldenLine(point)); err != nil {
+					fatal("can not write golden output: %s", err)
+					return
+				}
+			}
 
 		}
 		point.Reset()
@@ -12,6 +12,8 @@ import (
 // overhead.
 type Transaction struct {
 	Id, TransactionValues, ReferenceValues, Slot []byte
+	// Class is the labelled class of the transaction, empty when the input data isn't labelled
+	Class string
 }
 
 // NewTransaction returns a new empty Transaction
@@ -30,6 +32,7 @@ func (p *Transaction) Reset() {
 	p.TransactionValues = p.TransactionValues[:0]
 	p.ReferenceValues = p.ReferenceValues[:0]
 	p.Slot = p.Slot[:0]
+	p.Class = ""
 }
 
 // TransactionSerializer serializes a Transaction for writing
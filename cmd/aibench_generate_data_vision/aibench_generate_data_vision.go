@@ -23,6 +23,7 @@ var (
 	outputFileName   string
 	batchSize        int
 	limit            int
+	tensorType       string
 	defaultWriteSize = 4 << 20 // 4 MB
 )
 
@@ -223,6 +224,7 @@ func main() {
 	flag.StringVar(&outputFileName, "output-file", "", "File name to write generated data to")
 	flag.IntVar(&batchSize, "batch-size", 1, "Input tensor batch size")
 	flag.IntVar(&limit, "limit", -1, "limit the number of generated tensors. If < 0 no limit is applied")
+	flag.StringVar(&tensorType, "tensor-type", "float", "Generated tensors type: 'float' for the preprocessed float32 pixels in [0,1], 'uint8' for the raw pixels, to be preprocessed server side (see aibench_run_inference_redisai_vision -script-filename)")
 	version := flag.Bool("v", false, "Output version and exit")
 	flag.Parse()
 	if *version {
@@ -234,6 +236,9 @@ func main() {
 		fmt.Fprintf(os.Stdout, "aibench_generate_data_vision (git_sha1:%s%s)\n", git_sha, git_dirty_str)
 		os.Exit(0)
 	}
+	if tensorType != "float" && tensorType != "uint8" {
+		log.Fatalf("unknown tensor type %q, expected float or uint8", tensorType)
+	}
 
 	// Get output writer
 	out := GetBufferedWriter(outputFileName)
@@ -267,9 +272,14 @@ func main() {
 				log.Fatal(err)
 			}
 			img, err := jpeg.Decode(imageFile)
-			pixels, _ := JPEGImageTo_HxWxC_float32_AiTensor(img, false, 1.0/255.0)
-			batchedPixels = append(batchedPixels, pixels...)
-			err = SerializeTensorDataFloat32(pixels, out)
+			if tensorType == "uint8" {
+				pixels, _ := JPEGImageTo_HxWxC_uint8_AiTensor(img, false)
+				err = SerializeTensorData(pixels, out)
+			} else {
+				pixels, _ := JPEGImageTo_HxWxC_float32_AiTensor(img, false, 1.0/255.0)
+				batchedPixels = append(batchedPixels, pixels...)
+				err = SerializeTensorDataFloat32(pixels, out)
+			}
 			if err != nil {
 				log.Fatal(err)
 			}
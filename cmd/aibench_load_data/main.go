@@ -7,9 +7,12 @@ import (
 	"flag"
 	"fmt"
 	aibench "github.com/RedisAI/aibench/inference"
+	aimetrics "github.com/RedisAI/aibench/internal/redisai"
 	"github.com/RedisAI/redisai-go/redisai"
 	_ "github.com/lib/pq"
+	"github.com/mediocregopher/radix/v3"
 	"log"
+	"net/url"
 	"sync"
 )
 
@@ -30,11 +33,24 @@ func init() {
 	flag.UintVar(&pipelineSize, "pipeline", 1, "Redis pipeline size")
 	flag.BoolVar(&setBlob, "set-blob", true, "Set reference data in plain binary safe Redis string format")
 	flag.BoolVar(&setTensor, "set-tensor", true, "Set reference data in AI.TENSOR format")
-	flag.Parse()
+	runner.ParseFlags()
 }
 
 func main() {
-	runner.RunLoad(&aibench.RedisAIPool, newProcessor, rowBenchmarkNBytes)
+	runner.RunLoad(&aibench.RedisAIPool, newProcessor, rowBenchmarkNBytes, newCollector)
+}
+
+// newCollector collects the server stats of the loaded host, and its CPU seconds per command
+func newCollector() aibench.MetricCollector {
+	u, err := url.Parse(host)
+	if err != nil {
+		log.Fatalf("Error parsing the redis host %s: %v", host, err)
+	}
+	conn, err := radix.Dial("tcp", u.Host)
+	if err != nil {
+		log.Fatalf("Error preparing for metrics collectors, while connecting to %s: %v", u.Host, err)
+	}
+	return aimetrics.NewCollector([]string{u.Host}, []radix.Client{conn}).CountPer("command", runner.CommandCount)
 }
 
 type Loader struct {
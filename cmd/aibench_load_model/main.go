@@ -0,0 +1,91 @@
+// aibench_load_model sets a RedisAI model out of its blob file on each of the target hosts,
+// uploading the blob in chunks, and checks the model config reported back by AI.MODELGET.
+//
+// Usage:
+//
+//	aibench_load_model -host 127.0.0.1 -port 6379 -model mobilenet_v1_100_224_cpu \
+//	  -model-filename ./tests/models/tensorflow/mobilenet/mobilenet_v1_100_224_cpu_NxHxWxC.pb \
+//	  -backend TF -device CPU -model-batch-size 32 -model-inputs input -model-outputs MobilenetV1/Predictions/Reshape_1
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/RedisAI/aibench/inference"
+	"github.com/RedisAI/aibench/internal/redisai"
+	"github.com/mediocregopher/radix/v3"
+)
+
+// Program option vars:
+var (
+	host           string
+	port           string
+	model          string
+	modelFilename  string
+	modelFlags     *redisai.ModelFlags
+	commandAPIName string
+	jsonOutFile    string
+)
+
+// Parse args:
+func init() {
+	flag.StringVar(&host, "host", "localhost", "Redis host address, if more than one is passed the model is set on each of them")
+	flag.StringVar(&port, "port", "6379", "Redis host port, if more than one is passed the model is set on each of them")
+	flag.StringVar(&model, "model", "", "Model key")
+	flag.StringVar(&modelFilename, "model-filename", "", "Model blob file")
+	modelFlags = redisai.RegisterModelFlags()
+	flag.StringVar(&commandAPIName, "command-api", string(redisai.LegacyAPI), "RedisAI commands syntax: 'legacy' issues AI.MODELSET, 'execute' issues AI.MODELSTORE (RedisAI >= 1.2)")
+	flag.StringVar(&jsonOutFile, "json-out-file", "", "Name of json output file to output the config of the set models. If not set, will not print to json.")
+	flag.Parse()
+}
+
+func main() {
+	if len(model) == 0 || len(modelFilename) == 0 {
+		log.Fatal("-model and -model-filename are required")
+	}
+	commandAPI, err := redisai.ParseCommandAPI(commandAPIName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	blob, err := ioutil.ReadFile(modelFilename)
+	if err != nil {
+		log.Fatalf("Error reading the model file %s: %v", modelFilename, err)
+	}
+
+	hosts := strings.Split(host, ",")
+	ports := strings.Split(port, ",")
+	models := make([]inference.ModelConfig, 0, len(hosts))
+	for idx, h := range hosts {
+		addr := fmt.Sprintf("%s:%s", h, ports[idx])
+		conn, err := radix.Dial("tcp", addr)
+		if err != nil {
+			log.Fatalf("Error connecting to %s: %v", addr, err)
+		}
+		config, err := redisai.LoadModel(conn, commandAPI, modelFlags.Config(model), blob, modelFlags.ChunkSize)
+		conn.Close()
+		if err != nil {
+			log.Fatalf("Error setting the model on %s: %v", addr, err)
+		}
+		config.Host = addr
+		models = append(models, config)
+		fmt.Printf("Set model %s on %s out of %s (%d bytes): backend %s, device %s, batch size %d (min %d), inputs %v, outputs %v\n",
+			model, addr, modelFilename, len(blob), config.Backend, config.Device, config.BatchSize, config.MinBatchSize, config.Inputs, config.Outputs)
+	}
+
+	if len(jsonOutFile) > 0 {
+		_, _ = fmt.Printf("Saving JSON results to %s\n", jsonOutFile)
+		file, err := json.MarshalIndent(models, "", " ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = ioutil.WriteFile(jsonOutFile, file, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
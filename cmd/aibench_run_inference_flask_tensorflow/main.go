@@ -8,6 +8,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/RedisAI/aibench/inference"
+	"github.com/RedisAI/aibench/internal/redisai"
 	"github.com/go-redis/redis/v8"
 	_ "github.com/lib/pq"
 	"github.com/valyala/fasthttp"
@@ -23,14 +24,17 @@ var (
 	redisHost          string
 	restapiHost        string
 	restapiRequestUri  string
+	restapiVersionUri  string
 	strPost            = []byte("POST")
 	strRequestURI      = []byte("")
 	strHost            = []byte("")
 	showExplain        bool
 	runner             *inference.BenchmarkRunner
+	metricsFlags       *inference.PrometheusFlags
 	redisClient        *redis.Client
 	restapiReadTimeout time.Duration
 	rowBenchmarkNBytes = 8 + 120 + 1024
+	inferenceType      = "DL REST API Query"
 )
 
 // Parse args:
@@ -40,7 +44,9 @@ func init() {
 	flag.StringVar(&restapiHost, "restapi-host", "127.0.0.1:8000", "REST API host address and port")
 	flag.DurationVar(&restapiReadTimeout, "restapi-read-timeout", 5*time.Second, "REST API timeout")
 	flag.StringVar(&restapiRequestUri, "restapi-request-uri", "/v2/predict", "REST API request URI")
-	flag.Parse()
+	flag.StringVar(&restapiVersionUri, "restapi-version-uri", "/version", "REST API URI of the server version, recorded on the results")
+	metricsFlags = inference.RegisterPrometheusFlags("http://127.0.0.1:8000/metrics")
+	runner.ParseFlags()
 	redisClient = redis.NewClient(&redis.Options{
 		Addr: redisHost,
 	})
@@ -50,7 +56,20 @@ func init() {
 func main() {
 	strRequestURI = []byte(restapiRequestUri)
 	strHost = []byte(restapiHost)
-	runner.Run(&inference.RedisAIPool, newProcessor, rowBenchmarkNBytes, 1, nil)
+	if info, err := inference.FetchServerInfo("http://"+restapiHost+restapiVersionUri, restapiReadTimeout); err != nil {
+		log.Printf("Error getting the server info of %s: %v", restapiHost, err)
+	} else {
+		runner.SetServerInfo(restapiHost, info)
+	}
+	var collectorFn inference.MetricCollectorCreate
+	if metricsFlags.Enabled() || runner.UseReferenceDataRedis() {
+		collectorFn = newCollector
+	}
+	runner.Run(&inference.RedisAIPool, newProcessor, rowBenchmarkNBytes, 1, collectorFn)
+}
+
+func newCollector() inference.MetricCollector {
+	return redisai.NewServingCollector(runner, metricsFlags, redisHost)
 }
 
 type queryExecutorOptions struct {
@@ -70,11 +89,6 @@ func (p *Processor) Close() {
 
 }
 
-func (p *Processor) CollectRunTimeMetrics() (ts int64, stats interface{}, err error) {
-	// TODO:
-	return
-}
-
 func newProcessor() inference.Processor { return &Processor{} }
 
 func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m chan uint64, rs chan uint64) {
@@ -86,13 +100,18 @@ func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m
 		printResponse: runner.DoPrintResponses(),
 	}
 
+	// the runner request timeout, when set, takes precedence over the REST API timeout
+	readTimeout := restapiReadTimeout
+	if runner.RequestTimeout() > 0 {
+		readTimeout = runner.RequestTimeout()
+	}
 	p.httpclient = &fasthttp.HostClient{
 		Addr:                      restapiHost,
-		ReadTimeout:               restapiReadTimeout,
-		MaxIdleConnDuration:       restapiReadTimeout,
+		ReadTimeout:               readTimeout,
+		MaxIdleConnDuration:       readTimeout,
 		MaxIdemponentCallAttempts: 10,
 		Dial: func(addr string) (net.Conn, error) {
-			return fasthttp.DialTimeout(addr, restapiReadTimeout)
+			return fasthttp.DialTimeout(addr, readTimeout)
 		},
 	}
 
@@ -117,49 +136,96 @@ func (p *Processor) ProcessInferenceQuery(q []byte, isWarm bool, workerNum int,
 	body := new(bytes.Buffer)
 	writer := multipart.NewWriter(body)
 	transPart, err := writer.CreateFormFile("transaction", "transaction")
-	if err != nil {
-		log.Fatalln(err)
+	if err == nil {
+		_, err = transPart.Write(transactionValues)
 	}
-	_, err = transPart.Write(transactionValues)
 	if err != nil {
-		log.Fatalln(err)
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(res)
+		return nil, inference.NewClientError(fmt.Errorf("Error building the inference request: %w", err))
 	}
+	// the request deadline covers both the reference data fetch and the prediction
+	ctx, cancel := runner.RequestContext()
+	defer cancel()
 	start := time.Now()
+	var referenceFetchTook int64 = 0
 	if useReferenceDataRedis {
-		redisRespReferenceBytes, redisErr := redisClient.Get(redisClient.Context(), referenceDataKeyName).Bytes()
+		redisRespReferenceBytes, redisErr := redisClient.Get(ctx, referenceDataKeyName).Bytes()
+		referenceFetchTook = time.Since(start).Microseconds()
+		if inference.IsTimeout(redisErr) {
+			fasthttp.ReleaseRequest(req)
+			fasthttp.ReleaseResponse(res)
+			return inference.RequestStat(inferenceType, start, true), nil
+		}
 		if redisErr != nil {
-			log.Fatalln("Error on redisClient.Get", redisErr)
+			fasthttp.ReleaseRequest(req)
+			fasthttp.ReleaseResponse(res)
+			return inference.RequestStat(inferenceType, start, false), inference.GoRedisError(redisErr)
 		}
 		refPart, err := writer.CreateFormFile("reference", "reference")
-		if err != nil {
-			log.Fatalln(err)
+		if err == nil {
+			_, err = refPart.Write(redisRespReferenceBytes)
 		}
-		_, err = refPart.Write(redisRespReferenceBytes)
 		if err != nil {
-			log.Fatalln(err)
+			fasthttp.ReleaseRequest(req)
+			fasthttp.ReleaseResponse(res)
+			return nil, inference.NewClientError(fmt.Errorf("Error building the inference request: %w", err))
 		}
 	}
 
 	writer.Close()
 	req.Header.Add("Content-Type", writer.FormDataContentType())
 	req.SetBody(body.Bytes())
-	err = p.httpclient.DoTimeout(req, res, restapiReadTimeout)
+	serializeTook := time.Since(start).Microseconds() - referenceFetchTook
+	if deadline, ok := ctx.Deadline(); ok {
+		err = p.httpclient.DoDeadline(req, res, deadline)
+	} else {
+		err = p.httpclient.DoTimeout(req, res, restapiReadTimeout)
+	}
+	if inference.IsTimeout(err) {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(res)
+		return inference.RequestStat(inferenceType, start, true), nil
+	}
 	if err != nil {
+		fasthttp.ReleaseRequest(req)
 		fasthttp.ReleaseResponse(res)
-		log.Fatalln("Error on httpclient.DoTimeout", err)
+		return inference.RequestStat(inferenceType, start, false), inference.NewConnectionError(fmt.Errorf("Error on httpclient.DoTimeout: %w", err))
 	}
-	took := time.Since(start).Microseconds()
+	networkTook := time.Since(start).Microseconds() - referenceFetchTook - serializeTook
+	bytesSent := uint64(len(req.Body()))
 	fasthttp.ReleaseRequest(req)
 	if res.StatusCode() != 200 {
-		log.Fatalln(fmt.Sprintf("Wrong status inference response code. expected %v, got %d", 200, res.StatusCode()))
+		statusCode := res.StatusCode()
+		fasthttp.ReleaseResponse(res)
+		return inference.RequestStat(inferenceType, start, false), inference.NewServerError(fmt.Errorf("Wrong status inference response code. expected %v, got %d", 200, statusCode))
 	}
 	if p.opts.printResponse {
 		body := res.Body()
 		fmt.Println("RESPONSE: ", string(body))
 	}
+	bytesReceived := uint64(len(res.Body()))
+	var output []float32
+	if runner.KeepOutputs() {
+		output, err = inference.DecodeJSONOutputs(res.Body())
+	}
 	fasthttp.ReleaseResponse(res)
+	if err != nil {
+		return inference.RequestStat(inferenceType, start, false), inference.NewBadResponseError(fmt.Errorf("Error decoding the inference response: %w", err))
+	}
+	took := time.Since(start).Microseconds()
 	stat := inference.GetStat()
+	stat.SetOutput(output)
+	stat.SetBytes(bytesSent, bytesReceived)
 
-	stat.Init([]byte("DL REST API Query"), took, uint64(0), false, "")
+	stat.Init([]byte(inferenceType), took, uint64(1), false, "")
+	if useReferenceDataRedis {
+		stat.AddPhase(inference.PhaseReferenceFetch, referenceFetchTook)
+	}
+	stat.AddPhase(inference.PhaseSerialize, serializeTook)
+	stat.AddPhase(inference.PhaseNetworkInference, networkTook)
+	if output != nil {
+		stat.AddPhase(inference.PhaseDeserialize, took-referenceFetchTook-serializeTook-networkTook)
+	}
 	return []*inference.Stat{stat}, nil
 }
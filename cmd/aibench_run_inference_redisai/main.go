@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/RedisAI/aibench/inference"
+	"github.com/RedisAI/aibench/internal/redisai"
+	"github.com/RedisAI/aibench/internal/rediscluster"
 	_ "github.com/lib/pq"
 	"github.com/mediocregopher/radix/v3"
 	"sync"
@@ -25,12 +27,19 @@ var (
 	model                   string
 	modelFilename           string
 	useDag                  bool
+	timeCommands            bool
 	showExplain             bool
 	clusterMode             bool
 	PoolPipelineConcurrency int
 	PoolPipelineWindow      time.Duration
 	rowBenchmarkNBytes      = 8 + 120 + 1024
 	inferenceType           = "RedisAI Query - with AI.TENSORSET transacation datatype BLOB"
+	clusterRouter           *rediscluster.Router // set on -cluster-mode
+	shardModels             map[string]string    // copy of the model of each primary, set on -cluster-mode
+	commandAPIName          string
+	commandAPI              redisai.CommandAPI
+	modelFlags              *redisai.ModelFlags
+	metricsCollector        inference.MetricCollector
 )
 
 // Parse args:
@@ -39,16 +48,129 @@ func init() {
 	flag.StringVar(&host, "host", "localhost", "Redis host address, if more than one is passed will round robin requests")
 	flag.StringVar(&port, "port", "6379", "Redis host port, if more than one is passed will round robin requests")
 	flag.StringVar(&model, "model", "", "model name")
-	flag.StringVar(&modelFilename, "model-filename", "", "modelFilename")
+	flag.StringVar(&modelFilename, "model-filename", "", "Model blob file, set as -model on every host at startup. The model config is recorded on the results either way")
+	modelFlags = redisai.RegisterModelFlags()
 	flag.BoolVar(&useDag, "use-dag", false, "use DAGRUN")
-	flag.BoolVar(&clusterMode, "cluster-mode", false, "read cluster slots and distribute inferences among shards.")
+	flag.BoolVar(&timeCommands, "time-commands", false, "issue AI.TENSORSET, the model run and AI.TENSORGET one by one instead of as a single DAG, timing each round trip as its own latency phase (tensorset, modelrun, tensorget)")
+	flag.BoolVar(&clusterMode, "cluster-mode", false, "read cluster slots and distribute inferences among shards, sending each one to the shard owning its tensors. -host and -port are used to discover the cluster topology. Enables the per shard stats. "+
+		"Each shard runs its own copy of the model, named -model followed by the hash tag of one of its slots (e.g. model{3}), set out of -model-filename or beforehand.")
 	flag.DurationVar(&PoolPipelineWindow, "pool-pipeline-window", 500*time.Microsecond, "If window is zero then implicit pipelining will be disabled")
 	flag.IntVar(&PoolPipelineConcurrency, "pool-pipeline-concurrency", 0, "If limit is zero then no limit will be used and pipelines will only be limited by the specified time window")
-	flag.Parse()
+	flag.StringVar(&commandAPIName, "command-api", string(redisai.LegacyAPI), "RedisAI commands syntax: 'legacy' issues AI.MODELRUN and AI.DAGRUN, 'execute' issues AI.MODELEXECUTE and AI.DAGEXECUTE (RedisAI >= 1.2)")
+	runner.ParseFlags()
+	var err error
+	commandAPI, err = redisai.ParseCommandAPI(commandAPIName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if timeCommands {
+		inferenceType += " timed command by command"
+	}
 }
 
 func main() {
-	runner.Run(&inference.RedisAIPool, newProcessor, rowBenchmarkNBytes, 1, nil)
+	hosts := strings.Split(host, ",")
+	ports := strings.Split(port, ",")
+	addrs := make([]string, len(hosts))
+	for idx, h := range hosts {
+		addrs[idx] = fmt.Sprintf("%s:%s", h, ports[idx])
+	}
+	if clusterMode {
+		var err error
+		clusterRouter, err = rediscluster.NewRouter(addrs, clusterPoolFunc)
+		if err != nil {
+			log.Fatalf("Error reading the cluster slots. error = %v", err)
+		}
+		addrs = clusterRouter.Primaries()
+		runner.SetPerHostStats(true)
+		fmt.Printf("Cluster mode: distributing the inferences among %d primaries %v\n", len(addrs), addrs)
+	}
+	runner.SetHosts(addrs)
+	for _, addr := range addrs {
+		setServerInfo(addr)
+	}
+	if clusterRouter != nil && len(model) > 0 {
+		if timeCommands {
+			log.Fatal("-time-commands is not supported on -cluster-mode, the model and the tensors of a model run being on different slots")
+		}
+		// the model runs on the shard owning the inference tensors, a key being owned by a single shard
+		shardModels = map[string]string{}
+		for addr, tag := range clusterRouter.ShardTags() {
+			shardModels[addr] = model + tag
+		}
+	}
+	if len(model) > 0 {
+		if shardModels != nil {
+			for _, addr := range addrs {
+				if err := redisai.SetupModel(runner, []string{addr}, commandAPI, shardModels[addr], modelFilename, modelFlags); err != nil {
+					log.Fatalf("Error setting the model %s: %v", shardModels[addr], err)
+				}
+			}
+		} else if err := redisai.SetupModel(runner, addrs, commandAPI, model, modelFilename, modelFlags); err != nil {
+			log.Fatalf("Error setting the model %s: %v", model, err)
+		}
+	}
+	metricsClients := make([]radix.Client, len(addrs))
+	for idx, addr := range addrs {
+		conn, err := radix.Dial("tcp", addr)
+		if err != nil {
+			log.Fatalf("Error preparing for metrics collectors, while connecting to %s. error = %v", addr, err)
+		}
+		metricsClients[idx] = conn
+	}
+	var metricsKeys []string
+	if len(model) > 0 {
+		metricsKeys = []string{model}
+	}
+	collector := redisai.NewCollector(addrs, metricsClients, metricsKeys...).CountPer("inference", runner.InferenceCount)
+	if shardModels != nil {
+		hostKeys := map[string][]string{}
+		for addr, shardModel := range shardModels {
+			hostKeys[addr] = []string{shardModel}
+		}
+		collector.HostKeys(hostKeys)
+	}
+	metricsCollector = collector
+	runner.Run(&inference.RedisAIPool, newProcessor, rowBenchmarkNBytes, 1, newCollector)
+	if clusterRouter != nil {
+		fmt.Printf("Followed %d cluster redirects\n", clusterRouter.Redirects())
+		_ = clusterRouter.Close()
+	}
+}
+
+// connFunc dials the inference connections, bounding each request by the runner request timeout, if any
+func connFunc(network, addr string) (radix.Conn, error) {
+	if runner.RequestTimeout() > 0 {
+		return radix.Dial(network, addr, radix.DialReadTimeout(runner.RequestTimeout()), radix.DialWriteTimeout(runner.RequestTimeout()))
+	}
+	return radix.Dial(network, addr)
+}
+
+// clusterPoolFunc creates the pools of each cluster node, shared by all of the workers
+func clusterPoolFunc(network, addr string) (radix.Client, error) {
+	return radix.NewPool(network, addr, int(runner.Workers()), radix.PoolPipelineWindow(0, 0), radix.PoolConnFunc(connFunc))
+}
+
+// setServerInfo saves the INFO SERVER and INFO MODULES fields of the server at addr on the results
+func setServerInfo(addr string) {
+	var serverInfo, modulesInfo string
+	conn, err := radix.Dial("tcp", addr)
+	if err == nil {
+		err = conn.Do(radix.Pipeline(
+			radix.Cmd(&serverInfo, "INFO", "SERVER"),
+			radix.Cmd(&modulesInfo, "INFO", "MODULES"),
+		))
+		conn.Close()
+	}
+	if err != nil {
+		log.Printf("Error getting the server info of %s: %v", addr, err)
+		return
+	}
+	info := inference.ParseRedisInfo(serverInfo)
+	for k, v := range inference.ParseRedisInfo(modulesInfo) {
+		info[k] = v
+	}
+	runner.SetServerInfo(addr, info)
 }
 
 type queryExecutorOptions struct {
@@ -62,11 +184,7 @@ type Processor struct {
 	Metrics chan uint64
 	Wg      *sync.WaitGroup
 	pclient []*radix.Pool
-}
-
-func (p *Processor) CollectRunTimeMetrics() (ts int64, stats interface{}, err error) {
-	// TODO:
-	return
+	addrs   []string // addrs holds the address of each pclient pool
 }
 
 func (p *Processor) Close() {
@@ -77,6 +195,8 @@ func (p *Processor) Close() {
 	}
 }
 
+func newCollector() inference.MetricCollector { return metricsCollector }
+
 func newProcessor() inference.Processor { return &Processor{} }
 
 func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m chan uint64, rs chan uint64) {
@@ -88,6 +208,10 @@ func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m
 	p.Wg = wg
 	p.Metrics = m
 	var err error
+	if clusterMode {
+		// the requests go through the shared clusterRouter
+		return
+	}
 
 	hosts := strings.Split(host, ",")
 	ports := strings.Split(port, ",")
@@ -95,8 +219,10 @@ func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m
 	// if we have more hosts than workers lets connect to them all
 	if len(hosts) > totalWorkers {
 		p.pclient = make([]*radix.Pool, len(hosts))
+		p.addrs = make([]string, len(hosts))
 		for idx, h := range hosts {
-			p.pclient[idx], err = radix.NewPool("tcp", fmt.Sprintf("%s:%s", h, ports[idx]), 1, radix.PoolPipelineWindow(0, 0))
+			p.addrs[idx] = fmt.Sprintf("%s:%s", h, ports[idx])
+			p.pclient[idx], err = radix.NewPool("tcp", p.addrs[idx], 1, radix.PoolPipelineWindow(0, 0), radix.PoolConnFunc(connFunc))
 			if err != nil {
 				log.Fatalf("Error preparing for DAGRUN(), while creating new pool. error = %v", err)
 			}
@@ -105,7 +231,8 @@ func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m
 	} else {
 		pos := (numWorker + 1) % len(hosts)
 		p.pclient = make([]*radix.Pool, 1)
-		p.pclient[0], err = radix.NewPool("tcp", fmt.Sprintf("%s:%s", hosts[pos], ports[pos]), 1, radix.PoolPipelineWindow(0, 0))
+		p.addrs = []string{fmt.Sprintf("%s:%s", hosts[pos], ports[pos])}
+		p.pclient[0], err = radix.NewPool("tcp", p.addrs[0], 1, radix.PoolPipelineWindow(0, 0), radix.PoolConnFunc(connFunc))
 		if err != nil {
 			log.Fatalf("Error preparing for DAGRUN(), while creating new pool. error = %v", err)
 		}
@@ -125,33 +252,102 @@ func (p *Processor) ProcessInferenceQuery(q []byte, isWarm bool, workerNum int,
 	classificationTensorName := "classificationTensor:{" + idS + "}"
 	transactionDataTensorName := "transactionTensor:{" + idS + "}"
 	transactionValues := q[8:128]
-	var args []string
+	// the reference data is loaded server side, so it has no phase of its own
+	start := time.Now()
+	inputs := []string{transactionDataTensorName}
 	if useReferenceDataRedis {
-		args = []string{"LOAD", "1", referenceDataTensorName, "|>",
-			"AI.TENSORSET", transactionDataTensorName, "FLOAT", "1", "30", "BLOB", string(transactionValues), "|>",
-			"AI.MODELRUN", model, "INPUTS", transactionDataTensorName, referenceDataTensorName, "OUTPUTS", classificationTensorName, "|>",
-			"AI.TENSORGET", classificationTensorName, "BLOB",
+		inputs = append(inputs, referenceDataTensorName)
+	}
+	modelKey := model
+	if shardModels != nil {
+		modelKey = shardModels[clusterRouter.AddrForKey(transactionDataTensorName)]
+	}
+	ops := [][]string{
+		redisai.TensorSet(transactionDataTensorName, "FLOAT", []string{"1", "30"}, transactionValues),
+		commandAPI.ModelRun(modelKey, inputs, []string{classificationTensorName}),
+		redisai.TensorGet(classificationTensorName),
+	}
+	// the reply is only decoded when the outputs are validated
+	keepOutputs := runner.KeepOutputs()
+	var reply []interface{}
+	var blob []byte
+	var cmds []radix.CmdAction
+	var bytesSent, bytesReceived uint64
+	if timeCommands {
+		for idx, op := range ops {
+			var rcv interface{}
+			if keepOutputs && idx == len(ops)-1 {
+				rcv = &blob
+			}
+			cmds = append(cmds, redisai.SizedCmd(&bytesSent, &bytesReceived, rcv, op[0], op[1:]...))
 		}
 	} else {
-		args = []string{"|>",
-			"AI.TENSORSET", transactionDataTensorName, "FLOAT", "1", "30", "BLOB", string(transactionValues), "|>",
-			"AI.MODELRUN", model, "INPUTS", transactionDataTensorName, "OUTPUTS", classificationTensorName, "|>",
-			"AI.TENSORGET", classificationTensorName, "BLOB",
+		dag := redisai.DAG{Routing: transactionDataTensorName, Ops: ops}
+		if useReferenceDataRedis {
+			dag.Load = []string{referenceDataTensorName}
+		}
+		cmd, args := commandAPI.DAGRun(dag)
+		var rcv interface{}
+		if keepOutputs {
+			rcv = &reply
 		}
+		cmds = []radix.CmdAction{redisai.SizedCmd(&bytesSent, &bytesReceived, rcv, cmd, args...)}
 	}
-	pos := rand.Int31n(int32(len(p.pclient)))
-	start := time.Now()
+	serializeTook := time.Since(start).Microseconds()
 
-	err := p.pclient[pos].Do(radix.Cmd(nil, "AI.DAGRUN", args...))
-	if err != nil {
-		extendedError := fmt.Errorf("Prediction Receive() failed:%v\n", err)
-		log.Fatal(extendedError)
+	// the {id} hash tag keeps all of the transaction tensors on the same shard
+	do := func(cmd radix.CmdAction) (string, error) {
+		return clusterRouter.Do(transactionDataTensorName, cmd)
+	}
+	if clusterRouter == nil {
+		pos := rand.Int31n(int32(len(p.pclient)))
+		do = func(cmd radix.CmdAction) (string, error) {
+			return p.addrs[pos], p.pclient[pos].Do(cmd)
+		}
+	}
+	var addr string
+	var err error
+	opTooks := make([]int64, 0, len(cmds))
+	for _, cmd := range cmds {
+		opStart := time.Now()
+		addr, err = do(cmd)
+		opTooks = append(opTooks, time.Since(opStart).Microseconds())
+		if err != nil {
+			break
+		}
+	}
+	networkTook := time.Since(start).Microseconds() - serializeTook
+	timedOut := inference.IsTimeout(err)
+	var output []float32
+	if err == nil {
+		if !timeCommands {
+			blob = redisai.DAGOutput(reply)
+		}
+		if blob != nil {
+			output = inference.ConvertByteSliceToFloatSlice(blob)
+		}
 	}
-
 	took := time.Since(start).Microseconds()
 
 	stat := inference.GetStat()
-	stat.Init([]byte(inferenceType), took, uint64(0), false, "")
+	stat.Init([]byte(inferenceType), took, uint64(1), timedOut, "")
+	stat.SetHost(addr)
+	stat.SetBytes(bytesSent, bytesReceived)
+	stat.AddPhase(inference.PhaseSerialize, serializeTook)
+	if timeCommands {
+		for idx, opTook := range opTooks {
+			stat.AddPhase(redisai.OpPhase(ops[idx]), opTook)
+		}
+	} else {
+		stat.AddPhase(inference.PhaseNetworkInference, networkTook)
+	}
+	if err != nil && !timedOut {
+		return []*inference.Stat{stat}, inference.RadixError(fmt.Errorf("Prediction Receive() failed: %w", err))
+	}
+	if output != nil {
+		stat.AddPhase(inference.PhaseDeserialize, took-serializeTook-networkTook)
+		stat.SetOutput(output)
+	}
 
 	return []*inference.Stat{stat}, nil
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
@@ -11,6 +12,8 @@ import (
 	"time"
 
 	"github.com/RedisAI/aibench/inference"
+	"github.com/RedisAI/aibench/internal/redisai"
+	"github.com/RedisAI/aibench/internal/rediscluster"
 	_ "github.com/lib/pq"
 	"github.com/mediocregopher/radix/v3"
 	"sync"
@@ -22,21 +25,36 @@ var (
 	host                    string
 	port                    string
 	model                   string
+	modelFilename           string
+	modelFlags              *redisai.ModelFlags
 	persistOutputs          bool
 	showExplain             bool
 	clusterMode             bool
 	useDag                  bool
+	timeCommands            bool
 	continueOnError         bool
 	PoolPipelineConcurrency int
 	dialReadTimeout         time.Duration
 	PoolPipelineWindow      time.Duration
 	inferenceType           = "RedisAI Query - mobilenet_v1_100_224 "
 	tensorBenchmarkBytes    = 4 * 1 * 224 * 224 * 3 // number of bytes per float * N x H x W x C
+	tensorShape             string
+	tensorShapeArgs         []string // AI.TENSORSET dimensions, the batch size first
+	tensorType              = "FLOAT"
 	batchSize               int
 	batchSizeStr            string
 	metricsCollector        inference.MetricCollector
 	metricsPools            []*radix.Pool
 	metricsHosts            []string
+	clusterRouter           *rediscluster.Router // set on -cluster-mode
+	shardTags               map[string]string    // hash tag of each primary, set on -cluster-mode
+	commandAPIName          string
+	commandAPI              redisai.CommandAPI
+	script                  string
+	scriptFilename          string // set on the pre/post-processing pipeline mode
+	scriptDevice            string
+	preProcessFn            string
+	postProcessFn           string
 )
 
 // Vars only for git sha and diff handling
@@ -62,16 +80,27 @@ func init() {
 	flag.StringVar(&host, "host", "localhost", "Redis host address, if more than one is passed will round robin requests")
 	flag.StringVar(&port, "port", "6379", "Redis host port, if more than one is passed will round robin requests")
 	flag.StringVar(&model, "model", "mobilenet_v1_100_224_cpu", "model name")
+	flag.StringVar(&modelFilename, "model-filename", "", "Model blob file, set as -model on every host at startup. The model config is recorded on the results either way")
+	modelFlags = redisai.RegisterModelFlags()
 	flag.BoolVar(&persistOutputs, "persist-results", false, "persist the classification tensors")
 	flag.BoolVar(&useDag, "use-dag", false, "use DAGRUN")
-	flag.BoolVar(&continueOnError, "continue-on-error", true, "If an error reply is received continue and only log the error message")
-	flag.BoolVar(&clusterMode, "cluster-mode", false, "read cluster slots and distribute inferences among shards.")
+	flag.BoolVar(&timeCommands, "time-commands", false, "issue the commands of each inference one by one instead of as a single DAG or pipeline, timing each round trip as its own latency phase (tensorset, modelrun, tensorget). Takes precedence over -use-dag")
+	flag.BoolVar(&continueOnError, "continue-on-error", true, "If an error reply is received continue and only log the error message, accounting it on the error stats. Same as -ignore-errors")
+	flag.BoolVar(&clusterMode, "cluster-mode", false, "read cluster slots and distribute inferences among shards, sending each one to the shard owning its tensors. -host and -port are used to discover the cluster topology. Enables the per shard stats. "+
+		"Each shard runs its own copy of the model, named -model followed by the hash tag of one of its slots (e.g. model{3}), set out of -model-filename or beforehand. The workers are spread among the shards round robin.")
 	flag.DurationVar(&PoolPipelineWindow, "pool-pipeline-window", 500*time.Microsecond, "If window is zero then implicit pipelining will be disabled")
 	flag.DurationVar(&dialReadTimeout, "dial-read-timeout", 90*time.Second, "Redis connection dial timeout")
 	flag.IntVar(&PoolPipelineConcurrency, "pool-pipeline-concurrency", 0, "If limit is zero then no limit will be used and pipelines will only be limited by the specified time window")
 	flag.IntVar(&batchSize, "batch-size", 1, "Input tensor batch size")
+	flag.StringVar(&tensorShape, "tensor-shape", "224,224,3", "Input tensor shape, excluding the batch size, as comma separated dimensions (H,W,C)")
+	flag.StringVar(&commandAPIName, "command-api", string(redisai.LegacyAPI), "RedisAI commands syntax: 'legacy' issues AI.MODELRUN and AI.DAGRUN, 'execute' issues AI.MODELEXECUTE and AI.DAGEXECUTE (RedisAI >= 1.2)")
+	flag.StringVar(&script, "script", "mobilenet_pre_post_processing", "TorchScript key of the pre/post-processing script")
+	flag.StringVar(&scriptFilename, "script-filename", "", "TorchScript source of the pre/post-processing script, set on every host at startup. If set, the input tensors are raw UINT8 images (see aibench_generate_data_vision -tensor-type) run through a DAG normalizing them with the -pre-process-fn script function before the model, and extracting the top-k classes out of its output with the -post-process-fn script function")
+	flag.StringVar(&scriptDevice, "script-device", "CPU", "Device the pre/post-processing script runs on")
+	flag.StringVar(&preProcessFn, "pre-process-fn", "pre_process", "Script function normalizing the raw input tensor")
+	flag.StringVar(&postProcessFn, "post-process-fn", "post_process", "Script function extracting the top-k classes out of the model output")
 	version := flag.Bool("v", false, "Output version and exit")
-	flag.Parse()
+	runner.ParseFlags()
 	if *version {
 		git_sha := AibenchGitSHA1()
 		git_dirty_str := ""
@@ -81,29 +110,72 @@ func init() {
 		fmt.Fprintf(os.Stdout, "aibench_run_inference_redisai_vision (git_sha1:%s%s)\n", git_sha, git_dirty_str)
 		os.Exit(0)
 	}
+	var err error
+	commandAPI, err = redisai.ParseCommandAPI(commandAPIName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dims, err := inference.ParseTensorShape(tensorShape)
+	if err != nil {
+		log.Fatal(err)
+	}
+	batchSizeStr = fmt.Sprintf("%d", batchSize)
+	tensorBenchmarkBytes = 4
+	if len(scriptFilename) > 0 {
+		if clusterMode {
+			log.Fatal("-script-filename is not supported on -cluster-mode, the script key being owned by a single shard")
+		}
+		// the pre/post-processing pipeline runs as a DAG, out of the raw images
+		useDag = true
+		tensorType = "UINT8"
+		tensorBenchmarkBytes = 1
+	}
+	tensorShapeArgs = []string{batchSizeStr}
+	for _, dim := range dims {
+		tensorBenchmarkBytes *= int(dim)
+		tensorShapeArgs = append(tensorShapeArgs, strconv.FormatInt(dim, 10))
+	}
 	inferenceType += fmt.Sprintf("(input tensor batch size=%d):", batchSize)
-	if useDag {
+	if timeCommands {
+		useDag = false
+		inferenceType += commandAPI.ModelCommand() + " timed command by command"
+	} else if useDag {
 		if persistOutputs {
-			inferenceType += "AI.DAGRUN with persistency ON"
+			inferenceType += commandAPI.DAGCommand() + " with persistency ON"
 		} else {
-			inferenceType += "AI.DAGRUN with persistency OFF"
+			inferenceType += commandAPI.DAGCommand() + " with persistency OFF"
 		}
 	} else {
-		inferenceType += "AI.MODELRUN"
+		inferenceType += commandAPI.ModelCommand()
+	}
+	if len(scriptFilename) > 0 {
+		inferenceType += fmt.Sprintf(" with %s pre/post-processing", commandAPI.ScriptCommand())
 	}
-	batchSizeStr = fmt.Sprintf("%d", batchSize)
 }
 
 func main() {
 	rowBenchmarkBytes := batchSize * tensorBenchmarkBytes
-	metricsCollector = &Processor{}
 	hosts := strings.Split(host, ",")
 	ports := strings.Split(port, ",")
-	metricsPools = make([]*radix.Pool, len(hosts))
-	metricsHosts = make([]string, len(hosts))
-	var err error = nil
+	addrs := make([]string, len(hosts))
 	for idx, h := range hosts {
-		addr := fmt.Sprintf("%s:%s", h, ports[idx])
+		addrs[idx] = fmt.Sprintf("%s:%s", h, ports[idx])
+	}
+	var err error = nil
+	if clusterMode {
+		clusterRouter, err = rediscluster.NewRouter(addrs, clusterPoolFunc)
+		if err != nil {
+			log.Fatalf("Error reading the cluster slots. error = %v", err)
+		}
+		// the metrics and the server info cover every primary
+		addrs = clusterRouter.Primaries()
+		runner.SetPerHostStats(true)
+		fmt.Printf("Cluster mode: distributing the inferences among %d primaries %v\n", len(addrs), addrs)
+	}
+	runner.SetHosts(addrs)
+	metricsPools = make([]*radix.Pool, len(addrs))
+	metricsHosts = make([]string, len(addrs))
+	for idx, addr := range addrs {
 		metricsHosts[idx] = addr
 		connFunc := func(network, addr string) (radix.Conn, error) {
 			return radix.Dial(network, addr, radix.DialReadTimeout(dialReadTimeout))
@@ -114,7 +186,89 @@ func main() {
 		}
 	}
 
+	for idx, pool := range metricsPools {
+		setServerInfo(metricsHosts[idx], pool)
+	}
+	metricsClients := make([]radix.Client, len(metricsPools))
+	for idx, pool := range metricsPools {
+		metricsClients[idx] = pool
+	}
+	metricsKeys := []string{model}
+	if len(scriptFilename) > 0 {
+		metricsKeys = append(metricsKeys, script)
+	}
+	collector := redisai.NewCollector(metricsHosts, metricsClients, metricsKeys...).CountPer("inference", runner.InferenceCount)
+	if clusterRouter != nil {
+		// the model runs on the shard owning the worker tensors, a key being owned by a single shard
+		shardTags = clusterRouter.ShardTags()
+		hostKeys := map[string][]string{}
+		for addr, tag := range shardTags {
+			hostKeys[addr] = []string{model + tag}
+		}
+		collector.HostKeys(hostKeys)
+	}
+	metricsCollector = collector
+	if len(scriptFilename) > 0 {
+		setScript()
+	}
+	if len(model) > 0 && clusterRouter != nil {
+		for _, addr := range metricsHosts {
+			if err := redisai.SetupModel(runner, []string{addr}, commandAPI, model+shardTags[addr], modelFilename, modelFlags); err != nil {
+				log.Fatalf("Error setting the model %s: %v", model+shardTags[addr], err)
+			}
+		}
+	} else if len(model) > 0 {
+		if err := redisai.SetupModel(runner, metricsHosts, commandAPI, model, modelFilename, modelFlags); err != nil {
+			log.Fatalf("Error setting the model %s: %v", model, err)
+		}
+	}
+
+	if continueOnError {
+		runner.SetIgnoreErrors(true)
+	}
 	runner.Run(&inference.RedisAIPool, newProcessor, rowBenchmarkBytes, int64(batchSize), newCollector)
+	if clusterRouter != nil {
+		fmt.Printf("Followed %d cluster redirects\n", clusterRouter.Redirects())
+		_ = clusterRouter.Close()
+	}
+}
+
+// clusterPoolFunc creates the pools of each cluster node, shared by all of the workers
+func clusterPoolFunc(network, addr string) (radix.Client, error) {
+	return radix.NewPool(network, addr, int(runner.Workers()), radix.PoolConnFunc(connFunc))
+}
+
+// setScript sets the pre/post-processing script on every host
+func setScript() {
+	source, err := ioutil.ReadFile(scriptFilename)
+	if err != nil {
+		log.Fatalf("Error reading the script file %s: %v", scriptFilename, err)
+	}
+	args := commandAPI.ScriptSet(script, scriptDevice, []string{preProcessFn, postProcessFn}, string(source))
+	for idx, pool := range metricsPools {
+		if err = pool.Do(radix.Cmd(nil, args[0], args[1:]...)); err != nil {
+			log.Fatalf("Error setting the script %s on %s: %v", script, metricsHosts[idx], err)
+		}
+	}
+	fmt.Printf("Set the pre/post-processing script %s out of %s on %d hosts\n", script, scriptFilename, len(metricsPools))
+}
+
+// setServerInfo saves the INFO SERVER and INFO MODULES fields of the server at addr on the results
+func setServerInfo(addr string, client radix.Client) {
+	var serverInfo, modulesInfo string
+	err := client.Do(radix.Pipeline(
+		radix.Cmd(&serverInfo, "INFO", "SERVER"),
+		radix.Cmd(&modulesInfo, "INFO", "MODULES"),
+	))
+	if err != nil {
+		log.Printf("Error getting the server info of %s: %v", addr, err)
+		return
+	}
+	info := inference.ParseRedisInfo(serverInfo)
+	for k, v := range inference.ParseRedisInfo(modulesInfo) {
+		info[k] = v
+	}
+	runner.SetServerInfo(addr, info)
 }
 
 type queryExecutorOptions struct {
@@ -128,6 +282,7 @@ type Processor struct {
 	Metrics chan uint64
 	Wg      *sync.WaitGroup
 	pclient []*radix.Pool
+	addrs   []string // addrs holds the address of each pclient pool
 }
 
 func (p *Processor) Close() {
@@ -138,112 +293,6 @@ func (p *Processor) Close() {
 	}
 }
 
-func (p *Processor) CollectRunTimeMetrics() (ts int64, stats interface{}, err error) {
-	var hosts_metrics_map = make(map[string]interface{})
-	for pos, h := range metricsPools {
-		var aicpu_rcv string
-		var aiinfo_rcv []string
-		var commandstats_rcv string
-		var infomemory_rcv string
-		var kvmap = make(map[string]interface{})
-		pipeCmds := radix.Pipeline(
-			radix.FlatCmd(&aicpu_rcv, "INFO", "MODULES"),
-			radix.FlatCmd(&aiinfo_rcv, "AI.INFO", model),
-			radix.FlatCmd(nil, "AI.INFO", model, "RESETSTAT"),
-			radix.FlatCmd(&commandstats_rcv, "INFO", "COMMANDSTATS"),
-			radix.FlatCmd(&infomemory_rcv, "INFO", "MEMORY"),
-			radix.FlatCmd(nil, "CONFIG", "RESETSTAT"),
-		)
-		err = h.Do(pipeCmds)
-		if err != nil {
-			return
-		}
-		process_ainfo_reply(aiinfo_rcv, kvmap)
-		process_commandstats_reply(commandstats_rcv, kvmap)
-		process_memorystats_reply(infomemory_rcv, kvmap)
-		process_info_modules_ai_cpu(aicpu_rcv, kvmap)
-		hosts_metrics_map[metricsHosts[pos]] = kvmap
-	}
-	stats = hosts_metrics_map
-	return
-}
-
-func stringInSlice(a string, list []string) bool {
-	for _, b := range list {
-		if b == a {
-			return true
-		}
-	}
-	return false
-}
-
-func process_ainfo_reply(aiinfo_rcv []string, kvmap map[string]interface{}) {
-	interested_keys := []string{"duration", "samples", "calls", "errors"}
-	for i := 0; i < len(aiinfo_rcv); i += 2 {
-		k := aiinfo_rcv[i]
-		if stringInSlice(k, interested_keys) {
-			sk := fmt.Sprintf("ai_info.%s", k)
-			sv := aiinfo_rcv[i+1]
-			kvmap[sk] = sv
-		}
-	}
-}
-
-func process_commandstats_reply(commandstats_rcv string, kvmap map[string]interface{}) {
-	ai_cpu_idx := strings.Index(commandstats_rcv, "Commandstats")
-	if ai_cpu_idx > -1 {
-		ai_cpu_str := commandstats_rcv[ai_cpu_idx:]
-		ai_cpu_metrics_str_arr := strings.Split(ai_cpu_str, "\r\n")[1:]
-		for _, kv_str := range ai_cpu_metrics_str_arr {
-			kv := strings.Split(kv_str, ":")
-			if len(kv) == 2 {
-				k := kv[0]
-				v := kv[1]
-				kvmap[k] = v
-			}
-
-		}
-	}
-}
-
-func process_memorystats_reply(commandstats_rcv string, kvmap map[string]interface{}) {
-	ai_cpu_idx := strings.Index(commandstats_rcv, "Memory")
-	if ai_cpu_idx > -1 {
-		ai_cpu_str := commandstats_rcv[ai_cpu_idx:]
-		ai_cpu_metrics_str_arr := strings.Split(ai_cpu_str, "\r\n")[1:]
-		for _, kv_str := range ai_cpu_metrics_str_arr {
-			kv := strings.Split(kv_str, ":")
-			if len(kv) == 2 {
-				k := kv[0]
-				v := kv[1]
-				kvmap[k] = v
-			}
-
-		}
-	}
-}
-
-func process_info_modules_ai_cpu(rcv string, kvmap map[string]interface{}) {
-	ai_cpu_idx := strings.Index(rcv, "ai_cpu")
-	if ai_cpu_idx > -1 {
-		ai_cpu_str := rcv[ai_cpu_idx:]
-		ai_cpu_end_idx := strings.Index(ai_cpu_str, "# ")
-		if ai_cpu_end_idx > -1 {
-			ai_cpu_str = ai_cpu_str[:ai_cpu_end_idx]
-		}
-		ai_cpu_metrics_str_arr := strings.Split(ai_cpu_str, "\r\n")[1:]
-		for _, kv_str := range ai_cpu_metrics_str_arr {
-			kv := strings.Split(kv_str, ":")
-			if len(kv) == 2 {
-				k := kv[0]
-				v := kv[1]
-				kvmap[k] = v
-			}
-
-		}
-	}
-}
-
 func newCollector() inference.MetricCollector { return metricsCollector }
 
 func newProcessor() inference.Processor { return &Processor{} }
@@ -257,6 +306,10 @@ func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m
 	p.Wg = wg
 	p.Metrics = m
 	var err error
+	if clusterMode {
+		// the requests go through the shared clusterRouter
+		return
+	}
 
 	hosts := strings.Split(host, ",")
 	ports := strings.Split(port, ",")
@@ -268,9 +321,7 @@ func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m
 		pos := (numWorker + 1) % len(hosts)
 		p.pclient = make([]*radix.Pool, 1)
 		addr := fmt.Sprintf("%s:%s", hosts[pos], ports[pos])
-		connFunc := func(network, addr string) (radix.Conn, error) {
-			return radix.Dial(network, addr, radix.DialReadTimeout(dialReadTimeout))
-		}
+		p.addrs = []string{addr}
 		p.pclient[0], err = radix.NewPool("tcp", addr, 1, radix.PoolConnFunc(connFunc))
 		if err != nil {
 			log.Fatalf("Error preparing for DAGRUN(), while creating new pool. error = %v", err)
@@ -280,11 +331,10 @@ func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m
 
 func (p *Processor) connectAllHosts(hosts []string, ports []string, err error) error {
 	p.pclient = make([]*radix.Pool, len(hosts))
+	p.addrs = make([]string, len(hosts))
 	for idx, h := range hosts {
 		addr := fmt.Sprintf("%s:%s", h, ports[idx])
-		connFunc := func(network, addr string) (radix.Conn, error) {
-			return radix.Dial(network, addr, radix.DialReadTimeout(dialReadTimeout))
-		}
+		p.addrs[idx] = addr
 		p.pclient[idx], err = radix.NewPool("tcp", addr, 1, radix.PoolConnFunc(connFunc))
 		if err != nil {
 			log.Fatalf("Error preparing for DAGRUN(), while creating new pool. error = %v", err)
@@ -293,51 +343,142 @@ func (p *Processor) connectAllHosts(hosts []string, ports []string, err error) e
 	return err
 }
 
+// connFunc dials the inference connections, bounding each request by
+// the runner request timeout when set, and by -dial-read-timeout otherwise
+func connFunc(network, addr string) (radix.Conn, error) {
+	if runner.RequestTimeout() > 0 {
+		return radix.Dial(network, addr, radix.DialReadTimeout(runner.RequestTimeout()), radix.DialWriteTimeout(runner.RequestTimeout()))
+	}
+	return radix.Dial(network, addr, radix.DialReadTimeout(dialReadTimeout))
+}
+
 func (p *Processor) ProcessInferenceQuery(q []byte, isWarm bool, workerNum int, useReferenceDataRedis bool, useReferenceDataMysql bool, queryNumber int64) ([]*inference.Stat, error) {
 
 	// No need to run again for EXPLAIN
 	if isWarm && p.opts.showExplain {
 		return nil, nil
 	}
-	tensorName := fmt.Sprintf("imageTensor:{w%d}", workerNum)
-	outputTensorName := fmt.Sprintf("classificationTensor:{w%d}", workerNum)
+	tag := fmt.Sprintf("{w%d}", workerNum)
+	modelKey := model
+	if clusterRouter != nil {
+		// the worker tensors share the slot of the model copy of their shard
+		addr := metricsHosts[workerNum%len(metricsHosts)]
+		tag = fmt.Sprintf("%sw%d", shardTags[addr], workerNum)
+		modelKey = model + shardTags[addr]
+	}
+	tensorName := "imageTensor:" + tag
+	outputTensorName := "classificationTensor:" + tag
 	tensorValues := q
-	pos := rand.Int31n(int32(len(p.pclient)))
-	var err error
+	var cmds []radix.CmdAction
+	// TENSORSET, MODELRUN and TENSORGET share a single round trip, as a DAG or as a pipeline,
+	// so they are timed together on the network+inference phase, unless -time-commands is set
 	start := time.Now()
+	var ops [][]string
+	resultTensorName := outputTensorName
+	if len(scriptFilename) > 0 {
+		normalizedTensorName := "normalizedTensor:" + tag
+		resultTensorName = "topkTensor:" + tag
+		ops = [][]string{
+			redisai.TensorSet(tensorName, tensorType, tensorShapeArgs, tensorValues),
+			commandAPI.ScriptRun(script, preProcessFn, []string{tensorName}, []string{normalizedTensorName}),
+			commandAPI.ModelRun(modelKey, []string{normalizedTensorName}, []string{outputTensorName}),
+			commandAPI.ScriptRun(script, postProcessFn, []string{outputTensorName}, []string{resultTensorName}),
+			redisai.TensorGet(resultTensorName),
+		}
+	} else {
+		ops = [][]string{
+			redisai.TensorSet(tensorName, tensorType, tensorShapeArgs, tensorValues),
+			commandAPI.ModelRun(modelKey, []string{tensorName}, []string{outputTensorName}),
+			redisai.TensorGet(outputTensorName),
+		}
+	}
+	// the output tensor is only decoded when the outputs are validated
+	keepOutputs := runner.KeepOutputs()
+	var reply []interface{}
+	var blob []byte
+	var bytesSent, bytesReceived uint64
 	if useDag {
-		var args []string
+		dag := redisai.DAG{Routing: tensorName, Ops: ops}
 		if persistOutputs {
-			args = []string{"PERSIST", "1", outputTensorName, "|>"}
-
-		} else {
-			args = []string{"|>"}
+			dag.Persist = []string{resultTensorName}
 		}
-		args = append(args,
-			"AI.TENSORSET", tensorName, "FLOAT", batchSizeStr, "224", "224", "3", "BLOB", string(tensorValues), "|>",
-			"AI.MODELRUN", model, "INPUTS", tensorName, "OUTPUTS", outputTensorName, "|>",
-			"AI.TENSORGET", outputTensorName, "BLOB")
-		err = p.pclient[pos].Do(radix.Cmd(nil, "AI.DAGRUN", args...))
+		cmd, args := commandAPI.DAGRun(dag)
+		var rcv interface{}
+		if keepOutputs {
+			rcv = &reply
+		}
+		cmds = []radix.CmdAction{redisai.SizedCmd(&bytesSent, &bytesReceived, rcv, cmd, args...)}
 	} else {
-		pipeCmds := radix.Pipeline(
-			radix.FlatCmd(nil, "AI.TENSORSET", tensorName, "FLOAT", batchSizeStr, "224", "224", "3", "BLOB", string(tensorValues)),
-			radix.FlatCmd(nil, "AI.MODELRUN", model, "INPUTS", tensorName, "OUTPUTS", outputTensorName),
-			radix.FlatCmd(nil, "AI.TENSORGET", outputTensorName, "BLOB"),
-		)
-		err = p.pclient[pos].Do(pipeCmds)
+		for idx, op := range ops {
+			var rcv interface{}
+			if keepOutputs && idx == len(ops)-1 {
+				rcv = &blob
+			}
+			cmds = append(cmds, redisai.SizedCmd(&bytesSent, &bytesReceived, rcv, op[0], op[1:]...))
+		}
 	}
-	took := time.Since(start).Microseconds()
-	if err != nil {
-		extendedError := fmt.Errorf("Prediction Receive() failed:%v\n", err)
-		if !continueOnError {
-			log.Fatal(extendedError)
-		} else {
-			fmt.Fprint(os.Stderr, extendedError)
+	serializeTook := time.Since(start).Microseconds()
+	var addr string
+	var err error
+	var opTooks []int64
+	// the tag keeps all of the worker tensors on the same shard
+	do := func(cmds ...radix.CmdAction) (string, error) {
+		return clusterRouter.Do(tensorName, cmds...)
+	}
+	if clusterRouter == nil {
+		pos := rand.Int31n(int32(len(p.pclient)))
+		do = func(cmds ...radix.CmdAction) (string, error) {
+			return p.addrs[pos], p.pclient[pos].Do(rediscluster.Pipeline(cmds...))
 		}
 	}
+	if timeCommands {
+		for _, cmd := range cmds {
+			opStart := time.Now()
+			addr, err = do(cmd)
+			opTooks = append(opTooks, time.Since(opStart).Microseconds())
+			if err != nil {
+				break
+			}
+		}
+	} else {
+		addr, err = do(cmds...)
+	}
+	networkTook := time.Since(start).Microseconds() - serializeTook
+	timedOut := inference.IsTimeout(err)
+	var output []float32
+	if err == nil {
+		if useDag {
+			blob = redisai.DAGOutput(reply)
+		}
+		if blob != nil {
+			output = inference.ConvertByteSliceToFloatSlice(blob)
+		}
+	}
+	took := time.Since(start).Microseconds()
 
 	stat := inference.GetStat()
-	stat.Init([]byte(inferenceType), took, uint64(batchSize), false, "")
+	stat.Init([]byte(inferenceType), took, uint64(batchSize), timedOut, "")
+	stat.SetHost(addr)
+	stat.SetBytes(bytesSent, bytesReceived)
+	stat.AddPhase(inference.PhaseSerialize, serializeTook)
+	if timeCommands {
+		for idx, opTook := range opTooks {
+			stat.AddPhase(redisai.OpPhase(ops[idx]), opTook)
+		}
+	} else {
+		stat.AddPhase(inference.PhaseNetworkInference, networkTook)
+	}
+	if err != nil && !timedOut {
+		extendedError := fmt.Errorf("Prediction Receive() failed: %w", err)
+		if continueOnError {
+			fmt.Fprintln(os.Stderr, extendedError)
+		}
+		return []*inference.Stat{stat}, inference.RadixError(extendedError)
+	}
+	if output != nil {
+		stat.AddPhase(inference.PhaseDeserialize, took-serializeTook-networkTook)
+		stat.SetOutput(output)
+	}
 
 	return []*inference.Stat{stat}, nil
 }
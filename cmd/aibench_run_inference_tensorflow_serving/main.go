@@ -10,15 +10,20 @@ import (
 	tfcoreframework "github.com/RedisAI/aibench/cmd/aibench_run_inference_tensorflow_serving/tensorflow/core/framework"
 	tensorflowserving "github.com/RedisAI/aibench/cmd/aibench_run_inference_tensorflow_serving/tensorflow_serving/apis"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/RedisAI/aibench/inference"
+	"github.com/RedisAI/aibench/internal/redisai"
 	"github.com/go-redis/redis/v8"
+	"github.com/golang/protobuf/proto"
 	googleprotobuf "github.com/golang/protobuf/ptypes/wrappers"
 	_ "github.com/lib/pq"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
 )
 
 // Program option vars:
@@ -29,7 +34,9 @@ var (
 	version               int
 	showExplain           bool
 	runner                *inference.BenchmarkRunner
+	metricsFlags          *inference.PrometheusFlags
 	rowBenchmarkNBytes    = 8 + 120 + 1024
+	inferenceType         = "TensorFlow serving Query"
 	redisClient           *redis.Client
 )
 
@@ -40,7 +47,8 @@ func init() {
 	flag.StringVar(&tensorflowServingHost, "tensorflow-serving-host", "127.0.0.1:8500", "TensorFlow serving host address and port")
 	flag.StringVar(&model, "model", "", "Model name")
 	flag.IntVar(&version, "model-version", 1, "Model version")
-	flag.Parse()
+	metricsFlags = inference.RegisterPrometheusFlags("http://127.0.0.1:8501/monitoring/prometheus/metrics")
+	runner.ParseFlags()
 	redisClient = redis.NewClient(&redis.Options{
 		Addr: redisHost,
 	})
@@ -48,7 +56,47 @@ func init() {
 }
 
 func main() {
-	runner.Run(&inference.RedisAIPool, newProcessor, rowBenchmarkNBytes, 1, nil)
+	setServerInfo()
+	var collectorFn inference.MetricCollectorCreate
+	if metricsFlags.Enabled() || runner.UseReferenceDataRedis() {
+		collectorFn = newCollector
+	}
+	runner.Run(&inference.RedisAIPool, newProcessor, rowBenchmarkNBytes, 1, collectorFn)
+}
+
+// setServerInfo saves the status of the served model versions on the results. TensorFlow Serving
+// doesn't expose its own version
+func setServerInfo() {
+	conn, err := grpc.Dial(tensorflowServingHost, grpc.WithInsecure())
+	if err != nil {
+		log.Printf("Error getting the server info of %s: %v", tensorflowServingHost, err)
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	modelStatus, err := tensorflowserving.NewModelServiceClient(conn).GetModelStatus(ctx, &tensorflowserving.GetModelStatusRequest{
+		ModelSpec: &tensorflowserving.ModelSpec{Name: model},
+	})
+	if err != nil {
+		log.Printf("Error getting the server info of %s: %v", tensorflowServingHost, err)
+		return
+	}
+	versions := make([]map[string]interface{}, 0, len(modelStatus.ModelVersionStatus))
+	for _, versionStatus := range modelStatus.ModelVersionStatus {
+		versions = append(versions, map[string]interface{}{
+			"version": versionStatus.Version,
+			"state":   versionStatus.State.String(),
+		})
+	}
+	runner.SetServerInfo(tensorflowServingHost, map[string]interface{}{
+		"model":         model,
+		"modelVersions": versions,
+	})
+}
+
+func newCollector() inference.MetricCollector {
+	return redisai.NewServingCollector(runner, metricsFlags, redisHost)
 }
 
 type queryExecutorOptions struct {
@@ -69,11 +117,6 @@ func (p *Processor) Close() {
 	p.grpcClientConn.Close()
 }
 
-func (p *Processor) CollectRunTimeMetrics() (ts int64, stats interface{}, err error) {
-	// TODO:
-	return
-}
-
 func newProcessor() inference.Processor { return &Processor{} }
 
 func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m chan uint64, rs chan uint64) {
@@ -116,12 +159,20 @@ func (p *Processor) ProcessInferenceQuery(q []byte, isWarm bool, workerNum int,
 
 	referenceDataKeyName := "referenceBLOB:{" + idS + "}"
 
+	// the request deadline covers both the reference data fetch and the prediction
+	ctx, cancel := runner.RequestContext()
+	defer cancel()
 	start := time.Now()
+	var referenceFetchTook int64 = 0
 	var request *tensorflowserving.PredictRequest = nil
 	if useReferenceDataRedis {
-		redisRespReferenceBytes, redisErr := redisClient.Get(redisClient.Context(), referenceDataKeyName).Bytes()
+		redisRespReferenceBytes, redisErr := redisClient.Get(ctx, referenceDataKeyName).Bytes()
+		referenceFetchTook = time.Since(start).Microseconds()
+		if inference.IsTimeout(redisErr) {
+			return inference.RequestStat(inferenceType, start, true), nil
+		}
 		if redisErr != nil {
-			log.Fatalln(redisErr)
+			return inference.RequestStat(inferenceType, start, false), inference.GoRedisError(redisErr)
 		}
 		request = &tensorflowserving.PredictRequest{
 			ModelSpec: &tensorflowserving.ModelSpec{
@@ -185,16 +236,55 @@ func (p *Processor) ProcessInferenceQuery(q []byte, isWarm bool, workerNum int,
 		}
 	}
 
-	PredictResponse, err := p.predictionServiceClient.Predict(context.Background(), request)
-	took := time.Since(start).Microseconds()
+	serializeTook := time.Since(start).Microseconds() - referenceFetchTook
+	PredictResponse, err := p.predictionServiceClient.Predict(ctx, request)
+	networkTook := time.Since(start).Microseconds() - referenceFetchTook - serializeTook
+	if status.Code(err) == codes.DeadlineExceeded {
+		return inference.RequestStat(inferenceType, start, true), nil
+	}
 	if err != nil {
-		log.Fatalf("Prediction failed:%v\n", err)
+		return inference.RequestStat(inferenceType, start, false), inference.GRPCError(fmt.Errorf("Prediction failed: %w", err))
 	}
 	if p.opts.printResponse {
 		fmt.Println("RESPONSE: ", PredictResponse)
 	}
 
+	var output []float32
+	if runner.KeepOutputs() {
+		output = predictionOutput(PredictResponse)
+	}
+	took := time.Since(start).Microseconds()
+
 	stat := inference.GetStat()
-	stat.Init([]byte("TensorFlow serving Query"), took, uint64(0), false, "")
+	stat.Init([]byte(inferenceType), took, uint64(1), false, "")
+	stat.SetBytes(uint64(proto.Size(request)), uint64(proto.Size(PredictResponse)))
+	if useReferenceDataRedis {
+		stat.AddPhase(inference.PhaseReferenceFetch, referenceFetchTook)
+	}
+	stat.AddPhase(inference.PhaseSerialize, serializeTook)
+	stat.AddPhase(inference.PhaseNetworkInference, networkTook)
+	if output != nil {
+		stat.AddPhase(inference.PhaseDeserialize, took-referenceFetchTook-serializeTook-networkTook)
+		stat.SetOutput(output)
+	}
 	return []*inference.Stat{stat}, nil
 }
+
+// predictionOutput decodes the float output tensors of a prediction, concatenated by output name
+func predictionOutput(response *tensorflowserving.PredictResponse) []float32 {
+	names := make([]string, 0, len(response.Outputs))
+	for name := range response.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var output []float32
+	for _, name := range names {
+		tensor := response.Outputs[name]
+		if len(tensor.FloatVal) > 0 {
+			output = append(output, tensor.FloatVal...)
+		} else {
+			output = append(output, inference.ConvertByteSliceToFloatSlice(tensor.TensorContent)...)
+		}
+	}
+	return output
+}
@@ -9,6 +9,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/RedisAI/aibench/inference"
+	"github.com/RedisAI/aibench/internal/redisai"
 	"github.com/go-redis/redis/v8"
 	_ "github.com/lib/pq"
 	"github.com/valyala/fasthttp"
@@ -28,9 +29,11 @@ var (
 	strHost               = []byte("")
 	showExplain           bool
 	runner                *inference.BenchmarkRunner
+	metricsFlags          *inference.PrometheusFlags
 	redisClient           *redis.Client
 	torchserveReadTimeout time.Duration
 	rowBenchmarkNBytes    = 8 + 120 + 1024
+	inferenceType         = "DL REST API Query"
 )
 
 // Parse args:
@@ -40,7 +43,8 @@ func init() {
 	flag.StringVar(&torchserveHost, "torchserve-host", "127.0.0.1:8080", "REST API host address and port")
 	flag.DurationVar(&torchserveReadTimeout, "torchserve-read-timeout", 5*time.Second, "REST API timeout")
 	flag.StringVar(&torchserveRequestUri, "torchserve-request-uri", "/predictions/financial", "torchserve REST API request URI")
-	flag.Parse()
+	metricsFlags = inference.RegisterPrometheusFlags("http://127.0.0.1:8082/metrics")
+	runner.ParseFlags()
 	redisClient = redis.NewClient(&redis.Options{
 		Addr: redisHost,
 	})
@@ -50,7 +54,31 @@ func init() {
 func main() {
 	strRequestURI = []byte(torchserveRequestUri)
 	strHost = []byte(torchserveHost)
-	runner.Run(&inference.RedisAIPool, newProcessor, rowBenchmarkNBytes, 1, nil)
+	setServerInfo()
+	var collectorFn inference.MetricCollectorCreate
+	if metricsFlags.Enabled() || runner.UseReferenceDataRedis() {
+		collectorFn = newCollector
+	}
+	runner.Run(&inference.RedisAIPool, newProcessor, rowBenchmarkNBytes, 1, collectorFn)
+}
+
+// setServerInfo saves the API description info of TorchServe, holding its version, on the results
+func setServerInfo() {
+	description, err := inference.FetchServerInfo("http://"+torchserveHost+"/api-description", torchserveReadTimeout)
+	if err != nil {
+		log.Printf("Error getting the server info of %s: %v", torchserveHost, err)
+		return
+	}
+	info, ok := description["info"].(map[string]interface{})
+	if !ok {
+		log.Printf("Error getting the server info of %s: the API description has no info", torchserveHost)
+		return
+	}
+	runner.SetServerInfo(torchserveHost, info)
+}
+
+func newCollector() inference.MetricCollector {
+	return redisai.NewServingCollector(runner, metricsFlags, redisHost)
 }
 
 type queryExecutorOptions struct {
@@ -70,11 +98,6 @@ func (p *Processor) Close() {
 
 }
 
-func (p *Processor) CollectRunTimeMetrics() (ts int64, stats interface{}, err error) {
-	// TODO:
-	return
-}
-
 func newProcessor() inference.Processor { return &Processor{} }
 
 func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m chan uint64, rs chan uint64) {
@@ -86,13 +109,18 @@ func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m
 		printResponse: runner.DoPrintResponses(),
 	}
 
+	// the runner request timeout, when set, takes precedence over the REST API timeout
+	readTimeout := torchserveReadTimeout
+	if runner.RequestTimeout() > 0 {
+		readTimeout = runner.RequestTimeout()
+	}
 	p.httpclient = &fasthttp.HostClient{
 		Addr:                      torchserveHost,
-		ReadTimeout:               torchserveReadTimeout,
-		MaxIdleConnDuration:       torchserveReadTimeout,
+		ReadTimeout:               readTimeout,
+		MaxIdleConnDuration:       readTimeout,
 		MaxIdemponentCallAttempts: 10,
 		Dial: func(addr string) (net.Conn, error) {
-			return fasthttp.DialTimeout(addr, torchserveReadTimeout)
+			return fasthttp.DialTimeout(addr, readTimeout)
 		},
 	}
 }
@@ -119,11 +147,23 @@ func (p *Processor) ProcessInferenceQuery(q []byte, isWarm bool, workerNum int,
 	req.SetHostBytes(strHost)
 	req.Header.SetContentType("application/json")
 	res := fasthttp.AcquireResponse()
+	// the request deadline covers both the reference data fetch and the prediction
+	ctx, cancel := runner.RequestContext()
+	defer cancel()
 	start := time.Now()
+	var referenceFetchTook int64 = 0
 	if useReferenceDataRedis {
-		redisRespReference, redisErr = redisClient.Get(redisClient.Context(), referenceDataKeyName).Bytes()
+		redisRespReference, redisErr = redisClient.Get(ctx, referenceDataKeyName).Bytes()
+		referenceFetchTook = time.Since(start).Microseconds()
+		if inference.IsTimeout(redisErr) {
+			fasthttp.ReleaseRequest(req)
+			fasthttp.ReleaseResponse(res)
+			return inference.RequestStat(inferenceType, start, true), nil
+		}
 		if redisErr != nil {
-			log.Fatalln("Error on redisClient.Get", redisErr)
+			fasthttp.ReleaseRequest(req)
+			fasthttp.ReleaseResponse(res)
+			return inference.RequestStat(inferenceType, start, false), inference.GoRedisError(redisErr)
 		}
 		redisRespReferenceFloats = inference.ConvertByteSliceToFloatSlice(redisRespReference)
 		body = map[string][]float32{"transaction": transactionValuesFloats, "reference": redisRespReferenceFloats}
@@ -134,26 +174,59 @@ func (p *Processor) ProcessInferenceQuery(q []byte, isWarm bool, workerNum int,
 	}
 	bodyJSON, err := json.Marshal(body)
 	if err != nil {
-		log.Fatalln(err)
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(res)
+		return nil, inference.NewClientError(fmt.Errorf("Error building the inference request: %w", err))
 	}
 
 	req.SetBody(bytes.NewBuffer(bodyJSON).Bytes())
-	err = p.httpclient.DoTimeout(req, res, torchserveReadTimeout)
+	serializeTook := time.Since(start).Microseconds() - referenceFetchTook
+	if deadline, ok := ctx.Deadline(); ok {
+		err = p.httpclient.DoDeadline(req, res, deadline)
+	} else {
+		err = p.httpclient.DoTimeout(req, res, torchserveReadTimeout)
+	}
+	if inference.IsTimeout(err) {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(res)
+		return inference.RequestStat(inferenceType, start, true), nil
+	}
 	if err != nil {
+		fasthttp.ReleaseRequest(req)
 		fasthttp.ReleaseResponse(res)
-		log.Fatalln("Error on httpclient.DoTimeout", err)
+		return inference.RequestStat(inferenceType, start, false), inference.NewConnectionError(fmt.Errorf("Error on httpclient.DoTimeout: %w", err))
 	}
-	took := time.Since(start).Microseconds()
+	networkTook := time.Since(start).Microseconds() - referenceFetchTook - serializeTook
 	if p.opts.printResponse {
 		fmt.Printf("REQUEST BODY: %v RESPONSE %v", body, res.String())
 	}
-	if res.StatusCode() != 200 {
-		return nil, fmt.Errorf("Wrong status inference response code. expected %v, got %d", 200, res.StatusCode())
+	statusCode := res.StatusCode()
+	bytesSent, bytesReceived := uint64(len(req.Body())), uint64(len(res.Body()))
+	var output []float32
+	if statusCode == 200 && runner.KeepOutputs() {
+		output, err = inference.DecodeJSONOutputs(res.Body())
 	}
 	fasthttp.ReleaseRequest(req)
 	fasthttp.ReleaseResponse(res)
+	if statusCode != 200 {
+		return inference.RequestStat(inferenceType, start, false), inference.NewServerError(fmt.Errorf("Wrong status inference response code. expected %v, got %d", 200, statusCode))
+	}
+	if err != nil {
+		return inference.RequestStat(inferenceType, start, false), inference.NewBadResponseError(fmt.Errorf("Error decoding the inference response: %w", err))
+	}
+	took := time.Since(start).Microseconds()
 	stat := inference.GetStat()
+	stat.SetOutput(output)
+	stat.SetBytes(bytesSent, bytesReceived)
 
-	stat.Init([]byte("DL REST API Query"), took, uint64(0), false, "")
+	stat.Init([]byte(inferenceType), took, uint64(1), false, "")
+	if useReferenceDataRedis {
+		stat.AddPhase(inference.PhaseReferenceFetch, referenceFetchTook)
+	}
+	stat.AddPhase(inference.PhaseSerialize, serializeTook)
+	stat.AddPhase(inference.PhaseNetworkInference, networkTook)
+	if output != nil {
+		stat.AddPhase(inference.PhaseDeserialize, took-referenceFetchTook-serializeTook-networkTook)
+	}
 	return []*inference.Stat{stat}, nil
 }
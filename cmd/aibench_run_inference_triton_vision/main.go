@@ -9,8 +9,11 @@ import (
 	"fmt"
 	triton "github.com/RedisAI/aibench/cmd/aibench_run_inference_triton_vision/nvidia_inferenceserver"
 	"github.com/RedisAI/aibench/inference"
+	"github.com/golang/protobuf/proto"
 	_ "github.com/lib/pq"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"log"
 	"sync"
 	"time"
@@ -25,8 +28,13 @@ var (
 	showExplain        bool
 	inferenceType      = "NVIDIA triton Query - mobilenet_v1_100_224 "
 	rowBenchmarkNBytes = 4 * 1 * 224 * 224 * 3 // number of bytes per float * N x H x W x C
+	tensorShape        string
+	inputShape         []int64 // input tensor shape, including the batch size
+	modelInput         string
+	modelOutput        string
 	outputSize         = 1001
 	grpcClientConn     *grpc.ClientConn
+	metricsFlags       *inference.PrometheusFlags
 )
 
 // Parse args:
@@ -35,7 +43,20 @@ func init() {
 	flag.StringVar(&host, "host", "127.0.0.1:8001", "NVidia triton host address and port")
 	flag.StringVar(&model, "model", "mobilenet_v1_100_224_NxHxWxC", "Name of model being served. (Required)")
 	flag.StringVar(&version, "model-version", "", "Model version. Default: Latest Version.")
-	flag.Parse()
+	flag.StringVar(&modelInput, "model-input", "input", "Name of the model input tensor.")
+	flag.StringVar(&modelOutput, "model-output", "MobilenetV1/Predictions/Reshape_1", "Name of the model output tensor.")
+	flag.StringVar(&tensorShape, "tensor-shape", "224,224,3", "Input tensor shape, excluding the batch size, as comma separated dimensions (H,W,C)")
+	metricsFlags = inference.RegisterPrometheusFlags("http://127.0.0.1:8002/metrics")
+	runner.ParseFlags()
+	dims, err := inference.ParseTensorShape(tensorShape)
+	if err != nil {
+		log.Fatal(err)
+	}
+	inputShape = append([]int64{1}, dims...)
+	rowBenchmarkNBytes = 4
+	for _, dim := range inputShape {
+		rowBenchmarkNBytes *= int(dim)
+	}
 }
 
 func ServerLiveRequest(client triton.GRPCInferenceServiceClient) *triton.ServerLiveResponse {
@@ -66,6 +87,20 @@ func ServerReadyRequest(client triton.GRPCInferenceServiceClient) *triton.Server
 	return serverReadyResponse
 }
 
+func ServerMetadataRequest(client triton.GRPCInferenceServiceClient) *triton.ServerMetadataResponse {
+	// Create context for our request with 10 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	serverMetadataRequest := triton.ServerMetadataRequest{}
+	// Submit ServerMetadata request to server
+	serverMetadataResponse, err := client.ServerMetadata(ctx, &serverMetadataRequest)
+	if err != nil {
+		log.Fatalf("Couldn't get server metadata: %v", err)
+	}
+	return serverMetadataResponse
+}
+
 func ModelMetadataRequest(client triton.GRPCInferenceServiceClient, modelName string, modelVersion string) *triton.ModelMetadataResponse {
 	// Create context for our request with 10 second timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -84,17 +119,23 @@ func ModelMetadataRequest(client triton.GRPCInferenceServiceClient, modelName st
 	return modelMetadataResponse
 }
 
-func ModelInferRequest(client triton.GRPCInferenceServiceClient, rawInput []byte, modelName string, modelVersion string) *triton.ModelInferResponse {
-	// Create context for our request with 10 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// ModelInferRequest sends the inference request of rawInput, returning the response along with the
+// encoded size of the request
+func ModelInferRequest(client triton.GRPCInferenceServiceClient, rawInput []byte, modelName string, modelVersion string) (*triton.ModelInferResponse, int, error) {
+	// Create context for our request with the runner request timeout, or 10 second by default
+	timeout := 10 * time.Second
+	if runner.RequestTimeout() > 0 {
+		timeout = runner.RequestTimeout()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	// Create request input tensors
 	inferInputs := []*triton.ModelInferRequest_InferInputTensor{
 		{
-			Name:     "input",
+			Name:     modelInput,
 			Datatype: "FP32",
-			Shape:    []int64{1, 224, 224, 3},
+			Shape:    inputShape,
 			Contents: &triton.InferTensorContents{
 				RawContents: rawInput,
 			},
@@ -104,7 +145,7 @@ func ModelInferRequest(client triton.GRPCInferenceServiceClient, rawInput []byte
 	// Create request input output tensors
 	inferOutputs := []*triton.ModelInferRequest_InferRequestedOutputTensor{
 		{
-			Name: "MobilenetV1/Predictions/Reshape_1",
+			Name: modelOutput,
 		},
 	}
 
@@ -117,11 +158,8 @@ func ModelInferRequest(client triton.GRPCInferenceServiceClient, rawInput []byte
 	}
 
 	// Submit inference request to server
-	modelInferResponse, err := client.ModelInfer(ctx, &modelInferRequest)
-	if err != nil {
-		log.Fatalf("Error processing InferRequest: %v", err)
-	}
-	return modelInferResponse
+	response, err := client.ModelInfer(ctx, &modelInferRequest)
+	return response, proto.Size(&modelInferRequest), err
 }
 
 // Convert output's raw bytes into int32 data (assumes Little Endian)
@@ -134,7 +172,11 @@ func Postprocess(inferResponse *triton.ModelInferResponse) []float32 {
 }
 
 func main() {
-	runner.Run(&inference.RedisAIPool, newProcessor, rowBenchmarkNBytes, 1, nil)
+	var collectorFn inference.MetricCollectorCreate
+	if metricsFlags.Enabled() {
+		collectorFn = func() inference.MetricCollector { return metricsFlags.Collector() }
+	}
+	runner.Run(&inference.RedisAIPool, newProcessor, rowBenchmarkNBytes, 1, collectorFn)
 }
 
 type queryExecutorOptions struct {
@@ -156,11 +198,6 @@ func (p *Processor) Close() {
 
 }
 
-func (p *Processor) CollectRunTimeMetrics() (ts int64, stats interface{}, err error) {
-	// TODO:
-	return
-}
-
 func newProcessor() inference.Processor { return &Processor{} }
 
 func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m chan uint64, rs chan uint64) {
@@ -190,6 +227,15 @@ func (p *Processor) Init(numWorker int, totalWorkers int, wg *sync.WaitGroup, m
 
 	modelMetadataResponse := ModelMetadataRequest(p.pclient, model, "")
 	fmt.Println(modelMetadataResponse)
+
+	if numWorker == 0 {
+		serverMetadataResponse := ServerMetadataRequest(p.pclient)
+		runner.SetServerInfo(host, map[string]interface{}{
+			"name":       serverMetadataResponse.Name,
+			"version":    serverMetadataResponse.Version,
+			"extensions": serverMetadataResponse.Extensions,
+		})
+	}
 }
 
 func (p *Processor) ProcessInferenceQuery(q []byte, isWarm bool, workerNum int, useReferenceDataRedis bool, useReferenceDataMysql bool, queryNumber int64) ([]*inference.Stat, error) {
@@ -200,15 +246,25 @@ func (p *Processor) ProcessInferenceQuery(q []byte, isWarm bool, workerNum int,
 	}
 	tensorValues := q
 	start := time.Now()
-	inferResponse := ModelInferRequest(p.pclient, tensorValues, model, version)
+	inferResponse, requestSize, err := ModelInferRequest(p.pclient, tensorValues, model, version)
 	took := time.Since(start).Microseconds()
-	if p.opts.printResponse {
+	timedOut := status.Code(err) == codes.DeadlineExceeded
+	if p.opts.printResponse && err == nil {
 		fmt.Println("RAW RESPONSE: ", inferResponse)
 		fmt.Println("RESPONSE: ", Postprocess(inferResponse))
 	}
 
 	stat := inference.GetStat()
-	stat.Init([]byte(inferenceType), took, uint64(0), false, "")
+	stat.Init([]byte(inferenceType), took, uint64(1), timedOut, "")
+	if err != nil && !timedOut {
+		return []*inference.Stat{stat}, inference.GRPCError(fmt.Errorf("Error processing InferRequest: %w", err))
+	}
+	if err == nil {
+		stat.SetBytes(uint64(requestSize), uint64(proto.Size(inferResponse)))
+	}
+	if err == nil && runner.KeepOutputs() {
+		stat.SetOutput(Postprocess(inferResponse))
+	}
 
 	return []*inference.Stat{stat}, nil
 }
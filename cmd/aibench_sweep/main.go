@@ -0,0 +1,382 @@
+// aibench_sweep runs a benchmark runner over a matrix of flag values, as described
+// by a YAML or JSON spec file. Before each run the target Redis servers can be reset
+// and set up over the Redis protocol, e.g. to FLUSHALL and AI.MODELSET the model with
+// the run autobatching. All the run results are collected on one combined document.
+//
+// Usage:
+//
+//	aibench_sweep -spec sweep.yml
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/RedisAI/aibench/inference"
+	"github.com/mediocregopher/radix/v3"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Program option vars:
+var (
+	specFile        string
+	dryRun          bool
+	continueOnError bool
+)
+
+// Parse args:
+func init() {
+	flag.StringVar(&specFile, "spec", "", "YAML or JSON sweep spec file.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Only print the runs, without resetting the servers nor running the benchmarks (default false).")
+	flag.BoolVar(&continueOnError, "continue-on-error", false, "Keep sweeping when a run or its setup fails (default false).")
+}
+
+// Spec describes a sweep. Any string in Args, Redis.Commands and OutputName can refer to
+// the variation values as ${FLAG}, and to the run number as ${run}
+type Spec struct {
+	Name string `yaml:"name"`
+	// Runner is the benchmark runner executable, e.g. aibench_run_inference_redisai_vision
+	Runner    string `yaml:"runner"`
+	OutputDir string `yaml:"output_dir"`
+	// OutputName names the run result files, by default after the run number and the variation values
+	OutputName       string `yaml:"output_name"`
+	RunsPerVariation int    `yaml:"runs_per_variation"`
+	SleepBetweenRuns string `yaml:"sleep_between_runs"`
+	// Args are the runner flags common to all runs, by flag name
+	Args yaml.MapSlice `yaml:"args"`
+	// Matrix lists the values of each swept flag, all of their combinations are run
+	Matrix yaml.MapSlice `yaml:"matrix"`
+	// Constraints skip the variations that don't meet them, as "FLAG OPERATOR FLAG_OR_NUMBER"
+	Constraints []string    `yaml:"constraints"`
+	Redis       *RedisSetup `yaml:"redis"`
+}
+
+// RedisSetup lists the commands sent to every host before each run. Arguments
+// prefixed by @file: are replaced by the content of the file, e.g. a model blob
+type RedisSetup struct {
+	Hosts    []string   `yaml:"hosts"`
+	Commands [][]string `yaml:"commands"`
+}
+
+// SweepResult is the combined results document, indexed by run
+type SweepResult struct {
+	Name      string     `json:"Name"`
+	Runner    string     `json:"Runner"`
+	StartTime int64      `json:"StartTime"`
+	EndTime   int64      `json:"EndTime"`
+	Runs      []SweepRun `json:"Runs"`
+}
+
+// SweepRun is the outcome of a single run of a variation
+type SweepRun struct {
+	Index      int                   `json:"Index"`
+	Variation  map[string]string     `json:"Variation"`
+	Run        int                   `json:"Run"`
+	Args       []string              `json:"Args"`
+	ResultFile string                `json:"ResultFile"`
+	Error      string                `json:"Error"`
+	Result     *inference.TestResult `json:"Result"`
+}
+
+func main() {
+	flag.Parse()
+	if len(specFile) == 0 {
+		log.Fatal("A -spec file is required")
+	}
+	spec, err := loadSpec(specFile)
+	if err != nil {
+		log.Fatalf("Error loading the sweep spec %s: %v", specFile, err)
+	}
+	sleep, err := time.ParseDuration(spec.SleepBetweenRuns)
+	if err != nil {
+		log.Fatalf("Invalid sleep_between_runs: %v", err)
+	}
+	variations, err := expandMatrix(spec.Matrix, spec.Constraints)
+	if err != nil {
+		log.Fatalf("Invalid sweep matrix: %v", err)
+	}
+	if !dryRun {
+		if err = os.MkdirAll(spec.OutputDir, 0755); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Printf("Sweeping %s over %d variations, %d runs each\n", spec.Runner, len(variations), spec.RunsPerVariation)
+
+	sweep := SweepResult{Name: spec.Name, Runner: spec.Runner, StartTime: time.Now().Unix(), Runs: make([]SweepRun, 0)}
+	for _, variation := range variations {
+		for run := 1; run <= spec.RunsPerVariation; run++ {
+			values := map[string]string{"run": strconv.Itoa(run)}
+			for k, v := range variation {
+				values[k] = v
+			}
+			sweepRun := runVariation(spec, variation, values, len(sweep.Runs), run)
+			sweep.Runs = append(sweep.Runs, sweepRun)
+			if len(sweepRun.Error) > 0 {
+				if !continueOnError {
+					writeSweepResult(spec, sweep)
+					log.Fatalf("Run %d failed: %s", sweepRun.Index, sweepRun.Error)
+				}
+				fmt.Printf("Run %d failed: %s\n", sweepRun.Index, sweepRun.Error)
+			}
+			if !dryRun {
+				time.Sleep(sleep)
+			}
+		}
+	}
+	writeSweepResult(spec, sweep)
+}
+
+func loadSpec(fileName string) (*Spec, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	spec := &Spec{
+		Name:             strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName)),
+		OutputDir:        "./results",
+		RunsPerVariation: 1,
+		SleepBetweenRuns: "0s",
+	}
+	// JSON being a subset of YAML, both are parsed as YAML
+	if err = yaml.UnmarshalStrict(data, spec); err != nil {
+		return nil, err
+	}
+	if len(spec.Runner) == 0 {
+		return nil, fmt.Errorf("no runner set")
+	}
+	return spec, nil
+}
+
+// expandMatrix returns all the combinations of the matrix values, in the matrix order,
+// skipping those that don't meet the constraints
+func expandMatrix(matrix yaml.MapSlice, constraints []string) ([]map[string]string, error) {
+	variations := []map[string]string{{}}
+	for _, item := range matrix {
+		name := fmt.Sprint(item.Key)
+		values, ok := item.Value.([]interface{})
+		if !ok {
+			values = []interface{}{item.Value}
+		}
+		expanded := make([]map[string]string, 0, len(variations)*len(values))
+		for _, variation := range variations {
+			for _, value := range values {
+				next := map[string]string{name: fmt.Sprint(value)}
+				for k, v := range variation {
+					next[k] = v
+				}
+				expanded = append(expanded, next)
+			}
+		}
+		variations = expanded
+	}
+	kept := make([]map[string]string, 0, len(variations))
+	for _, variation := range variations {
+		ok, err := meetsConstraints(variation, constraints)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, variation)
+		} else {
+			fmt.Printf("Skipping variation %v, out of the constraints\n", variation)
+		}
+	}
+	return kept, nil
+}
+
+// meetsConstraints checks numeric constraints like "workers >= metadata-autobatching"
+func meetsConstraints(variation map[string]string, constraints []string) (bool, error) {
+	operand := func(s string) (float64, error) {
+		if v, ok := variation[s]; ok {
+			s = v
+		}
+		return strconv.ParseFloat(s, 64)
+	}
+	for _, constraint := range constraints {
+		fields := strings.Fields(constraint)
+		if len(fields) != 3 {
+			return false, fmt.Errorf("constraint %q is not as FLAG OPERATOR FLAG_OR_NUMBER", constraint)
+		}
+		left, err := operand(fields[0])
+		if err != nil {
+			return false, fmt.Errorf("constraint %q: %v", constraint, err)
+		}
+		right, err := operand(fields[2])
+		if err != nil {
+			return false, fmt.Errorf("constraint %q: %v", constraint, err)
+		}
+		var ok bool
+		switch fields[1] {
+		case "<":
+			ok = left < right
+		case "<=":
+			ok = left <= right
+		case ">":
+			ok = left > right
+		case ">=":
+			ok = left >= right
+		case "==":
+			ok = left == right
+		case "!=":
+			ok = left != right
+		default:
+			return false, fmt.Errorf("constraint %q has an unknown operator", constraint)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// runVariation resets the servers and runs the runner once for the variation
+func runVariation(spec *Spec, variation map[string]string, values map[string]string, index int, run int) SweepRun {
+	expand := func(s string) string {
+		return os.Expand(s, func(name string) string { return values[name] })
+	}
+	outputName := expand(spec.OutputName)
+	if len(outputName) == 0 {
+		outputName = defaultOutputName(variation, run)
+	}
+	sweepRun := SweepRun{
+		Index:      index,
+		Variation:  variation,
+		Run:        run,
+		ResultFile: filepath.Join(spec.OutputDir, "JSON_"+outputName+".json"),
+	}
+	args := make([]string, 0, len(spec.Args)+len(variation)+1)
+	for _, item := range spec.Args {
+		args = append(args, fmt.Sprintf("-%v=%s", item.Key, expand(fmt.Sprint(item.Value))))
+	}
+	flags := make([]string, 0, len(variation))
+	for name := range variation {
+		flags = append(flags, name)
+	}
+	sort.Strings(flags)
+	for _, name := range flags {
+		args = append(args, fmt.Sprintf("-%s=%s", name, variation[name]))
+	}
+	args = append(args, "-json-out-file="+sweepRun.ResultFile)
+	sweepRun.Args = args
+
+	fmt.Printf("Run %d: %s %s\n", index, spec.Runner, strings.Join(args, " "))
+	if dryRun {
+		return sweepRun
+	}
+	if spec.Redis != nil {
+		if err := setupRedis(spec.Redis, expand); err != nil {
+			sweepRun.Error = fmt.Sprintf("setting up redis: %v", err)
+			return sweepRun
+		}
+	}
+	if err := runRunner(spec.Runner, args, filepath.Join(spec.OutputDir, "RAW_"+outputName+".txt")); err != nil {
+		sweepRun.Error = err.Error()
+		return sweepRun
+	}
+	result, err := loadTestResult(sweepRun.ResultFile)
+	if err != nil {
+		sweepRun.Error = fmt.Sprintf("loading the run result: %v", err)
+		return sweepRun
+	}
+	sweepRun.Result = result
+	return sweepRun
+}
+
+// defaultOutputName names the run files after the run number and the variation values
+func defaultOutputName(variation map[string]string, run int) string {
+	flags := make([]string, 0, len(variation))
+	for name := range variation {
+		flags = append(flags, name)
+	}
+	sort.Strings(flags)
+	outputName := fmt.Sprintf("run_%d", run)
+	for _, name := range flags {
+		outputName += "_" + name + "_" + variation[name]
+	}
+	return outputName
+}
+
+// setupRedis sends the setup commands to every host
+func setupRedis(setup *RedisSetup, expand func(string) string) error {
+	for _, host := range setup.Hosts {
+		conn, err := radix.Dial("tcp", host)
+		if err != nil {
+			return err
+		}
+		for _, command := range setup.Commands {
+			if len(command) == 0 {
+				continue
+			}
+			args := make([]string, len(command)-1)
+			for i, arg := range command[1:] {
+				args[i] = expand(arg)
+				if strings.HasPrefix(args[i], "@file:") {
+					blob, err := ioutil.ReadFile(strings.TrimPrefix(args[i], "@file:"))
+					if err != nil {
+						_ = conn.Close()
+						return err
+					}
+					args[i] = string(blob)
+				}
+			}
+			if err = conn.Do(radix.Cmd(nil, expand(command[0]), args...)); err != nil {
+				_ = conn.Close()
+				return fmt.Errorf("%s on %s: %v", command[0], host, err)
+			}
+		}
+		_ = conn.Close()
+	}
+	return nil
+}
+
+// runRunner runs the runner, copying its output to stdout and to rawFile
+func runRunner(runner string, args []string, rawFile string) error {
+	raw, err := os.Create(rawFile)
+	if err != nil {
+		return err
+	}
+	defer raw.Close()
+	cmd := exec.Command(runner, args...)
+	out := io.MultiWriter(os.Stdout, raw)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
+}
+
+func loadTestResult(fileName string) (*inference.TestResult, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	result := &inference.TestResult{}
+	if err = json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func writeSweepResult(spec *Spec, sweep SweepResult) {
+	if dryRun {
+		return
+	}
+	sweep.EndTime = time.Now().Unix()
+	fileName := filepath.Join(spec.OutputDir, "SWEEP_"+spec.Name+".json")
+	data, err := json.MarshalIndent(sweep, "", " ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = ioutil.WriteFile(fileName, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Saved the results of %d runs to %s\n", len(sweep.Runs), fileName)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"testing"
+)
+
+func TestExpandMatrix(t *testing.T) {
+	tests := []struct {
+		name        string
+		matrix      string
+		constraints []string
+		want        []map[string]string
+		wantErr     bool
+	}{
+		{"single value", "workers: 8", nil, []map[string]string{{"workers": "8"}}, false},
+		{"cartesian product", "workers: [1, 2]\nbatch: [a, b]", nil, []map[string]string{
+			{"workers": "1", "batch": "a"},
+			{"workers": "1", "batch": "b"},
+			{"workers": "2", "batch": "a"},
+			{"workers": "2", "batch": "b"},
+		}, false},
+		{"constrained", "workers: [1, 4, 8]\nbatch: [2, 4]", []string{"workers >= batch"}, []map[string]string{
+			{"workers": "4", "batch": "2"},
+			{"workers": "4", "batch": "4"},
+			{"workers": "8", "batch": "2"},
+			{"workers": "8", "batch": "4"},
+		}, false},
+		{"nothing left", "workers: [1, 2]", []string{"workers > 2"}, []map[string]string{}, false},
+		{"empty", "", nil, []map[string]string{{}}, false},
+		{"invalid constraint", "workers: [1, 2]", []string{"workers >="}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var matrix yaml.MapSlice
+			if err := yaml.Unmarshal([]byte(tt.matrix), &matrix); err != nil {
+				t.Fatal(err)
+			}
+			got, err := expandMatrix(matrix, tt.constraints)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandMatrix() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandMatrix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeetsConstraints(t *testing.T) {
+	variation := map[string]string{"workers": "8", "batch": "4", "device": "cpu"}
+	tests := []struct {
+		name        string
+		constraints []string
+		want        bool
+		wantErr     bool
+	}{
+		{"no constraint", nil, true, false},
+		{"flags", []string{"workers >= batch"}, true, false},
+		{"number", []string{"batch < 4"}, false, false},
+		{"all of them", []string{"workers > batch", "batch <= 4", "workers == 8", "batch != 8"}, true, false},
+		{"one fails", []string{"workers > batch", "workers < batch"}, false, false},
+		{"float", []string{"batch > 3.5"}, true, false},
+		{"unknown operator", []string{"workers => batch"}, false, true},
+		{"missing operand", []string{"workers >="}, false, true},
+		{"not a number", []string{"device == 1"}, false, true},
+		{"unknown flag", []string{"threads > 1"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := meetsConstraints(variation, tt.constraints)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("meetsConstraints() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("meetsConstraints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
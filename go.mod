@@ -3,6 +3,7 @@ module github.com/RedisAI/aibench
 go 1.13
 
 require (
+	github.com/HdrHistogram/hdrhistogram-go v1.0.0
 	github.com/RedisAI/aibench/cmd/aibench_run_inference_tensorflow_serving/tensorflow v0.0.0-00010101000000-000000000000
 	github.com/RedisAI/aibench/cmd/aibench_run_inference_tensorflow_serving/tensorflow/core/lib/core v0.0.0-00010101000000-000000000000 // indirect
 	github.com/RedisAI/aibench/cmd/aibench_run_inference_tensorflow_serving/tensorflow_serving v0.0.0-00010101000000-000000000000
@@ -17,6 +18,7 @@ require (
 	github.com/mediocregopher/radix/v3 v3.5.2
 	github.com/valyala/fasthttp v1.15.1
 	google.golang.org/grpc v1.32.0
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 replace (
@@ -0,0 +1,153 @@
+package inference
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// agentRequestTimeout bounds each request to the coordinator, GET /start being a poll shorter than that
+	agentRequestTimeout = 30 * time.Second
+	// agentIntervalQueue is the number of reporting periods queued while the coordinator is slow to reply
+	agentIntervalQueue = 64
+)
+
+// agentClient runs the agent side of the coordinator protocol, see Coordinator
+type agentClient struct {
+	baseURL  string
+	id       string
+	client   *http.Client
+	index    int64
+	stopped  chan struct{}
+	stopOnce sync.Once
+	// intervals are sent in the background, so that a slow coordinator doesn't delay the reporting
+	intervals chan agentInterval
+	pending   sync.WaitGroup // pending counts the queued intervals not sent yet
+}
+
+// defaultAgentID identifies the agents by host name and process id
+func defaultAgentID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func newAgentClient(addr string, id string) *agentClient {
+	a := &agentClient{
+		baseURL:   "http://" + addr,
+		id:        id,
+		client:    &http.Client{Timeout: agentRequestTimeout},
+		stopped:   make(chan struct{}),
+		intervals: make(chan agentInterval, agentIntervalQueue),
+	}
+	go a.sendIntervals()
+	return a
+}
+
+func (a *agentClient) do(method string, path string, body interface{}, reply interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, a.baseURL+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
+
+// register joins the benchmark
+func (a *agentClient) register(workers uint) error {
+	return a.do(http.MethodPost, "/register", agentRegistration{ID: a.id, Workers: workers}, nil)
+}
+
+// waitStart blocks until every agent joined, and returns the common start time
+func (a *agentClient) waitStart() (time.Time, error) {
+	for {
+		var start agentStart
+		if err := a.do(http.MethodGet, "/start?id="+url.QueryEscape(a.id), nil, &start); err != nil {
+			return time.Time{}, err
+		}
+		if start.StartAt != 0 {
+			return time.Unix(0, start.StartAt), nil
+		}
+	}
+}
+
+// sendInterval queues the stats of a reporting period, sent in the background. It only fails
+// when the queue is full, the interval being dropped
+func (a *agentClient) sendInterval(from, to time.Time, inferences uint64, stats *statGroup, encodedHistogram []byte) error {
+	interval := agentInterval{
+		ID:               a.id,
+		Index:            a.index,
+		From:             from.UnixNano(),
+		To:               to.UnixNano(),
+		Inferences:       inferences,
+		Requests:         stats.count,
+		Errors:           stats.errorCount,
+		TimedOut:         stats.timedOutCount,
+		EncodedHistogram: encodedHistogram,
+	}
+	a.index++
+	a.pending.Add(1)
+	select {
+	case a.intervals <- interval:
+		return nil
+	default:
+		a.pending.Done()
+		return fmt.Errorf("%d reporting periods are already waiting for the coordinator, dropping period %d", agentIntervalQueue, interval.Index)
+	}
+}
+
+// sendIntervals sends the queued intervals in order. Once the coordinator replies the agent
+// should stop, the stopped channel is closed
+func (a *agentClient) sendIntervals() {
+	for interval := range a.intervals {
+		var reply agentIntervalReply
+		if err := a.do(http.MethodPost, "/interval", interval, &reply); err != nil {
+			fmt.Printf("Error sending the interval stats to the coordinator: %v\n", err)
+		} else if reply.Stop {
+			a.stopOnce.Do(func() { close(a.stopped) })
+		}
+		a.pending.Done()
+	}
+}
+
+// flushIntervals blocks until the queued intervals are sent
+func (a *agentClient) flushIntervals() {
+	a.pending.Wait()
+}
+
+// sendDone sends the agent results, with its overall latency histogram, once the queued intervals
+// are sent. The per tick stats are left out, the coordinator merging the interval histograms it
+// was sent instead. No interval can be sent afterwards
+func (a *agentClient) sendDone(result TestResult, encodedHistogram []byte) error {
+	a.flushIntervals()
+	close(a.intervals)
+	result.ClientRunTimeStats = nil
+	result.ServerRunTimeStats = nil
+	result.ServerProcessStats = nil
+	result.ClientProcessStats = nil
+	return a.do(http.MethodPost, "/done", agentDone{ID: a.id, EncodedHistogram: encodedHistogram, Result: result}, nil)
+}
@@ -0,0 +1,75 @@
+package inference
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	arrivalConstant = "constant"
+	arrivalPoisson  = "poisson"
+)
+
+// arrivalSchedule hands out the intended send times of an open-loop benchmark.
+// The schedule is shared by all workers and does not depend on how fast the
+// server replies, so that a stalled server shows up as queueing delay instead
+// of as a lower request rate (coordinated omission).
+type arrivalSchedule struct {
+	mu           sync.Mutex
+	next         time.Time
+	rps          float64
+	distribution string
+}
+
+// newArrivalSchedule returns a schedule starting at start that issues rps inferences per second
+// with the given inter-arrival distribution
+func newArrivalSchedule(start time.Time, rps uint64, distribution string) (*arrivalSchedule, error) {
+	if rps == 0 {
+		return nil, fmt.Errorf("open-loop mode requires a request rate")
+	}
+	if distribution != arrivalConstant && distribution != arrivalPoisson {
+		return nil, fmt.Errorf("unknown arrival distribution %q, expected %s or %s", distribution, arrivalConstant, arrivalPoisson)
+	}
+	return &arrivalSchedule{
+		next:         start,
+		rps:          float64(rps),
+		distribution: distribution,
+	}, nil
+}
+
+// nextArrival returns the intended send time of the next request carrying
+// n inferences and advances the schedule past it
+func (a *arrivalSchedule) nextArrival(n int64) time.Time {
+	a.mu.Lock()
+	interval := float64(n) / a.rps
+	if a.distribution == arrivalPoisson {
+		interval *= rand.ExpFloat64()
+	}
+	intended := a.next
+	a.next = a.next.Add(time.Duration(interval * float64(time.Second)))
+	a.mu.Unlock()
+	return intended
+}
+
+// restart makes the schedule issue rps inferences per second from start on,
+// dropping any backlog of arrivals that are still due
+func (a *arrivalSchedule) restart(start time.Time, rps float64) {
+	a.mu.Lock()
+	a.next = start
+	a.rps = rps
+	a.mu.Unlock()
+}
+
+// setRate changes the rate of the arrivals scheduled from now on. A backlog of arrivals
+// that are still due is kept, while arrivals scheduled in the future at the previous rate are dropped
+func (a *arrivalSchedule) setRate(rps float64) {
+	now := time.Now()
+	a.mu.Lock()
+	a.rps = rps
+	if a.next.After(now) {
+		a.next = now
+	}
+	a.mu.Unlock()
+}
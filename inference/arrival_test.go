@@ -0,0 +1,50 @@
+package inference
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArrivalScheduleConstant(t *testing.T) {
+	start := time.Now()
+	schedule, err := newArrivalSchedule(start, 100, arrivalConstant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		expected := start.Add(time.Duration(i) * 10 * time.Millisecond)
+		if got := schedule.nextArrival(1); !got.Equal(expected) {
+			t.Errorf("arrival %d: expected %v, got %v", i, expected, got)
+		}
+	}
+	// a row with 4 inferences takes 4 slots
+	next := schedule.nextArrival(4)
+	if got := schedule.nextArrival(1).Sub(next); got != 40*time.Millisecond {
+		t.Errorf("expected 40ms between arrivals, got %v", got)
+	}
+}
+
+func TestArrivalSchedulePoissonMeanRate(t *testing.T) {
+	start := time.Now()
+	schedule, err := newArrivalSchedule(start, 1000, arrivalPoisson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last time.Time
+	for i := 0; i < 10000; i++ {
+		last = schedule.nextArrival(1)
+	}
+	// 10000 arrivals at 1000 rps should span roughly 10 seconds
+	if span := last.Sub(start); span < 9*time.Second || span > 11*time.Second {
+		t.Errorf("expected arrivals to span about 10s, got %v", span)
+	}
+}
+
+func TestArrivalScheduleInvalid(t *testing.T) {
+	if _, err := newArrivalSchedule(time.Now(), 0, arrivalConstant); err == nil {
+		t.Errorf("expected an error for a zero rate")
+	}
+	if _, err := newArrivalSchedule(time.Now(), 10, "uniform"); err == nil {
+		t.Errorf("expected an error for an unknown distribution")
+	}
+}
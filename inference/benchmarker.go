@@ -2,15 +2,18 @@ package inference
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/HdrHistogram/hdrhistogram-go"
 	"golang.org/x/time/rate"
+	"io"
 	"io/ioutil"
 	"log"
 	"math"
 	"math/rand"
+	"net/http"
 	"os"
 	"runtime/pprof"
 	"strings"
@@ -23,6 +26,9 @@ const (
 	labelAllQueries = "All queries"
 	defaultReadSize = 4 << 20 // 4 MB
 	Inf             = rate.Limit(math.MaxFloat64)
+
+	// minRequestsForErrorRate is the number of requests a positive -max-error-rate is checked after
+	minRequestsForErrorRate = 100
 )
 
 // LoadRunner contains the common components for running a inference benchmarking
@@ -38,15 +44,40 @@ type BenchmarkRunner struct {
 	repetitions                        uint
 	printResponses                     bool
 	ignoreErrors                       bool
+	maxErrorRate                       float64
+	openLoop                           bool
+	arrivalDistribution                string
 	debug                              int
 	enableReferenceDataRedis           bool
 	fileName                           string
 	seed                               int64
 	reportingPeriod                    time.Duration
+	testTime                           time.Duration
+	requestTimeout                     time.Duration
+	sloLatency                         time.Duration
+	sloQuantile                        float64
+	sloSearchMinRps                    uint64
+	sloSearchMaxRps                    uint64
+	sloSearchPrecision                 uint64
+	sloSearchStepTime                  time.Duration
+	rateProfile                        string
 	outputFileStatsResponseLatencyHist string
+	metricsListenAddr                  string
+	hdrLogFile                         string
+	configFile                         string
+	testDescription                    string
+	coordinatorAddr                    string
+	agentID                            string
+	serverPid                          int
+	serverProcessName                  string
+	goldenFile                         string
+	goldenOutFile                      string
+	goldenMode                         string
+	goldenTolerance                    float64
 
 	// non-flag fields
 	br      *bufio.Reader
+	input   *os.File
 	sp      *statProcessor
 	scanner *producer
 	ch      chan []byte
@@ -57,7 +88,53 @@ type BenchmarkRunner struct {
 	// inferences excluding the warmup
 	benchInferenceCount uint64
 
+	// requests sent, and requests that failed, checked against -max-error-rate
+	requestCount uint64
+	errorCount   uint64
+
+	// request and response bytes, as reported by the processors
+	bytesSent     uint64
+	bytesReceived uint64
+
+	// set once the run was aborted because of the errors, see abortOnErrors
+	abortOnce   sync.Once
+	abortReason string
+
+	// set to 1 once the run was stopped by a signal
+	interrupted int32
+
+	// stops listening for signals, set once they are handled, see handleInterrupts
+	stopSignals func()
+
+	// load profile stage being run, tagged on the client run time stats
+	currentStage atomic.Value
+
+	// closed and replaced on every target rate change, see setTargetRate
+	rateChangedMu sync.Mutex
+	rateChanged   chan struct{}
+
+	// model outputs validation, set on -golden-file or -golden-out-file
+	validator *outputValidator
+
+	// client metrics exposed on -metrics-listen-addr
+	liveMetrics *liveMetrics
+
+	// interval histograms log, written on each reporting period when -hdr-log is set
+	hdrLog *hdrLog
+
+	// resolved value of every flag, after applying the -config file, see ParseFlags
+	config map[string]interface{}
+
+	// distributed benchmark agent, set on -coordinator-addr
+	agent *agentClient
+
+	// target servers info, by server address, and models, see SetServerInfo and AddModelConfig
+	serverInfoMu sync.Mutex
+	serverInfo   map[string]interface{}
+	models       []ModelConfig
+
 	testResult           TestResult
+	clientRunTimeStatsMu sync.Mutex
 	JsonOutFile          string
 	MetadataAutobatching int64
 }
@@ -65,31 +142,97 @@ type BenchmarkRunner struct {
 // NewLoadRunner creates a new instance of LoadRunner which is
 // common functionality to be used by inference benchmarker programs
 func NewBenchmarkRunner() *BenchmarkRunner {
-	runner := &BenchmarkRunner{}
+	runner := &BenchmarkRunner{liveMetrics: newLiveMetrics()}
 	runner.scanner = newScanner(&runner.limit)
 	runner.sp = &statProcessor{
 		limit: &runner.limit,
 	}
 	flag.Uint64Var(&runner.sp.burnIn, "burn-in", 0, "Number of queries to ignore before collecting statistics.")
+	flag.BoolVar(&runner.sp.perWorkerStats, "per-worker-stats", false, "Keep latency and throughput stats per worker, and report the skew among workers (default false).")
+	flag.BoolVar(&runner.sp.perHostStats, "per-host-stats", false, "Keep latency and throughput stats per target host, for the runners that report it, and report the skew among hosts (default false).")
 	flag.Uint64Var(&runner.limit, "max-queries", 0, "Limit the number of queries to send, 0 = no limit")
+	flag.DurationVar(&runner.testTime, "test-time", 0, "Run the benchmark for this amount of time, looping over the input file if required. 0 = stop at the end of the input file")
+	flag.DurationVar(&runner.requestTimeout, "request-timeout", 0, "Deadline of each request, after which it is counted as timed out. 0 keeps each runner default.")
 	flag.StringVar(&runner.memProfile, "memprofile", "", "Write a memory profile to this file.")
 	flag.StringVar(&runner.cpuProfile, "cpuprofile", "", "Write a cpu profile to this file.")
 	flag.Uint64Var(&runner.limitrps, "limit-rps", 0, "Limit overall RPS. 0 disables limit.")
+	flag.BoolVar(&runner.openLoop, "open-loop", false, "Send each request at its intended time given by -limit-rps, whether or not previous replies arrived, and measure latency from that intended time (corrects coordinated omission). Requires -limit-rps (default false).")
+	flag.StringVar(&runner.arrivalDistribution, "arrival-distribution", arrivalConstant, "Open-loop inter-arrival time distribution, one of: constant, poisson.")
+	flag.DurationVar(&runner.sloLatency, "slo-latency", 0, "Search the max rate whose -slo-quantile latency stays under this value, by binary searching -limit-rps over repeated sub-runs. 0 disables the search.")
+	flag.Float64Var(&runner.sloQuantile, "slo-quantile", 99.0, "Latency quantile (0-100) checked against -slo-latency.")
+	flag.Uint64Var(&runner.sloSearchMinRps, "slo-search-min-rps", 1, "Lower bound of the max rate under SLO search.")
+	flag.Uint64Var(&runner.sloSearchMaxRps, "slo-search-max-rps", 100000, "Upper bound of the max rate under SLO search.")
+	flag.Uint64Var(&runner.sloSearchPrecision, "slo-search-precision", 10, "Stop the max rate under SLO search once the searched interval is this narrow (in RPS).")
+	flag.DurationVar(&runner.sloSearchStepTime, "slo-search-step-time", 10*time.Second, "Duration of each sub-run of the max rate under SLO search.")
+	flag.StringVar(&runner.rateProfile, "rate-profile", "", "Load profile driving the request rate, as a comma separated list of stages [NAME=]TYPE:ARGS. Types: constant:RPS:DURATION, ramp:FROM_RPS:TO_RPS:DURATION, steps:FROM_RPS:STEP_RPS:STEP_DURATION:COUNT, spike:BASE_RPS:SPIKE_RPS:SPIKE_DURATION:DURATION. The run ends with the last stage.")
 	flag.UintVar(&runner.workers, "workers", 8, "Number of concurrent requests to make.")
 	flag.BoolVar(&runner.printResponses, "print-responses", false, "Pretty print response bodies for correctness checking (default false).")
-	flag.BoolVar(&runner.ignoreErrors, "ignore-errors", false, "Whether to ignore the inference errors and continue. By default on error the benchmark stops (default false).")
+	flag.BoolVar(&runner.ignoreErrors, "ignore-errors", false, "Whether to ignore the inference errors and continue. By default on error the benchmark stops (default false). Same as -max-error-rate=1.")
+	flag.Float64Var(&runner.maxErrorRate, "max-error-rate", 0, fmt.Sprintf("Stop the benchmark once the fraction (0-1) of failed requests exceeds this value, checked after %d requests when positive. 0 stops on the first error.", minRequestsForErrorRate))
 	flag.BoolVar(&runner.enableReferenceDataRedis, "enable-reference-data-redis", false, "Whether to enable benchmarking inference with a model with reference data on Redis or not (default false).")
 	flag.IntVar(&runner.debug, "debug", 0, "Whether to print debug messages.")
 	flag.Int64Var(&runner.seed, "seed", 0, "PRNG seed (default, or 0, uses the current timestamp).")
 	flag.StringVar(&runner.fileName, "file", "", "File name to read queries from")
 	flag.DurationVar(&runner.reportingPeriod, "reporting-period", 1*time.Second, "Period to report write stats")
+	flag.StringVar(&runner.metricsListenAddr, "metrics-listen-addr", "", "Address (host:port) to expose the live client metrics on, in the Prometheus text format at /metrics. Empty disables it.")
 	flag.StringVar(&runner.JsonOutFile, "json-out-file", "", "Name of json output file to output benchmark results. If not set, will not print to json.")
 	flag.Int64Var(&runner.MetadataAutobatching, "metadata-autobatching", -1, "Metadata string containing autobatching on the server side info.")
 	flag.StringVar(&runner.outputFileStatsResponseLatencyHist, "output-file-stats-hdr-response-latency-hist", "", "File name to output the hdr response latency histogram to")
+	registerConfigFlag(&runner.configFile)
+	flag.StringVar(&runner.coordinatorAddr, "coordinator-addr", "", "Address (host:port) of the aibench_coordinator of a distributed benchmark. When set, the runner waits for the other agents to start, "+
+		"sends the stats of each -reporting-period to the coordinator, and stops once any agent is done.")
+	flag.StringVar(&runner.agentID, "agent-id", defaultAgentID(), "Name of this runner among the agents of a distributed benchmark.")
+	flag.StringVar(&runner.testDescription, "test-description", "", "Free text description of the benchmark, saved on the json output file.")
+	flag.IntVar(&runner.serverPid, "server-pid", 0, "Pid of the model server process, when running on the same host, whose resource usage (CPU, RSS, threads and context switches) is sampled out of /proc on each -reporting-period, added up with the one of its child processes, e.g. the TorchServe or Flask workers. 0 disables it.")
+	flag.StringVar(&runner.serverProcessName, "server-process-name", "", "Name of the model server process, when running on the same host, looked up on /proc instead of -server-pid, e.g. redis-server or tensorflow_model_server.")
+	flag.StringVar(&runner.goldenFile, "golden-file", "", "File with the expected model outputs of the -file rows, one line of comma separated values per row, in order (see -golden-out-file). "+
+		"When set, the outputs are validated and the mismatches reported. Empty lines are rows without an expected output.")
+	flag.StringVar(&runner.goldenOutFile, "golden-out-file", "", "File name to write the model outputs of this run to, as a -golden-file, e.g. on a reference run.")
+	flag.StringVar(&runner.goldenMode, "golden-mode", GoldenModeTop1, fmt.Sprintf("How the outputs are compared to the golden ones: '%s' compares the top-1 class of each inference, '%s' each value, within -golden-tolerance. "+
+		"The golden files holding labelled classes, e.g. written by aibench_generate_data, are compared as '%s', checking the model accuracy.", GoldenModeTop1, GoldenModeTensor, GoldenModeLabels))
+	flag.Float64Var(&runner.goldenTolerance, "golden-tolerance", 1e-4, "Max absolute difference of each output value on -golden-mode=tensor.")
+	flag.StringVar(&runner.hdrLogFile, "hdr-log", "", "File name to write the HdrHistogram interval log to, with one interval histogram per -reporting-period. Latencies are recorded in microseconds.")
 
 	return runner
 }
 
+// ParseFlags parses the command line flags, setting the ones not given on it from the -config file.
+// Runners call it instead of flag.Parse
+func (b *BenchmarkRunner) ParseFlags() {
+	b.config = parseFlags(&b.configFile)
+	b.handleInterrupts()
+}
+
+// handleInterrupts makes the first SIGINT or SIGTERM stop the benchmark gracefully, still writing the results.
+// Signals are handled from the runner startup on, so that one received before the run, e.g. while the
+// runner sets up its model, makes the run stop right away instead of killing the runner
+func (b *BenchmarkRunner) handleInterrupts() {
+	if b.stopSignals != nil {
+		return
+	}
+	b.stopSignals = notifyOnInterrupt(func(os.Signal) {
+		atomic.StoreInt32(&b.interrupted, 1)
+		b.scanner.stop()
+	})
+}
+
+// SetServerInfo records the info (e.g. version) of the target server at addr, saved on the json output file
+func (b *BenchmarkRunner) SetServerInfo(addr string, info map[string]interface{}) {
+	b.serverInfoMu.Lock()
+	defer b.serverInfoMu.Unlock()
+	if b.serverInfo == nil {
+		b.serverInfo = map[string]interface{}{}
+	}
+	b.serverInfo[addr] = info
+}
+
+// AddModelConfig records a model set on a target server, saved on the json output file
+func (b *BenchmarkRunner) AddModelConfig(model ModelConfig) {
+	b.serverInfoMu.Lock()
+	defer b.serverInfoMu.Unlock()
+	b.models = append(b.models, model)
+}
+
 // SetLimit changes the number of queries to run, with 0 being all of them
 func (b *BenchmarkRunner) SetLimit(limit uint64) {
 	b.limit = limit
@@ -100,6 +243,11 @@ func (b *BenchmarkRunner) DoPrintResponses() bool {
 	return b.printResponses
 }
 
+// Workers returns the number of concurrent workers
+func (b *BenchmarkRunner) Workers() uint {
+	return b.workers
+}
+
 // DebugLevel returns the level of debug messages for this benchmark
 func (b *BenchmarkRunner) DebugLevel() int {
 	return b.debug
@@ -114,10 +262,51 @@ func (b *BenchmarkRunner) IgnoreErrors() bool {
 	return b.ignoreErrors
 }
 
+// SetIgnoreErrors changes whether the inference errors stop the benchmark
+func (b *BenchmarkRunner) SetIgnoreErrors(ignoreErrors bool) {
+	b.ignoreErrors = ignoreErrors
+}
+
+// SetPerHostStats enables the per target host stats, as -per-host-stats does, e.g. for the runners
+// sharding the requests among several hosts
+func (b *BenchmarkRunner) SetPerHostStats(perHostStats bool) {
+	b.sp.perHostStats = perHostStats
+}
+
+// SetHosts declares the target hosts of the runner, so that the per host stats also account
+// for the hosts no inference reached
+func (b *BenchmarkRunner) SetHosts(hosts []string) {
+	b.sp.hosts = hosts
+}
+
+// InferenceCount returns the number of inferences issued so far
+func (b *BenchmarkRunner) InferenceCount() uint64 {
+	return atomic.LoadUint64(&b.inferenceCount)
+}
+
 func (b *BenchmarkRunner) UseReferenceDataRedis() bool {
 	return b.enableReferenceDataRedis
 }
 
+// KeepOutputs tells whether the processors should decode the model outputs and set them on their
+// stats, see Stat.SetOutput, for the -golden-file validation or the -golden-out-file recording
+func (b *BenchmarkRunner) KeepOutputs() bool {
+	return len(b.goldenFile) > 0 || len(b.goldenOutFile) > 0
+}
+
+// RequestTimeout returns the deadline of each request, 0 meaning the runner default
+func (b *BenchmarkRunner) RequestTimeout() time.Duration {
+	return b.requestTimeout
+}
+
+// RequestContext returns the context of a single request, with a deadline when -request-timeout is set
+func (b *BenchmarkRunner) RequestContext() (context.Context, context.CancelFunc) {
+	if b.requestTimeout > 0 {
+		return context.WithTimeout(context.Background(), b.requestTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
 // LoaderCreate is a function that creates a new Loader (called in Run)
 type ProcessorCreate func() Processor
 
@@ -130,12 +319,14 @@ type MetricCollector interface {
 	CollectRunTimeMetrics() (int64, interface{}, error)
 }
 
-// Processor is an interface that handles the setup of a inference processing worker and executes queries one at a time
+// Processor is an interface that handles the setup of a inference processing worker and executes queries one at a time.
+// New runners should implement ProcessorV2 instead, Processors are run through AdaptProcessor
 type Processor interface {
 	// Init initializes at global state for the Loader, possibly based on its worker number / ID
 	Init(workerNum int, totalWorkers int, wg *sync.WaitGroup, m chan uint64, rs chan uint64)
 
-	// ProcessInferenceQuery handles a given inference and reports its stats
+	// ProcessInferenceQuery handles a given inference and reports its stats.
+	// Requests that exceed their deadline are reported as timed out stats, see Stat.Init
 	ProcessInferenceQuery(q []byte, isWarm bool, workerNum int, useReferenceDataRedis bool, useReferenceDataMysql bool, queryNumber int64) ([]*Stat, error)
 
 	// Close forces any work buffered to be sent to the DB being tested prior to going further
@@ -151,20 +342,35 @@ func (b *BenchmarkRunner) GetBufferedReader() *bufio.Reader {
 			if err != nil {
 				panic(fmt.Sprintf("cannot open file for read %s: %v", b.fileName, err))
 			}
-			b.br = bufio.NewReader(file)
-			//bufio.
+			b.input = file
 		} else {
 			// Read from STDIN
-			b.br = bufio.NewReader(os.Stdin)
+			b.input = os.Stdin
 		}
+		b.br = bufio.NewReader(b.input)
 	}
 	return b.br
 }
 
+// rewindInput restarts reading the input from its beginning. It only
+// succeeds when the input is seekable, i.e. a file and not a pipe
+func (b *BenchmarkRunner) rewindInput() (io.Reader, error) {
+	if _, err := b.input.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	b.br.Reset(b.input)
+	return b.br, nil
+}
+
 // Run does the bulk of the benchmark execution.
 // It launches a gorountine to track stats, creates workers to process queries,
 // read in the input, execute the queries, and then does cleanup.
 func (b *BenchmarkRunner) Run(queryPool *sync.Pool, processorCreateFn ProcessorCreate, rowSizeBytes int, inferencesPerRow int64, metricCollectorFn MetricCollectorCreate) {
+	b.RunV2(queryPool, func() ProcessorV2 { return AdaptProcessor(processorCreateFn()) }, rowSizeBytes, inferencesPerRow, metricCollectorFn)
+}
+
+// RunV2 is Run for processors implementing ProcessorV2
+func (b *BenchmarkRunner) RunV2(queryPool *sync.Pool, processorCreateFn ProcessorV2Create, rowSizeBytes int, inferencesPerRow int64, metricCollectorFn MetricCollectorCreate) {
 
 	if b.cpuProfile != "" {
 		fmt.Printf("starting cpu profile. Saving into :%s", b.cpuProfile)
@@ -180,6 +386,7 @@ func (b *BenchmarkRunner) Run(queryPool *sync.Pool, processorCreateFn ProcessorC
 	}
 
 	rand.Seed(b.seed)
+	b.handleInterrupts()
 
 	if b.workers == 0 {
 		panic("must have at least one worker")
@@ -187,51 +394,198 @@ func (b *BenchmarkRunner) Run(queryPool *sync.Pool, processorCreateFn ProcessorC
 	if b.sp.burnIn > b.limit && b.limit > 0 {
 		panic("burn-in is larger than limit")
 	}
+	if len(b.hdrLogFile) > 0 && b.reportingPeriod <= 0 {
+		panic("hdr-log requires a positive reporting-period")
+	}
+	if len(b.coordinatorAddr) > 0 && b.reportingPeriod <= 0 {
+		panic("coordinator-addr requires a positive reporting-period")
+	}
+	sloSearch := b.sloLatency > 0
+	// the SLO search and the load profile drive the rate themselves
+	targetRps := b.limitrps
+	if sloSearch {
+		if b.sloSearchMinRps == 0 || b.sloSearchMinRps > b.sloSearchMaxRps {
+			panic("slo-search-min-rps must be positive and not larger than slo-search-max-rps")
+		}
+		targetRps = b.sloSearchMinRps
+	}
+	var rateStages []rateStage
+	if len(b.rateProfile) > 0 {
+		if sloSearch {
+			panic("rate-profile and slo-latency can't be used together")
+		}
+		var err error
+		rateStages, err = parseRateProfile(b.rateProfile)
+		if err != nil {
+			panic(err)
+		}
+		// the actual rate is set when the first stage starts
+		targetRps = 1
+	}
 	b.ch = make(chan []byte, b.workers)
 
+	serverProcess, clientProcess := b.newProcessSamplers()
+
+	if b.KeepOutputs() {
+		// rows are matched to their golden outputs by reading the input file again
+		if len(b.fileName) == 0 {
+			panic("golden-file and golden-out-file require an input -file")
+		}
+		var err error
+		b.validator, err = newOutputValidator(b.fileName, rowSizeBytes, inferencesPerRow, b.goldenFile, b.goldenMode, b.goldenTolerance, len(b.goldenOutFile) > 0)
+		if err != nil {
+			log.Fatalf("Error reading the golden outputs: %v", err)
+		}
+	}
+
+	if len(b.coordinatorAddr) > 0 {
+		b.agent = newAgentClient(b.coordinatorAddr, b.agentID)
+		if err := b.agent.register(b.workers); err != nil {
+			log.Fatalf("Error registering on the coordinator %s: %v", b.coordinatorAddr, err)
+		}
+		fmt.Printf("Registered as agent %s on the coordinator %s, waiting for the other agents\n", b.agentID, b.coordinatorAddr)
+		startAt, err := b.agent.waitStart()
+		if err != nil {
+			log.Fatalf("Error waiting for the coordinator %s to start: %v", b.coordinatorAddr, err)
+		}
+		time.Sleep(time.Until(startAt))
+	}
+
+	var schedule *arrivalSchedule
+	if b.openLoop {
+		var err error
+		schedule, err = newArrivalSchedule(time.Now(), targetRps, b.arrivalDistribution)
+		if err != nil {
+			panic(err)
+		}
+		b.sp.openLoop = true
+	}
+
+	var metricsServer *http.Server
+	if len(b.metricsListenAddr) > 0 {
+		metricsServer = b.serveMetrics(b.metricsListenAddr)
+	}
+
 	// Launch the stats processor:
-	go b.sp.process(b.workers, true)
+	b.sp.start(b.workers, true)
 
 	// Launch inference processors
 
 	var requestRate = Inf
 	var requestBurst = 1
-	if b.limitrps != 0 {
-		requestRate = rate.Limit(b.limitrps)
+	if targetRps != 0 {
+		requestRate = rate.Limit(targetRps)
 		requestBurst = 1 //int(b.workers)
 	}
 	var rateLimiter = rate.NewLimiter(requestRate, requestBurst)
 
-	var wg sync.WaitGroup
+	var wg, initWg sync.WaitGroup
 	for i := 0; i < int(b.workers); i++ {
 		wg.Add(1)
-		go b.processorHandler(rateLimiter, &wg, queryPool, processorCreateFn(), i, inferencesPerRow, b.limitrps != 0)
+		initWg.Add(1)
+		go b.processorHandler(rateLimiter, schedule, &wg, &initWg, queryPool, processorCreateFn(), i, inferencesPerRow, targetRps != 0)
+	}
+	// the open-loop schedule starts once every processor is initialized, so that the arrivals
+	// due while connecting to the server do not show as queueing delay
+	initWg.Wait()
+	if schedule != nil {
+		schedule.restart(time.Now(), float64(targetRps))
 	}
 	b.testResult.ServerRunTimeStats = make(map[int64]interface{})
 	b.testResult.ClientRunTimeStats = make(map[int64]interface{})
+	if serverProcess != nil {
+		b.testResult.ServerProcessStats = make(map[int64]interface{})
+	}
+	if clientProcess != nil {
+		b.testResult.ClientProcessStats = make(map[int64]interface{})
+	}
 
 	// Read in jobs, closing the job channel when done:
 	// Wall clock start time
 	wallStart := time.Now()
 
-	// Start background reporting process
+	// Start background reporting process.
+	// Both reporters are stopped before the results are finalized
+	// so that the per tick stats maps are no longer written to
+	if len(b.hdrLogFile) > 0 {
+		var err error
+		b.hdrLog, err = newHdrLog(b.hdrLogFile, wallStart)
+		if err != nil {
+			log.Fatalf("Error creating the hdr log %s: %v", b.hdrLogFile, err)
+		}
+		_, _ = fmt.Printf("Writing the HdrHistogram interval log to %s\n", b.hdrLogFile)
+	}
+	reportingDone := make(chan struct{})
+	var reportingWg sync.WaitGroup
 	if b.reportingPeriod.Nanoseconds() > 0 {
-		go b.report(b.reportingPeriod, wallStart, b.testResult.ClientRunTimeStats)
+		reportingWg.Add(1)
+		go b.report(b.reportingPeriod, wallStart, b.testResult.ClientRunTimeStats, reportingDone, &reportingWg)
 	}
 
 	if metricCollectorFn != nil {
-		go b.collectRunTimeStats(b.reportingPeriod, metricCollectorFn(), b.testResult.ServerRunTimeStats)
+		reportingWg.Add(1)
+		go collectRunTimeStats(b.reportingPeriod, metricCollectorFn(), b.testResult.ServerRunTimeStats, b.IgnoreErrors(), reportingDone, &reportingWg)
+	}
+	if serverProcess != nil {
+		reportingWg.Add(1)
+		go collectRunTimeStats(b.reportingPeriod, serverProcess, b.testResult.ServerProcessStats, b.IgnoreErrors(), reportingDone, &reportingWg)
+	}
+	if clientProcess != nil {
+		reportingWg.Add(1)
+		go collectRunTimeStats(b.reportingPeriod, clientProcess, b.testResult.ClientProcessStats, b.IgnoreErrors(), reportingDone, &reportingWg)
 	}
 
 	br := b.scanner.setReader(b.GetBufferedReader())
+	if b.testTime > 0 {
+		fmt.Printf("Running the benchmark for %v\n", b.testTime)
+		br.setDeadline(wallStart.Add(b.testTime)).setRewind(b.rewindInput)
+	}
+	sloSearchResult := make(chan *SloSearchResult, 1)
+	produceDone := make(chan struct{})
+	if sloSearch {
+		// keep producing until the search is over
+		br.setRewind(b.rewindInput)
+		go func() {
+			sloSearchResult <- b.searchMaxRate(rateLimiter, schedule, inferencesPerRow, produceDone)
+			br.stop()
+		}()
+	}
+	waitRateProfile := func() {}
+	if rateStages != nil {
+		br.setRewind(b.rewindInput)
+		waitRateProfile = b.startRateProfile(rateStages, rateLimiter, schedule, inferencesPerRow, produceDone, br.stop)
+	}
+	if b.agent != nil {
+		// stop together with the other agents
+		go func() {
+			select {
+			case <-b.agent.stopped:
+				br.stop()
+			case <-produceDone:
+			}
+		}()
+	}
 	totalRows := br.produce(queryPool, b.ch, rowSizeBytes, inferencesPerRow, b.debug)
 	_, err := fmt.Printf("Read a total of :%d rows\n", totalRows)
 
 	close(b.ch)
+	close(produceDone)
+	if sloSearch {
+		b.testResult.SloSearch = <-sloSearchResult
+	}
+	waitRateProfile()
 
 	// Block for workers to finish sending requests, closing the stats channel when done:
 	wg.Wait()
 	b.sp.CloseAndWait()
+	close(reportingDone)
+	reportingWg.Wait()
+	if b.hdrLog != nil {
+		if err := b.hdrLog.close(); err != nil {
+			log.Fatalf("Error writing the hdr log %s: %v", b.hdrLogFile, err)
+		}
+	}
+	b.stopSignals()
 
 	// Wall clock end time
 	wallEnd := time.Now()
@@ -247,10 +601,80 @@ func (b *BenchmarkRunner) Run(queryPool *sync.Pool, processorCreateFn ProcessorC
 	allOpsCount := atomic.LoadUint64(&b.inferenceCount)
 	b.testResult.OverallRatesIncludingWarmup = b.GetOverallRatesMap(allOpsCount, wallTook)
 	b.testResult.OverallQuantiles = b.GetOverallQuantiles(b.sp.StatsMapping[labelAllQueries].latencyHDRHistogram)
+	b.addPhaseQuantiles(b.testResult.OverallQuantiles, b.sp.StatsMapping[labelAllQueries])
+	if b.openLoop {
+		b.addUncorrectedQuantiles(b.testResult.OverallQuantiles, b.sp.StatsMapping[labelAllQueries].uncorrectedLatencyHDRHistogram)
+		b.testResult.ArrivalDistribution = b.arrivalDistribution
+	}
+	b.testResult.OpenLoop = b.openLoop
+	b.testResult.Interrupted = atomic.LoadInt32(&b.interrupted) != 0
+	if b.testResult.Interrupted {
+		fmt.Printf("Benchmark interrupted, results are partial\n")
+	}
+	allQueries := b.sp.StatsMapping[labelAllQueries]
+	errorsByLabel := make(map[string]interface{})
+	for label, statGroup := range b.sp.StatsMapping {
+		if label != labelAllQueries && statGroup.errorCount > 0 {
+			errorsByLabel[label] = statGroup.errorCountsByKind()
+		}
+	}
+	b.testResult.Totals = map[string]interface{}{
+		"Requests":      allQueries.count,
+		"Successes":     allQueries.successCount(),
+		"TimedOut":      allQueries.timedOutCount,
+		"Errors":        allQueries.errorCount,
+		"ErrorRate":     allQueries.errorRate(),
+		"ErrorsByKind":  allQueries.errorCountsByKind(),
+		"ErrorsByLabel": errorsByLabel,
+		"BytesSent":     atomic.LoadUint64(&b.bytesSent),
+		"BytesReceived": atomic.LoadUint64(&b.bytesReceived),
+	}
+	b.testResult.Aborted = len(b.abortReason) > 0
+	b.testResult.AbortReason = b.abortReason
+	b.testResult.MaxErrorRate = b.maxErrorRate
+	if b.config == nil {
+		b.config = resolvedFlags(flag.CommandLine)
+	}
+	b.testResult.DBSpecificConfigs = b.config
+	b.testResult.ResultFormatVersion = ResultFormatVersion
+	b.testResult.TestDescription = b.testDescription
+	b.testResult.GitSHA1 = GitSHA1
+	b.testResult.GitDirty = gitDirty()
+	b.testResult.CommandLine = os.Args
+	b.testResult.ClientHost = getClientHostInfo()
+	b.serverInfoMu.Lock()
+	b.testResult.ServerInfo = b.serverInfo
+	b.testResult.Models = b.models
+	b.serverInfoMu.Unlock()
+	b.testResult.Skew = b.sp.Skew
+	if b.validator != nil {
+		b.testResult.Validation = b.validator.result(b.goldenFile)
+		if v := b.testResult.Validation; v != nil && v.Mode == GoldenModeLabels {
+			fmt.Printf("Checked the accuracy of %d inferences against the labels of %s: %d mismatches, accuracy %.4f, %d not checked\n", v.Validated, v.GoldenFile, v.Mismatches, v.Accuracy, v.Unvalidated)
+		} else if v != nil {
+			fmt.Printf("Validated %d inferences against %s (%s): %d mismatches, accuracy %.4f, %d not validated\n", v.Validated, v.GoldenFile, v.Mode, v.Mismatches, v.Accuracy, v.Unvalidated)
+		}
+		if len(b.goldenOutFile) > 0 {
+			recorded, err := b.validator.writeGolden(b.fileName, rowSizeBytes, b.goldenOutFile)
+			if err != nil {
+				log.Fatalf("Error writing the golden outputs to %s: %v", b.goldenOutFile, err)
+			}
+			fmt.Printf("Saved the outputs of %d rows to %s\n", recorded, b.goldenOutFile)
+		}
+	}
+	b.testResult.RequestTimeoutMillis = b.requestTimeout.Milliseconds()
 	b.testResult.Limit = b.limit
+	b.testResult.TestTimeMillis = b.testTime.Milliseconds()
 	b.testResult.Workers = b.workers
 	b.testResult.MaxRps = b.limitrps
 
+	if b.agent != nil {
+		encodedHist, _ := b.testResult.OverallQuantiles["EncodedHistogram"].([]byte)
+		if err := b.agent.sendDone(b.testResult, encodedHist); err != nil {
+			log.Printf("Error sending the results to the coordinator %s: %v", b.coordinatorAddr, err)
+		}
+	}
+
 	if strings.Compare(b.JsonOutFile, "") != 0 {
 		_, _ = fmt.Printf("Saving JSON results to %s\n", b.JsonOutFile)
 		file, err := json.MarshalIndent(b.testResult, "", " ")
@@ -268,6 +692,9 @@ func (b *BenchmarkRunner) Run(queryPool *sync.Pool, processorCreateFn ProcessorC
 	if err != nil {
 		log.Fatal(err)
 	}
+	if allQueries.errorCount > 0 {
+		fmt.Printf("%d inference errors (%.2f%% of the requests): %v\n", allQueries.errorCount, allQueries.errorRate()*100.0, allQueries.errorCounts)
+	}
 
 	if len(b.outputFileStatsResponseLatencyHist) > 0 {
 		_, _ = fmt.Printf("Saving Query Latencies HDR Histogram to %s\n", b.outputFileStatsResponseLatencyHist)
@@ -289,6 +716,13 @@ func (b *BenchmarkRunner) Run(queryPool *sync.Pool, processorCreateFn ProcessorC
 		_ = f.Close()
 	}
 
+	if metricsServer != nil {
+		_ = metricsServer.Close()
+	}
+
+	if b.testResult.Aborted {
+		log.Fatalf("Benchmark aborted: %s\n", b.abortReason)
+	}
 }
 
 func calculateRateMetrics(current, prev int64, took time.Duration) (rate float64) {
@@ -328,6 +762,11 @@ func generateQuantileMap(hist *hdrhistogram.Histogram) (int64, map[string]float6
 }
 
 func (b *BenchmarkRunner) GetOverallQuantiles(histogram *hdrhistogram.Histogram) map[string]interface{} {
+	return overallQuantiles(histogram)
+}
+
+// overallQuantiles returns the quantiles and the encoded histogram of the overall latency histogram
+func overallQuantiles(histogram *hdrhistogram.Histogram) map[string]interface{} {
 	configs := map[string]interface{}{}
 	_, all := generateQuantileMap(histogram)
 	configs["AllQueries"] = all
@@ -339,60 +778,236 @@ func (b *BenchmarkRunner) GetOverallQuantiles(histogram *hdrhistogram.Histogram)
 	return configs
 }
 
-func (b *BenchmarkRunner) processorHandler(rateLimiter *rate.Limiter, wg *sync.WaitGroup, queryPool *sync.Pool, processor Processor, workerNum int, inferencesPerRow int64, limitRps bool) {
-	buflen := uint64(len(b.ch))
-	metricsChan := make(chan uint64, buflen)
-	pwg := &sync.WaitGroup{}
-	responseSizesChan := make(chan uint64, buflen)
-	pwg.Add(1)
+// addUncorrectedQuantiles adds the latency quantiles not corrected for
+// coordinated omission to an open-loop quantiles map
+func (b *BenchmarkRunner) addUncorrectedQuantiles(configs map[string]interface{}, histogram *hdrhistogram.Histogram) {
+	_, all := generateQuantileMap(histogram)
+	configs["AllQueriesUncorrected"] = all
+	configs["EncodedHistogramUncorrected"] = nil
+	encodedHist, err := histogram.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err == nil {
+		configs["EncodedHistogramUncorrected"] = encodedHist
+	}
+}
+
+// addPhaseQuantiles adds the latency quantiles and histogram of each phase to a quantiles map
+func (b *BenchmarkRunner) addPhaseQuantiles(configs map[string]interface{}, group *statGroup) {
+	phases := map[string]interface{}{}
+	for _, name := range group.phaseNames() {
+		histogram := group.phaseHDRHistograms[name]
+		_, qm := generateQuantileMap(histogram)
+		phase := map[string]interface{}{"Quantiles": qm, "EncodedHistogram": nil}
+		encodedHist, err := histogram.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+		if err == nil {
+			phase["EncodedHistogram"] = encodedHist
+		}
+		phases[name] = phase
+	}
+	configs["Phases"] = phases
+}
+
+func (b *BenchmarkRunner) processorHandler(rateLimiter *rate.Limiter, schedule *arrivalSchedule, wg *sync.WaitGroup, initWg *sync.WaitGroup, queryPool *sync.Pool, processor ProcessorV2, workerNum int, inferencesPerRow int64, limitRps bool) {
 	var workerInferences int64 = 0
 
-	processor.Init(workerNum, int(b.workers), pwg, metricsChan, responseSizesChan)
+	if err := processor.Init(context.Background(), workerNum, int(b.workers)); err != nil {
+		log.Fatalf("Error initializing worker %d: %v\n", workerNum, err)
+	}
+	initWg.Done()
 
 	for query := range b.ch {
-		if limitRps {
-			r := rateLimiter.ReserveN(time.Now(), int(inferencesPerRow))
-			time.Sleep(r.Delay())
+		queueDelay := b.waitForSendTime(rateLimiter, schedule, inferencesPerRow, limitRps)
+		ctx, cancel := b.RequestContext()
+		resp := processor.Process(ctx, &InferenceRequest{
+			Payload:               query,
+			IsWarm:                false,
+			WorkerNum:             workerNum,
+			QueryNumber:           workerInferences,
+			UseReferenceDataRedis: b.enableReferenceDataRedis,
+		})
+		cancel()
+		if resp.Err != nil && resp.Err.Kind == ErrorKindTimeout {
+			// timeouts are only accounted as timed out requests, not as failed ones
+			resp.TimedOut = true
+			resp.Err = nil
 		}
-		stats, err := processor.ProcessInferenceQuery(query, false, workerNum, b.enableReferenceDataRedis, false, workerInferences)
-		if err != nil {
-			if b.IgnoreErrors() {
-				fmt.Printf("Ignoring inference error: %v\n", err)
-			} else {
-				panic(err)
+		requests := atomic.AddUint64(&b.requestCount, 1)
+		b.liveMetrics.addResponse(resp)
+		atomic.AddUint64(&b.bytesSent, resp.BytesSent)
+		atomic.AddUint64(&b.bytesReceived, resp.BytesReceived)
+		if resp.TimedOut {
+			resp.TotalResults = 0
+		}
+		stat := GetStat().Init([]byte(resp.Label), resp.Latency.Microseconds(), resp.TotalResults, resp.TimedOut, "")
+		stat.queueDelay = queueDelay
+		stat.workerNum = workerNum
+		stat.host = resp.Host
+		for _, phase := range resp.Phases {
+			stat.AddPhase(phase.Name, phase.Duration.Microseconds())
+		}
+		if resp.Err != nil {
+			stat.errorKind = resp.Err.Kind
+			b.sp.sendStats([]*Stat{stat})
+			failed := atomic.AddUint64(&b.errorCount, 1)
+			if b.debug > 0 {
+				fmt.Printf("Inference error: %v\n", resp.Err)
 			}
+			b.abortOnErrors(requests, failed, resp.Err)
+		} else if resp.TimedOut {
+			// the outcome of a timed out request is unknown, so its inferences are not counted
+			b.sp.sendStats([]*Stat{stat})
 		} else {
+			if b.validator != nil {
+				if mismatches := b.validator.check(query, resp.Output); mismatches > 0 && b.debug > 0 {
+					fmt.Printf("Output mismatch on %d inferences: %v\n", mismatches, resp.Output)
+				}
+			}
 			workerInferences++
+			workerInferences = workerInferences + int64(resp.TotalResults)
+			atomic.AddUint64(&b.inferenceCount, resp.TotalResults)
+			atomic.AddUint64(&b.benchInferenceCount, resp.TotalResults)
+			b.sp.sendStats([]*Stat{stat})
+		}
+		queryPool.Put(&query)
+	}
+
+	if err := processor.Close(); err != nil {
+		fmt.Printf("Error closing worker %d: %v\n", workerNum, err)
+	}
 
-			totalStatInferences := stats[0].totalResults
-			workerInferences = workerInferences + int64(totalStatInferences)
-			atomic.AddUint64(&b.inferenceCount, totalStatInferences)
-			if !stats[0].isWarm {
-				atomic.AddUint64(&b.benchInferenceCount, totalStatInferences)
+	wg.Done()
+}
+
+// abortOnErrors stops the benchmark once the fraction of failed requests goes over -max-error-rate.
+// The requests already sent complete, and the results are still written
+func (b *BenchmarkRunner) abortOnErrors(requests, failed uint64, err error) {
+	if b.ignoreErrors {
+		return
+	}
+	if b.maxErrorRate > 0 && requests < minRequestsForErrorRate {
+		return
+	}
+	errorRate := float64(failed) / float64(requests)
+	if errorRate <= b.maxErrorRate {
+		return
+	}
+	b.abortOnce.Do(func() {
+		b.abortReason = fmt.Sprintf("error rate %.4f over the max of %.4f after %d requests, last error: %v", errorRate, b.maxErrorRate, requests, err)
+		fmt.Printf("Stopping the benchmark: %s\n", b.abortReason)
+		b.scanner.stop()
+	})
+}
+
+// waitForSendTime blocks a worker until its next request is due. On open-loop runs it returns how late,
+// in microseconds, the request is on its intended send time. Target rate changes wake the waiting
+// workers up, so that a wait computed at a low rate doesn't delay the requests at the new one.
+func (b *BenchmarkRunner) waitForSendTime(rateLimiter *rate.Limiter, schedule *arrivalSchedule, inferencesPerRow int64, limitRps bool) int64 {
+	if schedule == nil && !limitRps {
+		return 0
+	}
+	for {
+		rateChanged := b.rateChange()
+		var reservation *rate.Reservation
+		var wait time.Duration
+		if schedule != nil {
+			// open-loop: wait for the intended send time, or account for being late
+			wait = time.Until(schedule.nextArrival(inferencesPerRow))
+			if wait <= 0 {
+				return -wait.Microseconds()
+			}
+		} else {
+			reservation = rateLimiter.ReserveN(time.Now(), int(inferencesPerRow))
+			wait = reservation.Delay()
+			if wait <= 0 {
+				return 0
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			return 0
+		case <-rateChanged:
+			timer.Stop()
+			if reservation != nil {
+				reservation.Cancel()
 			}
-			b.sp.sendStats(stats)
 		}
-		queryPool.Put(&query)
 	}
+}
 
-	processor.Close()
+// rateChange returns a channel that is closed on the next target rate change
+func (b *BenchmarkRunner) rateChange() chan struct{} {
+	b.rateChangedMu.Lock()
+	defer b.rateChangedMu.Unlock()
+	if b.rateChanged == nil {
+		b.rateChanged = make(chan struct{})
+	}
+	return b.rateChanged
+}
 
-	//pwg.Wait()
-	close(metricsChan)
-	close(responseSizesChan)
+// setTargetRate changes the rate of the running workers, waking up the ones waiting on the previous rate.
+// dropBacklog also drops the open-loop arrivals that are still due.
+// The rate is kept at 1 rps at least, since a zero rate would block the workers for good
+func (b *BenchmarkRunner) setTargetRate(rateLimiter *rate.Limiter, schedule *arrivalSchedule, rps float64, dropBacklog bool) {
+	if rps < 1 {
+		rps = 1
+	}
+	if schedule != nil && dropBacklog {
+		schedule.restart(time.Now(), rps)
+	} else if schedule != nil {
+		schedule.setRate(rps)
+	} else {
+		rateLimiter.SetLimit(rate.Limit(rps))
+	}
+	b.rateChangedMu.Lock()
+	if b.rateChanged != nil {
+		close(b.rateChanged)
+	}
+	b.rateChanged = make(chan struct{})
+	b.rateChangedMu.Unlock()
+}
 
-	wg.Done()
+// logInterval writes the histograms of the reporting period that started at from to the hdr log.
+// The latency histogram is untagged, the phases are tagged phase:NAME and the latency not
+// corrected for coordinated omission uncorrected
+func (b *BenchmarkRunner) logInterval(from, to time.Time, stats *statGroup) {
+	err := b.hdrLog.writeInterval("", from, to, stats.latencyHDRHistogram)
+	if err == nil && stats.uncorrectedLatencyHDRHistogram != nil {
+		err = b.hdrLog.writeInterval("uncorrected", from, to, stats.uncorrectedLatencyHDRHistogram)
+	}
+	for _, name := range stats.phaseNames() {
+		if err != nil {
+			break
+		}
+		err = b.hdrLog.writeInterval("phase:"+name, from, to, stats.phaseHDRHistograms[name])
+	}
+	if err != nil {
+		log.Fatalf("Error writing the hdr log %s: %v", b.hdrLogFile, err)
+	}
 }
 
 // report handles periodic reporting of loading stats
-func (b *BenchmarkRunner) report(period time.Duration, start time.Time, quantileStats map[int64]interface{}) {
+func (b *BenchmarkRunner) report(period time.Duration, start time.Time, quantileStats map[int64]interface{}, done chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
 	prevTime := start
 	prevCount := uint64(0)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
 	fmt.Printf("%26s %25s %25s %26s %26s %26s\n", "Test time", "Inference Rate", "Total Inferences", "p50 lat. (msec)", "p95 lat. (msec)", "p99 lat. (msec)")
-	for now := range time.NewTicker(period).C {
+	for {
+		var now time.Time
+		select {
+		case <-done:
+			// done is closed once every stat was processed, so the last partial period is complete
+			if stats := b.sp.takeInstantaneous(); b.hdrLog != nil && stats.count > 0 {
+				b.logInterval(prevTime, time.Now(), stats)
+			}
+			return
+		case now = <-ticker.C:
+		}
 		opsCount := atomic.LoadUint64(&b.inferenceCount)
 		took := now.Sub(prevTime)
-		statHist := b.sp.InstantaneousStats.latencyHDRHistogram
+		stats := b.sp.takeInstantaneous()
+		statHist := stats.latencyHDRHistogram
 		testTime := time.Since(start).Seconds()
 		instantCount := opsCount - prevCount
 		instantRate := float64(instantCount) / float64(took.Seconds())
@@ -401,30 +1016,98 @@ func (b *BenchmarkRunner) report(period time.Duration, start time.Time, quantile
 		p99 := float64(statHist.ValueAtQuantile(99.0)) / 10e2
 		fmt.Printf("%25.0fs %25.0f %25d %25.3f %25.3f %25.3f\t", testTime, instantRate, opsCount, p50, p95, p99)
 		fmt.Printf("\n")
+		intervalStart := prevTime
 		prevTime = now
 		prevCount = opsCount
 
 		var currentClientStats = make(map[string]interface{})
 		currentClientStats["InferenceRate"] = instantRate
+		currentClientStats["TimedOut"] = stats.timedOutCount
+		currentClientStats["Errors"] = stats.errorCount
+		currentClientStats["ErrorRate"] = stats.errorRate()
+		currentClientStats["ErrorsByKind"] = stats.errorCountsByKind()
+		if stage, ok := b.currentStage.Load().(string); ok {
+			currentClientStats["Stage"] = stage
+		}
 		currentClientStats["TestTime"] = testTime
 		_, qm := generateQuantileMap(statHist)
+		b.liveMetrics.setPeriod(instantRate, qm)
 		encodedHist, err := statHist.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
 		if err == nil {
 			currentClientStats["EncodedHistogram"] = encodedHist
 		}
 		currentClientStats["Quantiles"] = qm
+		if phaseNames := stats.phaseNames(); len(phaseNames) > 0 {
+			phaseQuantiles := make(map[string]interface{})
+			for _, name := range phaseNames {
+				_, phaseQuantiles[name] = generateQuantileMap(stats.phaseHDRHistograms[name])
+			}
+			currentClientStats["PhaseQuantiles"] = phaseQuantiles
+		}
+		if uncorrectedHist := stats.uncorrectedLatencyHDRHistogram; uncorrectedHist != nil {
+			_, uqm := generateQuantileMap(uncorrectedHist)
+			currentClientStats["QuantilesUncorrected"] = uqm
+		}
+		b.clientRunTimeStatsMu.Lock()
 		quantileStats[now.UnixNano()] = currentClientStats
-		b.sp.InstantaneousStats.reset()
+		b.clientRunTimeStatsMu.Unlock()
+		if b.hdrLog != nil {
+			b.logInterval(intervalStart, now, stats)
+		}
+		if b.agent != nil {
+			if err := b.agent.sendInterval(intervalStart, now, instantCount, stats, encodedHist); err != nil {
+				fmt.Printf("Error queuing the interval stats for the coordinator: %v\n", err)
+			}
+		}
 	}
 }
 
-// report handles periodic reporting of loading stats
-func (b *BenchmarkRunner) collectRunTimeStats(period time.Duration, collector MetricCollector, runtimeStats map[int64]interface{}) {
+// newProcessSamplers returns the samplers of the resource usage of the local model server process,
+// when -server-pid or -server-process-name is set, and of the client process. The client one is
+// left out where /proc is not available
+func (b *BenchmarkRunner) newProcessSamplers() (server MetricCollector, client MetricCollector) {
+	if b.reportingPeriod <= 0 {
+		if b.serverPid != 0 || len(b.serverProcessName) > 0 {
+			panic("server-pid and server-process-name require a positive reporting-period")
+		}
+		return
+	}
+	pid := b.serverPid
+	if len(b.serverProcessName) > 0 {
+		var err error
+		if pid, err = findProcess(b.serverProcessName); err != nil {
+			log.Fatalf("Error looking up the server process: %v", err)
+		}
+	}
+	if pid != 0 {
+		sampler, err := newProcessSampler(pid, b.InferenceCount)
+		if err != nil {
+			log.Fatalf("Error sampling the server process %d: %v", pid, err)
+		}
+		fmt.Printf("Sampling the resource usage of the server process %d\n", pid)
+		server = sampler
+	}
+	if sampler, err := newProcessSampler(os.Getpid(), b.InferenceCount); err == nil {
+		client = sampler
+	}
+	return
+}
 
-	for now := range time.NewTicker(period).C {
+// collectRunTimeStats stores the server runtime stats of each reporting period, until done is closed
+func collectRunTimeStats(period time.Duration, collector MetricCollector, runtimeStats map[int64]interface{}, ignoreErrors bool, done chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-done:
+			return
+		case now = <-ticker.C:
+		}
 		_, metrics, err := collector.CollectRunTimeMetrics()
 		if err != nil {
-			if b.IgnoreErrors() {
+			if ignoreErrors {
 				fmt.Printf("Ignoring runtime stats error: %v\n", err)
 			} else {
 				log.Fatalf("Runtime stats error: %v\n", err)
@@ -0,0 +1,114 @@
+package inference
+
+import (
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+)
+
+// configFlagName is the flag naming the YAML or JSON config file of the runners
+const configFlagName = "config"
+
+// registerConfigFlag defines the -config flag on the default flag set
+func registerConfigFlag(configFile *string) {
+	flag.StringVar(configFile, configFlagName, "", "YAML or JSON file with the runner flags, either at the top level or grouped in sections "+
+		"(e.g. runner, target, model, output), by flag name. Lists are joined with commas. Flags set on the command line override the file ones.")
+}
+
+// parseFlags parses the command line, then sets the flags not given on it from configFile, when set.
+// It returns the resolved value of every flag
+func parseFlags(configFile *string) map[string]interface{} {
+	flag.Parse()
+	if len(*configFile) > 0 {
+		if err := applyConfigFile(flag.CommandLine, *configFile); err != nil {
+			log.Fatalf("Error applying the config file %s: %v", *configFile, err)
+		}
+	}
+	return resolvedFlags(flag.CommandLine)
+}
+
+// applyConfigFile sets the flags of fs not set yet from the config file values
+func applyConfigFile(fs *flag.FlagSet, fileName string) error {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	values, err := parseConfig(data)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown flag %q", name)
+		}
+		if set[name] {
+			continue
+		}
+		if err = fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("invalid value %q for flag %q: %v", values[name], name, err)
+		}
+	}
+	return nil
+}
+
+// parseConfig flattens a YAML or JSON config, JSON being a subset of YAML, into flag values by name
+func parseConfig(data []byte) (map[string]string, error) {
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	if err := flattenConfig(config, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func flattenConfig(config map[string]interface{}, values map[string]string) error {
+	for key, value := range config {
+		switch v := value.(type) {
+		case map[interface{}]interface{}:
+			section := make(map[string]interface{}, len(v))
+			for k, sv := range v {
+				section[fmt.Sprint(k)] = sv
+			}
+			if err := flattenConfig(section, values); err != nil {
+				return err
+			}
+			continue
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			value = strings.Join(items, ",")
+		case nil:
+			value = ""
+		}
+		if _, ok := values[key]; ok {
+			return fmt.Errorf("flag %q is set more than once", key)
+		}
+		values[key] = fmt.Sprint(value)
+	}
+	return nil
+}
+
+// resolvedFlags returns the value of every flag of fs, by name
+func resolvedFlags(fs *flag.FlagSet) map[string]interface{} {
+	resolved := map[string]interface{}{}
+	fs.VisitAll(func(f *flag.Flag) {
+		resolved[f.Name] = f.Value.String()
+	})
+	return resolved
+}
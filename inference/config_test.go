@@ -0,0 +1,63 @@
+package inference
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aibench-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		config  string
+		args    []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"yaml sections", "runner:\n  workers: 16\ntarget:\n  host: [h1, h2]\nmodel:\n  model: mobilenet\n", nil,
+			map[string]string{"workers": "16", "host": "h1,h2", "model": "mobilenet"}, false},
+		{"json top level", `{"workers": 4, "host": "h1"}`, nil,
+			map[string]string{"workers": "4", "host": "h1", "model": "default"}, false},
+		{"command line overrides", "workers: 16\nmodel: mobilenet\n", []string{"-workers=2"},
+			map[string]string{"workers": "2", "host": "localhost", "model": "mobilenet"}, false},
+		{"unknown flag", "runner:\n  nope: 1\n", nil, nil, true},
+		{"invalid value", "workers: many\n", nil, nil, true},
+		{"duplicated flag", "runner:\n  workers: 1\noutput:\n  workers: 2\n", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(dir, "config.yml")
+			if err := ioutil.WriteFile(fileName, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fs := flag.NewFlagSet(tt.name, flag.ContinueOnError)
+			fs.Uint("workers", 8, "")
+			fs.String("host", "localhost", "")
+			fs.String("model", "default", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			err := applyConfigFile(fs, fileName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyConfigFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			resolved := resolvedFlags(fs)
+			for name, want := range tt.want {
+				if resolved[name] != want {
+					t.Errorf("flag %s = %v, want %v", name, resolved[name], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,562 @@
+package inference
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A distributed benchmark runs a benchmark runner (the agent) on several client hosts, coordinated
+// by a Coordinator over HTTP, with JSON bodies:
+//
+//	POST /register  agentRegistration  the agent joins the benchmark
+//	GET  /start                        blocks until every agent joined, or for startPollTimeout at most,
+//	                                   and replies with agentStart
+//	POST /interval  agentInterval      the stats of each reporting period, replied with agentIntervalReply
+//	POST /done      agentDone          the agent results, once its run is over
+//
+// The agents start together at the start time, and stop together once any of them is done.
+// The coordinator merges the agents interval and overall histograms into one TestResult.
+// Each request is a heartbeat of its agent: an agent silent for longer than the agent timeout
+// is dropped from the benchmark, which is then aborted.
+
+// startPollTimeout bounds GET /start, which the agents poll until the benchmark starts
+const startPollTimeout = 5 * time.Second
+
+// agentRegistration is the body of POST /register
+type agentRegistration struct {
+	ID      string `json:"ID"`
+	Workers uint   `json:"Workers"`
+}
+
+// agentStart is the reply of GET /start
+type agentStart struct {
+	StartAt int64 `json:"StartAt"` // nanoseconds since epoch, 0 when the agents are not all registered yet
+}
+
+// agentInterval is the body of POST /interval, with the stats of a reporting period
+type agentInterval struct {
+	ID               string `json:"ID"`
+	Index            int64  `json:"Index"` // reporting period number, from 0
+	From             int64  `json:"From"`  // nanoseconds since epoch
+	To               int64  `json:"To"`    // nanoseconds since epoch
+	Inferences       uint64 `json:"Inferences"`
+	Requests         int64  `json:"Requests"`
+	Errors           int64  `json:"Errors"`
+	TimedOut         int64  `json:"TimedOut"`
+	EncodedHistogram []byte `json:"EncodedHistogram"`
+}
+
+// agentIntervalReply is the reply of POST /interval
+type agentIntervalReply struct {
+	Stop bool `json:"Stop"` // whether the agent should stop, as another agent is done
+}
+
+// agentDone is the body of POST /done
+type agentDone struct {
+	ID               string     `json:"ID"`
+	EncodedHistogram []byte     `json:"EncodedHistogram"` // overall latency histogram, excluding the warmup
+	Result           TestResult `json:"Result"`
+}
+
+// AgentResult summarizes the run of one agent of a distributed benchmark
+type AgentResult struct {
+	ID           string                 `json:"ID"`
+	ClientHost   ClientHostInfo         `json:"ClientHost"`
+	Workers      uint                   `json:"Workers"`
+	StartTime    int64                  `json:"StartTime"`
+	EndTime      int64                  `json:"EndTime"`
+	Interrupted  bool                   `json:"Interrupted"`
+	Aborted      bool                   `json:"Aborted"`
+	Totals       map[string]interface{} `json:"Totals"`
+	OverallRates map[string]interface{} `json:"OverallRates"`
+}
+
+// mergedInterval holds the stats of a reporting period, merged over the agents
+type mergedInterval struct {
+	reports    int
+	from       int64
+	to         int64
+	inferences uint64
+	requests   int64
+	errors     int64
+	timedOut   int64
+	histogram  *hdrhistogram.Histogram
+	printed    bool
+}
+
+// Coordinator runs a distributed benchmark among a fixed number of agents
+type Coordinator struct {
+	agents       int
+	startDelay   time.Duration
+	agentTimeout time.Duration
+	out          io.Writer
+
+	mu              sync.Mutex
+	registered      []string
+	workers         map[string]uint
+	lastSeen        map[string]time.Time // time of the last request of each agent
+	lost            map[string]bool      // agents dropped for being silent longer than agentTimeout
+	started         chan struct{}
+	startAt         time.Time
+	stopping        bool
+	intervals       map[int64]*mergedInterval
+	totalInferences uint64
+	done            map[string]*agentDone
+	finished        chan struct{}
+}
+
+// NewCoordinator creates a Coordinator waiting for agents to register, which starts
+// them startDelay after the last one registered. Registered agents silent for longer than
+// agentTimeout are dropped, 0 waiting for them forever. Merged interval stats are printed to out
+func NewCoordinator(agents int, startDelay time.Duration, agentTimeout time.Duration, out io.Writer) *Coordinator {
+	return &Coordinator{
+		agents:       agents,
+		startDelay:   startDelay,
+		agentTimeout: agentTimeout,
+		out:          out,
+		workers:      map[string]uint{},
+		lastSeen:     map[string]time.Time{},
+		lost:         map[string]bool{},
+		started:      make(chan struct{}),
+		intervals:    map[int64]*mergedInterval{},
+		done:         map[string]*agentDone{},
+		finished:     make(chan struct{}),
+	}
+}
+
+// Handler returns the HTTP handler of the coordinator protocol
+func (c *Coordinator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", c.handleRegister)
+	mux.HandleFunc("/start", c.handleStart)
+	mux.HandleFunc("/interval", c.handleInterval)
+	mux.HandleFunc("/done", c.handleDone)
+	return mux
+}
+
+// Wait blocks until every agent is done or dropped, and returns the merged results
+func (c *Coordinator) Wait() (*TestResult, error) {
+	if c.agentTimeout > 0 {
+		ticker := time.NewTicker(c.agentTimeout / 4)
+		defer ticker.Stop()
+	wait:
+		for {
+			select {
+			case <-c.finished:
+				break wait
+			case <-ticker.C:
+				c.dropSilentAgents()
+			}
+		}
+	}
+	<-c.finished
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mergeResults()
+}
+
+// dropSilentAgents drops the running agents whose last request is older than the agent timeout,
+// and stops the other ones
+func (c *Coordinator) dropSilentAgents() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range c.registered {
+		if c.done[id] != nil || c.lost[id] || time.Since(c.lastSeen[id]) <= c.agentTimeout {
+			continue
+		}
+		fmt.Fprintf(c.out, "Agent %s sent nothing for %v, dropping it and stopping the other agents\n", id, c.agentTimeout)
+		c.lost[id] = true
+		c.stopping = true
+		c.finishIfOver()
+	}
+}
+
+// finishIfOver signals Wait once every agent is done or dropped
+func (c *Coordinator) finishIfOver() {
+	if len(c.done)+len(c.lost) == c.agents {
+		close(c.finished)
+	}
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeReply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (c *Coordinator) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var reg agentRegistration
+	if !decodeBody(w, r, &reg) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.workers[reg.ID]; ok {
+		http.Error(w, fmt.Sprintf("agent %s is already registered", reg.ID), http.StatusConflict)
+		return
+	}
+	if len(c.registered) == c.agents {
+		http.Error(w, "the benchmark already has all of its agents", http.StatusConflict)
+		return
+	}
+	c.registered = append(c.registered, reg.ID)
+	c.workers[reg.ID] = reg.Workers
+	c.lastSeen[reg.ID] = time.Now()
+	fmt.Fprintf(c.out, "Agent %s registered with %d workers (%d/%d)\n", reg.ID, reg.Workers, len(c.registered), c.agents)
+	if len(c.registered) == c.agents {
+		c.startAt = time.Now().Add(c.startDelay)
+		// the first interval is expected a reporting period after the start
+		for _, id := range c.registered {
+			c.lastSeen[id] = c.startAt
+		}
+		fmt.Fprintf(c.out, "Starting the benchmark at %s\n", c.startAt.Format(time.RFC3339Nano))
+		close(c.started)
+	}
+	writeReply(w, struct{}{})
+}
+
+// seen records a request of agent id, returning false when it was dropped already
+func (c *Coordinator) seen(id string) bool {
+	if c.lost[id] {
+		return false
+	}
+	if _, ok := c.workers[id]; ok && time.Now().After(c.lastSeen[id]) {
+		c.lastSeen[id] = time.Now()
+	}
+	return true
+}
+
+func (c *Coordinator) handleStart(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.seen(r.URL.Query().Get("id"))
+	c.mu.Unlock()
+	timer := time.NewTimer(startPollTimeout)
+	defer timer.Stop()
+	select {
+	case <-c.started:
+	case <-timer.C:
+		writeReply(w, agentStart{})
+		return
+	case <-r.Context().Done():
+		return
+	}
+	writeReply(w, agentStart{StartAt: c.startAt.UnixNano()})
+}
+
+func (c *Coordinator) handleInterval(w http.ResponseWriter, r *http.Request) {
+	var interval agentInterval
+	if !decodeBody(w, r, &interval) {
+		return
+	}
+	var histogram *hdrhistogram.Histogram
+	if len(interval.EncodedHistogram) > 0 {
+		var err error
+		histogram, err = hdrhistogram.Decode(interval.EncodedHistogram)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.seen(interval.ID) {
+		// too late, the benchmark is over for this agent
+		writeReply(w, agentIntervalReply{Stop: true})
+		return
+	}
+	merged, ok := c.intervals[interval.Index]
+	if !ok {
+		merged = &mergedInterval{from: interval.From, to: interval.To}
+		c.intervals[interval.Index] = merged
+	}
+	merged.reports++
+	if interval.From < merged.from {
+		merged.from = interval.From
+	}
+	if interval.To > merged.to {
+		merged.to = interval.To
+	}
+	merged.inferences += interval.Inferences
+	merged.requests += interval.Requests
+	merged.errors += interval.Errors
+	merged.timedOut += interval.TimedOut
+	if histogram != nil {
+		if merged.histogram == nil {
+			merged.histogram = histogram
+		} else {
+			merged.histogram.Merge(histogram)
+		}
+	}
+	if merged.reports >= len(c.registered)-len(c.done)-len(c.lost) {
+		c.printInterval(interval.Index, merged)
+	}
+	writeReply(w, agentIntervalReply{Stop: c.stopping})
+}
+
+// printInterval prints the merged stats of a reporting period, once every running agent reported it
+func (c *Coordinator) printInterval(index int64, merged *mergedInterval) {
+	if merged.printed {
+		return
+	}
+	merged.printed = true
+	if index == 0 {
+		fmt.Fprintf(c.out, "%26s %25s %25s %26s %26s %26s\n", "Test time", "Inference Rate", "Total Inferences", "p50 lat. (msec)", "p95 lat. (msec)", "p99 lat. (msec)")
+	}
+	c.totalInferences += merged.inferences
+	_, qm := generateQuantileMap(merged.latencyHistogram())
+	fmt.Fprintf(c.out, "%25.0fs %25.0f %25d %25.3f %25.3f %25.3f\n",
+		time.Duration(merged.to-c.startAt.UnixNano()).Seconds(), merged.rate(), c.totalInferences, qm["q50"], qm["q95"], qm["q99"])
+}
+
+// rate returns the inferences per second over the interval
+func (m *mergedInterval) rate() float64 {
+	took := time.Duration(m.to - m.from).Seconds()
+	if took <= 0 {
+		return 0
+	}
+	return float64(m.inferences) / took
+}
+
+func (m *mergedInterval) latencyHistogram() *hdrhistogram.Histogram {
+	if m.histogram == nil {
+		return hdrhistogram.New(1, 30000000, 3)
+	}
+	return m.histogram
+}
+
+func (c *Coordinator) handleDone(w http.ResponseWriter, r *http.Request) {
+	var done agentDone
+	if !decodeBody(w, r, &done) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.workers[done.ID]; !ok {
+		http.Error(w, fmt.Sprintf("agent %s is not registered", done.ID), http.StatusNotFound)
+		return
+	}
+	if !c.seen(done.ID) {
+		http.Error(w, fmt.Sprintf("agent %s was dropped after %v without any request", done.ID, c.agentTimeout), http.StatusGone)
+		return
+	}
+	if c.done[done.ID] != nil {
+		http.Error(w, fmt.Sprintf("agent %s is already done", done.ID), http.StatusConflict)
+		return
+	}
+	if !c.stopping {
+		fmt.Fprintf(c.out, "Agent %s is done, stopping the other agents\n", done.ID)
+	}
+	c.stopping = true
+	c.done[done.ID] = &done
+	c.finishIfOver()
+	writeReply(w, struct{}{})
+}
+
+// mergeResults merges the agents results: counters and rates are summed, as the agents ran
+// concurrently, and the latency quantiles are computed out of the merged histograms
+func (c *Coordinator) mergeResults() (*TestResult, error) {
+	result := &TestResult{
+		ResultFormatVersion: ResultFormatVersion,
+		GitSHA1:             GitSHA1,
+		GitDirty:            gitDirty(),
+		CommandLine:         os.Args,
+		ClientHost:          getClientHostInfo(),
+		DBSpecificConfigs:   map[string]interface{}{},
+		ServerInfo:          map[string]interface{}{},
+		ClientRunTimeStats:  map[int64]interface{}{},
+		ServerRunTimeStats:  map[int64]interface{}{},
+		Agents:              make([]AgentResult, 0, len(c.registered)),
+	}
+	totals := map[string]interface{}{}
+	rates := map[string]interface{}{"overallOpsRate": 0.0}
+	ratesIncludingWarmup := map[string]interface{}{"overallOpsRate": 0.0}
+	var overall *hdrhistogram.Histogram
+	abortReasons := make([]string, 0)
+	first := true
+	for _, id := range c.registered {
+		if c.lost[id] {
+			result.Aborted = true
+			abortReasons = append(abortReasons, fmt.Sprintf("%s: dropped after %v without any request", id, c.agentTimeout))
+			result.Agents = append(result.Agents, AgentResult{ID: id, Workers: c.workers[id], Aborted: true})
+			continue
+		}
+		done := c.done[id]
+		r := done.Result
+		if first {
+			first = false
+			result.MetadataAutobatching = r.MetadataAutobatching
+			result.TensorBatchSize = r.TensorBatchSize
+			result.TestTimeMillis = r.TestTimeMillis
+			result.RequestTimeoutMillis = r.RequestTimeoutMillis
+			result.OpenLoop = r.OpenLoop
+			result.ArrivalDistribution = r.ArrivalDistribution
+			result.MaxErrorRate = r.MaxErrorRate
+			result.TestDescription = r.TestDescription
+			result.StartTime = r.StartTime
+		}
+		result.Limit += r.Limit
+		result.Workers += r.Workers
+		result.MaxRps += r.MaxRps
+		if r.StartTime < result.StartTime {
+			result.StartTime = r.StartTime
+		}
+		if r.EndTime > result.EndTime {
+			result.EndTime = r.EndTime
+		}
+		if r.DurationMillis > result.DurationMillis {
+			result.DurationMillis = r.DurationMillis
+		}
+		result.Interrupted = result.Interrupted || r.Interrupted
+		if r.Aborted {
+			result.Aborted = true
+			abortReasons = append(abortReasons, fmt.Sprintf("%s: %s", id, r.AbortReason))
+		}
+		result.DBSpecificConfigs[id] = r.DBSpecificConfigs
+		for addr, info := range r.ServerInfo {
+			result.ServerInfo[addr] = info
+		}
+		result.Models = mergeModels(result.Models, r.Models)
+		result.Validation = mergeValidation(result.Validation, r.Validation)
+		sumTotals(totals, r.Totals)
+		rates["overallOpsRate"] = rates["overallOpsRate"].(float64) + toFloat(r.OverallRates["overallOpsRate"])
+		ratesIncludingWarmup["overallOpsRate"] = ratesIncludingWarmup["overallOpsRate"].(float64) + toFloat(r.OverallRatesIncludingWarmup["overallOpsRate"])
+
+		histogram, err := hdrhistogram.Decode(done.EncodedHistogram)
+		if err != nil {
+			return nil, fmt.Errorf("decoding the histogram of agent %s: %v", id, err)
+		}
+		if overall == nil {
+			overall = histogram
+		} else {
+			overall.Merge(histogram)
+		}
+		result.Agents = append(result.Agents, AgentResult{
+			ID:           id,
+			ClientHost:   r.ClientHost,
+			Workers:      r.Workers,
+			StartTime:    r.StartTime,
+			EndTime:      r.EndTime,
+			Interrupted:  r.Interrupted,
+			Aborted:      r.Aborted,
+			Totals:       r.Totals,
+			OverallRates: r.OverallRates,
+		})
+	}
+	if requests := toFloat(totals["Requests"]); requests > 0 {
+		totals["ErrorRate"] = toFloat(totals["Errors"]) / requests
+	}
+	result.AbortReason = strings.Join(abortReasons, "; ")
+	result.Totals = totals
+	result.OverallRates = rates
+	result.OverallRatesIncludingWarmup = ratesIncludingWarmup
+	if overall == nil {
+		overall = hdrhistogram.New(1, 30000000, 3)
+	}
+	result.OverallQuantiles = overallQuantiles(overall)
+
+	indexes := make([]int64, 0, len(c.intervals))
+	for index := range c.intervals {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	for _, index := range indexes {
+		merged := c.intervals[index]
+		stats := map[string]interface{}{
+			"InferenceRate": merged.rate(),
+			"TimedOut":      merged.timedOut,
+			"Errors":        merged.errors,
+			"ErrorRate":     0.0,
+			"Agents":        merged.reports,
+			"TestTime":      time.Duration(merged.to - c.startAt.UnixNano()).Seconds(),
+		}
+		if merged.requests > 0 {
+			stats["ErrorRate"] = float64(merged.errors) / float64(merged.requests)
+		}
+		_, stats["Quantiles"] = generateQuantileMap(merged.latencyHistogram())
+		if encodedHist, err := merged.latencyHistogram().Encode(hdrhistogram.V2CompressedEncodingCookieBase); err == nil {
+			stats["EncodedHistogram"] = encodedHist
+		}
+		result.ClientRunTimeStats[merged.to] = stats
+	}
+	return result, nil
+}
+
+// mergeValidation adds the outputs validation counts of an agent to validation
+func mergeValidation(validation *ValidationResult, agentValidation *ValidationResult) *ValidationResult {
+	if agentValidation == nil {
+		return validation
+	}
+	if validation == nil {
+		merged := *agentValidation
+		return &merged
+	}
+	validation.Validated += agentValidation.Validated
+	validation.Mismatches += agentValidation.Mismatches
+	validation.Unvalidated += agentValidation.Unvalidated
+	validation.Accuracy = 0
+	if validation.Validated > 0 {
+		validation.Accuracy = float64(validation.Validated-validation.Mismatches) / float64(validation.Validated)
+	}
+	return validation
+}
+
+// mergeModels adds the models of an agent to models, the agents sharing the target servers
+// reporting the same models
+func mergeModels(models []ModelConfig, agentModels []ModelConfig) []ModelConfig {
+	for _, model := range agentModels {
+		known := false
+		for _, m := range models {
+			if m.Host == model.Host && m.Key == model.Key {
+				known = true
+				break
+			}
+		}
+		if !known {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// sumTotals adds the numeric totals of an agent, and its errors by kind and by label, to totals
+func sumTotals(totals map[string]interface{}, agentTotals map[string]interface{}) {
+	for key, value := range agentTotals {
+		switch v := value.(type) {
+		case float64:
+			if key != "ErrorRate" {
+				totals[key] = toFloat(totals[key]) + v
+			}
+		case map[string]interface{}:
+			sum, _ := totals[key].(map[string]interface{})
+			if sum == nil {
+				sum = map[string]interface{}{}
+				totals[key] = sum
+			}
+			sumTotals(sum, v)
+		}
+	}
+}
+
+func toFloat(v interface{}) float64 {
+	f, _ := v.(float64)
+	return f
+}
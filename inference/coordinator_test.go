@@ -0,0 +1,185 @@
+package inference
+
+import (
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCoordinator(t *testing.T) {
+	const agents = 3
+	coordinator := NewCoordinator(agents, 10*time.Millisecond, time.Minute, ioutil.Discard)
+	server := httptest.NewServer(coordinator.Handler())
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	var wg, reported sync.WaitGroup
+	firstDone := make(chan struct{})
+	reported.Add(agents)
+	stoppedEarly := make([]bool, agents)
+	stopped := make([]bool, agents)
+	for i := 0; i < agents; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			agent := newAgentClient(addr, string(rune('a'+i)))
+			if err := agent.register(2); err != nil {
+				t.Error(err)
+				reported.Done()
+				return
+			}
+			start, err := agent.waitStart()
+			if err != nil {
+				t.Error(err)
+				reported.Done()
+				return
+			}
+			overall := hdrhistogram.New(1, 30000000, 3)
+			// agent i reports i+1 intervals of 10 requests of (i+1) ms each, and the agents still
+			// running once agent a is done one more, replied with Stop
+			intervals := i + 1
+			for index := 0; index < intervals+1; index++ {
+				if index == intervals {
+					reported.Done()
+					if i == 0 {
+						break
+					}
+					<-firstDone
+				}
+				interval := hdrhistogram.New(1, 30000000, 3)
+				_ = interval.RecordValues(int64(i+1)*1000, 10)
+				overall.Merge(interval)
+				encoded, _ := interval.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+				from := start.Add(time.Duration(index) * time.Second)
+				if err := agent.sendInterval(from, from.Add(time.Second), 10, &statGroup{count: 10}, encoded); err != nil {
+					t.Error(err)
+				}
+				agent.flushIntervals()
+				if index == intervals-1 {
+					select {
+					case <-agent.stopped:
+						stoppedEarly[i] = true
+					default:
+					}
+				}
+			}
+			if i == 0 {
+				// let the others report their intervals before stopping them
+				reported.Wait()
+			} else {
+				select {
+				case <-agent.stopped:
+					stopped[i] = true
+				default:
+				}
+			}
+			encoded, _ := overall.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+			result := TestResult{
+				Workers:      2,
+				Totals:       map[string]interface{}{"Requests": float64(10 * (i + 1)), "Errors": float64(i), "ErrorsByKind": map[string]interface{}{"server": float64(i)}},
+				OverallRates: map[string]interface{}{"overallOpsRate": 10.0},
+			}
+			if err := agent.sendDone(result, encoded); err != nil {
+				t.Error(err)
+			}
+			if i == 0 {
+				close(firstDone)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	result, err := coordinator.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Agents) != agents || result.Workers != 2*agents {
+		t.Errorf("got %d agents and %d workers, want %d and %d", len(result.Agents), result.Workers, agents, 2*agents)
+	}
+	if rate := result.OverallRates["overallOpsRate"]; rate != 30.0 {
+		t.Errorf("overall rate = %v, want 30", rate)
+	}
+	if requests, errors := result.Totals["Requests"], result.Totals["Errors"]; requests != 60.0 || errors != 3.0 {
+		t.Errorf("totals requests = %v and errors = %v, want 60 and 3", requests, errors)
+	}
+	if kinds := result.Totals["ErrorsByKind"].(map[string]interface{}); kinds["server"] != 3.0 {
+		t.Errorf("server errors = %v, want 3", kinds["server"])
+	}
+	if q100 := result.OverallQuantiles["AllQueries"].(map[string]float64)["q100"]; q100 < 3 || q100 > 3.01 {
+		t.Errorf("overall max latency = %v, want 3", q100)
+	}
+	// the intervals are merged by index: 3 reports for the first one, 2 for the second one (b and c),
+	// 2 for the third one (the last one of b, and c) and 1 for the last one of c
+	if len(result.ClientRunTimeStats) != agents+1 {
+		t.Fatalf("got %d intervals, want %d", len(result.ClientRunTimeStats), agents+1)
+	}
+	reports := map[int]int{}
+	for _, stats := range result.ClientRunTimeStats {
+		reports[stats.(map[string]interface{})["Agents"].(int)]++
+	}
+	if reports[1] != 1 || reports[2] != 2 || reports[3] != 1 {
+		t.Errorf("got %v intervals by number of agent reports, want 1 with 1, 2 with 2 and 1 with 3", reports)
+	}
+	for i := 0; i < agents; i++ {
+		if stoppedEarly[i] {
+			t.Errorf("agent %c was asked to stop before any agent was done", 'a'+i)
+		}
+		if i > 0 && !stopped[i] {
+			t.Errorf("agent %c was not asked to stop once agent a was done", 'a'+i)
+		}
+	}
+}
+
+func TestCoordinatorDropsSilentAgents(t *testing.T) {
+	coordinator := NewCoordinator(2, 0, 50*time.Millisecond, ioutil.Discard)
+	server := httptest.NewServer(coordinator.Handler())
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	agents := []*agentClient{newAgentClient(addr, "a"), newAgentClient(addr, "b")}
+	for _, agent := range agents {
+		if err := agent.register(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := agents[0].waitStart(); err != nil {
+		t.Fatal(err)
+	}
+	// agent b dies without a word
+	histogram, _ := hdrhistogram.New(1, 30000000, 3).Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	result := TestResult{Workers: 1, OverallRates: map[string]interface{}{"overallOpsRate": 10.0}}
+	if err := agents[0].sendDone(result, histogram); err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := coordinator.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !merged.Aborted || !strings.HasPrefix(merged.AbortReason, "b: dropped") {
+		t.Errorf("got aborted = %v with reason %q, want the benchmark aborted as agent b was dropped", merged.Aborted, merged.AbortReason)
+	}
+	if len(merged.Agents) != 2 || !merged.Agents[1].Aborted || merged.Workers != 1 {
+		t.Errorf("got agents %+v and %d workers, want agent b aborted and 1 worker", merged.Agents, merged.Workers)
+	}
+	if err := agents[1].sendDone(result, histogram); err == nil {
+		t.Errorf("expected the results of the dropped agent to be rejected")
+	}
+}
+
+func TestCoordinatorRejectsExtraAgents(t *testing.T) {
+	coordinator := NewCoordinator(1, 0, time.Minute, ioutil.Discard)
+	server := httptest.NewServer(coordinator.Handler())
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+	if err := newAgentClient(addr, "a").register(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := newAgentClient(addr, "b").register(1); err == nil {
+		t.Errorf("expected the second agent registration to fail")
+	}
+}
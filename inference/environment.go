@@ -0,0 +1,125 @@
+package inference
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResultFormatVersion is the version of the TestResult format, described by test_result.schema.json.
+// Bump it on every change of the result fields
+const ResultFormatVersion = "1.7"
+
+// Git SHA and dirty flag (number of changed lines) of the build, set by the Makefile
+// with -ldflags "-X github.com/RedisAI/aibench/inference.GitSHA1=..."
+var GitSHA1 = ""
+var GitDirty = "0"
+
+// ClientHostInfo describes the host the benchmark client ran on
+type ClientHostInfo struct {
+	Hostname      string `json:"Hostname"`
+	OS            string `json:"OS"`
+	Arch          string `json:"Arch"`
+	GoVersion     string `json:"GoVersion"`
+	NumCPU        int    `json:"NumCPU"`
+	CPUModel      string `json:"CPUModel"`      // empty when unknown
+	MemTotalBytes uint64 `json:"MemTotalBytes"` // 0 when unknown
+}
+
+// ModelConfig describes a model set on a target server, as reported by the server
+type ModelConfig struct {
+	Host         string   `json:"Host"`
+	Key          string   `json:"Key"`
+	Backend      string   `json:"Backend"`
+	Device       string   `json:"Device"`
+	Tag          string   `json:"Tag"`
+	BatchSize    int64    `json:"BatchSize"`
+	MinBatchSize int64    `json:"MinBatchSize"`
+	Inputs       []string `json:"Inputs"`
+	Outputs      []string `json:"Outputs"`
+}
+
+// gitDirty reports whether the build had uncommitted changes
+func gitDirty() bool {
+	dirtyLines, err := strconv.Atoi(GitDirty)
+	return err == nil && dirtyLines != 0
+}
+
+// getClientHostInfo collects the client host info. The CPU model and the memory size are read
+// from /proc, so they are only known on Linux
+func getClientHostInfo() ClientHostInfo {
+	info := ClientHostInfo{
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		NumCPU:    runtime.NumCPU(),
+	}
+	info.Hostname, _ = os.Hostname()
+	if value, ok := procValue("/proc/cpuinfo", "model name"); ok {
+		info.CPUModel = value
+	}
+	if value, ok := procValue("/proc/meminfo", "MemTotal"); ok {
+		kb, err := strconv.ParseUint(strings.TrimSuffix(value, " kB"), 10, 64)
+		if err == nil {
+			info.MemTotalBytes = kb * 1024
+		}
+	}
+	return info
+}
+
+// procValue returns the value of the first "key: value" line of a /proc file with the given key
+func procValue(fileName string, key string) (string, bool) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == key {
+			return strings.TrimSpace(kv[1]), true
+		}
+	}
+	return "", false
+}
+
+// ParseRedisInfo parses a Redis INFO reply into its fields, skipping the section headers
+func ParseRedisInfo(info string) map[string]interface{} {
+	fields := map[string]interface{}{}
+	for _, line := range strings.Split(info, "\r\n") {
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	return fields
+}
+
+// FetchServerInfo reads the JSON document served at url, e.g. the version endpoint of a model
+// server, to be recorded with SetServerInfo
+func FetchServerInfo(url string, timeout time.Duration) (map[string]interface{}, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", url, resp.Status)
+	}
+	info := map[string]interface{}{}
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("GET %s: %v", url, err)
+	}
+	return info, nil
+}
@@ -0,0 +1,32 @@
+package inference
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchServerInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			_, _ = w.Write([]byte(`{"flask": "1.1.2", "tensorflow": "2.3.0"}`))
+		case "/invalid":
+			_, _ = w.Write([]byte(`not json`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	info, err := FetchServerInfo(server.URL+"/version", time.Second)
+	if err != nil || info["tensorflow"] != "2.3.0" {
+		t.Errorf("FetchServerInfo() = %v, %v, want the tensorflow version 2.3.0", info, err)
+	}
+	for _, path := range []string{"/invalid", "/missing"} {
+		if _, err = FetchServerInfo(server.URL+path, time.Second); err == nil {
+			t.Errorf("FetchServerInfo(%s) expected an error", path)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package inference
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+	"syscall"
+)
+
+// ErrorKind classifies why an inference request failed
+type ErrorKind string
+
+const (
+	ErrorKindConnection  ErrorKind = "connection"   // the server could not be reached, or the connection broke
+	ErrorKindServer      ErrorKind = "server"       // the server replied with an error
+	ErrorKindTimeout     ErrorKind = "timeout"      // the request exceeded its deadline, accounted as timed out rather than failed
+	ErrorKindBadResponse ErrorKind = "bad_response" // the reply could not be decoded, or was not the expected one
+	ErrorKindClient      ErrorKind = "client"       // the request could not be built on the client side
+)
+
+// InferenceError is the error processors return for a failed request, so that
+// failures are accounted per kind
+type InferenceError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *InferenceError) Error() string {
+	return fmt.Sprintf("%s error: %v", e.Kind, e.Err)
+}
+
+func (e *InferenceError) Unwrap() error {
+	return e.Err
+}
+
+// NewConnectionError wraps err as a connection error
+func NewConnectionError(err error) error {
+	return &InferenceError{Kind: ErrorKindConnection, Err: err}
+}
+
+// NewServerError wraps err as a server side error
+func NewServerError(err error) error {
+	return &InferenceError{Kind: ErrorKindServer, Err: err}
+}
+
+// NewTimeoutError wraps err as a timeout
+func NewTimeoutError(err error) error {
+	return &InferenceError{Kind: ErrorKindTimeout, Err: err}
+}
+
+// NewBadResponseError wraps err as a bad response error
+func NewBadResponseError(err error) error {
+	return &InferenceError{Kind: ErrorKindBadResponse, Err: err}
+}
+
+// NewClientError wraps err as a client side error, e.g. on building the request
+func NewClientError(err error) error {
+	return &InferenceError{Kind: ErrorKindClient, Err: err}
+}
+
+// ErrorKindOf returns the kind of a processor error. Errors that are not an InferenceError
+// are classified as timeouts or connection errors when possible, and as server errors otherwise
+func ErrorKindOf(err error) ErrorKind {
+	var inferenceErr *InferenceError
+	if errors.As(err, &inferenceErr) {
+		return inferenceErr.Kind
+	}
+	if IsTimeout(err) {
+		return ErrorKindTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) {
+		return ErrorKindConnection
+	}
+	return ErrorKindServer
+}
+
+// RadixError classifies a failed radix request: error replies are server errors, anything else a connection error
+func RadixError(err error) error {
+	var serverErr resp2.Error
+	if errors.As(err, &serverErr) {
+		return NewServerError(err)
+	}
+	return NewConnectionError(err)
+}
+
+// GoRedisError classifies a failed go-redis request, e.g. a reference data fetch: a missing key is a
+// bad response, error replies are server errors, anything else a connection error
+func GoRedisError(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return NewBadResponseError(fmt.Errorf("key not found: %w", err))
+	}
+	var serverErr redis.Error
+	if errors.As(err, &serverErr) {
+		return NewServerError(err)
+	}
+	return NewConnectionError(err)
+}
+
+// GRPCError classifies a failed gRPC call by the status code of err, or of the error it wraps:
+// an exceeded deadline is a timeout, an unavailable server or a canceled call are connection errors,
+// anything else a server error
+func GRPCError(err error) error {
+	code := status.Code(err)
+	if code == codes.Unknown {
+		code = status.Code(errors.Unwrap(err))
+	}
+	switch code {
+	case codes.DeadlineExceeded:
+		return NewTimeoutError(err)
+	case codes.Unavailable, codes.Canceled:
+		return NewConnectionError(err)
+	default:
+		return NewServerError(err)
+	}
+}
@@ -0,0 +1,61 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"syscall"
+	"testing"
+)
+
+func TestErrorKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"typed", NewBadResponseError(errors.New("unexpected reply")), ErrorKindBadResponse},
+		{"wrapped typed", fmt.Errorf("request failed: %w", NewConnectionError(io.EOF)), ErrorKindConnection},
+		{"deadline", context.DeadlineExceeded, ErrorKindTimeout},
+		{"eof", io.EOF, ErrorKindConnection},
+		{"refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), ErrorKindConnection},
+		{"other", errors.New("ERR model not found"), ErrorKindServer},
+		{"grpc deadline exceeded", GRPCError(fmt.Errorf("Prediction failed: %w", status.Error(codes.DeadlineExceeded, "context deadline exceeded"))), ErrorKindTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorKindOf(tt.err); got != tt.want {
+				t.Errorf("ErrorKindOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientErrorClassifiers(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"radix error reply", RadixError(fmt.Errorf("DAGRUN failed: %w", resp2.Error{E: errors.New("ERR model key is empty")})), ErrorKindServer},
+		{"radix broken connection", RadixError(io.EOF), ErrorKindConnection},
+		{"go-redis missing key", GoRedisError(redis.Nil), ErrorKindBadResponse},
+		{"go-redis refused", GoRedisError(fmt.Errorf("dial: %w", syscall.ECONNREFUSED)), ErrorKindConnection},
+		{"grpc unavailable", GRPCError(status.Error(codes.Unavailable, "connection refused")), ErrorKindConnection},
+		{"wrapped grpc unavailable", GRPCError(fmt.Errorf("Prediction failed: %w", status.Error(codes.Unavailable, ""))), ErrorKindConnection},
+		{"grpc not found", GRPCError(fmt.Errorf("Prediction failed: %w", status.Error(codes.NotFound, "no model"))), ErrorKindServer},
+		{"grpc deadline exceeded", GRPCError(fmt.Errorf("Prediction failed: %w", status.Error(codes.DeadlineExceeded, "context deadline exceeded"))), ErrorKindTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorKindOf(tt.err); got != tt.want {
+				t.Errorf("ErrorKindOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
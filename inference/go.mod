@@ -4,6 +4,10 @@ go 1.15
 
 require (
 	github.com/HdrHistogram/hdrhistogram-go v1.0.0
+	github.com/go-redis/redis/v8 v8.0.0-beta.12
+	github.com/mediocregopher/radix/v3 v3.5.2
 	github.com/prometheus/common v0.4.0
 	golang.org/x/time v0.0.0-20200630173020-3af7569d3a1e
+	google.golang.org/grpc v1.32.0
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,342 @@
+package inference
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Output validation modes, see -golden-mode
+const (
+	// GoldenModeTop1 compares the top-1 class of each inference output
+	GoldenModeTop1 = "top1"
+	// GoldenModeTensor compares each value of the output tensors, within -golden-tolerance
+	GoldenModeTensor = "tensor"
+	// GoldenModeLabels compares the top-1 class of each inference to the labelled class of its row,
+	// out of a GoldenLabelsHeader golden file. It checks the model accuracy rather than the server outputs
+	GoldenModeLabels = "labels"
+)
+
+// GoldenLabelsHeader is the first line of the golden files holding the labelled classes of the rows,
+// one-hot encoded, e.g. as written by aibench_generate_data, instead of the outputs of a reference run
+const GoldenLabelsHeader = "# labels"
+
+// ValidationResult is the outcome of the model outputs validation against the golden outputs of a
+// -golden-file run, counted by inference
+type ValidationResult struct {
+	GoldenFile string  `json:"GoldenFile"`
+	Mode       string  `json:"Mode"`
+	Tolerance  float64 `json:"Tolerance"`
+	// Validated is the number of inferences compared to their golden output
+	Validated uint64 `json:"Validated"`
+	// Mismatches is the number of validated inferences whose output differs from the golden one
+	Mismatches uint64 `json:"Mismatches"`
+	// Unvalidated is the number of inferences without a golden output, or whose output the runner doesn't decode
+	Unvalidated uint64 `json:"Unvalidated"`
+	// Accuracy is the fraction of the validated inferences matching their golden output, the model
+	// accuracy on GoldenModeLabels
+	Accuracy float64 `json:"Accuracy"`
+}
+
+// outputValidator checks the model outputs against the golden outputs of the input rows, and records
+// them on -golden-out-file runs. Rows are matched by their payload, so that the outputs are matched
+// whatever the order the workers process the rows in, and on runs looping over the input
+type outputValidator struct {
+	mode             string
+	tolerance        float64
+	inferencesPerRow int64
+
+	golden map[uint64][]float32
+
+	// outputs of the run, by row, kept on -golden-out-file runs
+	record    bool
+	outputsMu sync.Mutex
+	outputs   map[uint64][]float32
+
+	validated   uint64
+	mismatches  uint64
+	unvalidated uint64
+}
+
+// rowHash returns the key the row payload is matched by
+func rowHash(payload []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(payload)
+	return h.Sum64()
+}
+
+// readRows calls fn on each complete row of the input file, in order
+func readRows(fileName string, rowSizeBytes int, fn func(row []byte) error) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	row := make([]byte, rowSizeBytes)
+	for {
+		if _, err := io.ReadFull(r, row); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// parseGoldenLine parses a golden file line, the comma separated values of the expected output.
+// Empty lines are rows without an expected output
+func parseGoldenLine(line string) ([]float32, error) {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 {
+		return nil, nil
+	}
+	fields := strings.Split(line, ",")
+	values := make([]float32, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 32)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = float32(value)
+	}
+	return values, nil
+}
+
+// formatGoldenLine formats an output as a golden file line
+func formatGoldenLine(output []float32) string {
+	fields := make([]string, len(output))
+	for i, value := range output {
+		fields[i] = strconv.FormatFloat(float64(value), 'g', -1, 32)
+	}
+	return strings.Join(fields, ",")
+}
+
+// newOutputValidator returns the validator of the outputs of the rows of inputFile against goldenFile,
+// whose lines are the expected outputs of the input rows, in order. goldenFile may be empty when the
+// outputs are only recorded. The golden files starting with GoldenLabelsHeader hold the labelled
+// classes of the rows, which are only compared on their top-1 class, on GoldenModeLabels
+func newOutputValidator(inputFile string, rowSizeBytes int, inferencesPerRow int64, goldenFile string, mode string, tolerance float64, record bool) (*outputValidator, error) {
+	if mode != GoldenModeTop1 && mode != GoldenModeTensor && mode != GoldenModeLabels {
+		return nil, fmt.Errorf("unknown golden mode %q, expected %s, %s or %s", mode, GoldenModeTop1, GoldenModeTensor, GoldenModeLabels)
+	}
+	v := &outputValidator{mode: mode, tolerance: tolerance, inferencesPerRow: inferencesPerRow, record: record}
+	if record {
+		v.outputs = map[uint64][]float32{}
+	}
+	if len(goldenFile) == 0 {
+		return v, nil
+	}
+	file, err := os.Open(goldenFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	lines := bufio.NewScanner(file)
+	lines.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	v.golden = map[uint64][]float32{}
+	// the first line is either the labels header or the golden output of the first row
+	pending := lines.Scan()
+	labels := pending && strings.TrimSpace(lines.Text()) == GoldenLabelsHeader
+	switch {
+	case labels && mode == GoldenModeTensor:
+		return nil, fmt.Errorf("%s holds the labelled classes of the rows, not the outputs of a reference run, which can only be compared on their top-1 class", goldenFile)
+	case labels:
+		v.mode = GoldenModeLabels
+		pending = false
+	case mode == GoldenModeLabels:
+		return nil, fmt.Errorf("%s holds no labels, its first line is not %q", goldenFile, GoldenLabelsHeader)
+	}
+	rowNum := 0
+	err = readRows(inputFile, rowSizeBytes, func(row []byte) error {
+		rowNum++
+		if !pending && !lines.Scan() {
+			if err := lines.Err(); err != nil {
+				return err
+			}
+			return io.EOF
+		}
+		pending = false
+		expected, err := parseGoldenLine(lines.Text())
+		if err != nil {
+			lineNum := rowNum
+			if labels {
+				lineNum++
+			}
+			return fmt.Errorf("%s line %d: %v", goldenFile, lineNum, err)
+		}
+		key := rowHash(row)
+		if _, ok := v.golden[key]; !ok && expected != nil {
+			v.golden[key] = expected
+		}
+		return nil
+	})
+	if err == io.EOF {
+		err = fmt.Errorf("%s has less lines than the %d rows of %s", goldenFile, rowNum, inputFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// check validates the output of a request on row payload, returning the number of mismatching inferences
+func (v *outputValidator) check(payload []byte, output []float32) uint64 {
+	key := rowHash(payload)
+	if v.record && output != nil {
+		v.outputsMu.Lock()
+		if _, ok := v.outputs[key]; !ok {
+			v.outputs[key] = output
+		}
+		v.outputsMu.Unlock()
+	}
+	if v.golden == nil {
+		return 0
+	}
+	inferences := uint64(1)
+	if v.inferencesPerRow > 1 {
+		inferences = uint64(v.inferencesPerRow)
+	}
+	expected, ok := v.golden[key]
+	if !ok || output == nil {
+		atomic.AddUint64(&v.unvalidated, inferences)
+		return 0
+	}
+	mismatches := v.compare(expected, output, inferences)
+	atomic.AddUint64(&v.validated, inferences)
+	atomic.AddUint64(&v.mismatches, mismatches)
+	return mismatches
+}
+
+// compare returns the number of inferences whose output differs from the expected one. The outputs
+// of a row batching several inferences are split evenly among them, when possible, and otherwise
+// compared as a whole
+func (v *outputValidator) compare(expected []float32, output []float32, inferences uint64) uint64 {
+	if len(expected) != len(output) {
+		return inferences
+	}
+	if len(expected)%int(inferences) != 0 {
+		if !v.matches(expected, output) {
+			return inferences
+		}
+		return 0
+	}
+	size := len(expected) / int(inferences)
+	var mismatches uint64
+	for start := 0; start < len(expected); start += size {
+		if !v.matches(expected[start:start+size], output[start:start+size]) {
+			mismatches++
+		}
+	}
+	return mismatches
+}
+
+func (v *outputValidator) matches(expected []float32, output []float32) bool {
+	if v.mode == GoldenModeTop1 || v.mode == GoldenModeLabels {
+		return argmax(expected) == argmax(output)
+	}
+	for i := range expected {
+		if math.Abs(float64(expected[i])-float64(output[i])) > v.tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func argmax(values []float32) int {
+	best := -1
+	for i, value := range values {
+		if best < 0 || value > values[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// result returns the validation outcome, nil when no golden file was given
+func (v *outputValidator) result(goldenFile string) *ValidationResult {
+	if v.golden == nil {
+		return nil
+	}
+	result := &ValidationResult{
+		GoldenFile:  goldenFile,
+		Mode:        v.mode,
+		Tolerance:   v.tolerance,
+		Validated:   atomic.LoadUint64(&v.validated),
+		Mismatches:  atomic.LoadUint64(&v.mismatches),
+		Unvalidated: atomic.LoadUint64(&v.unvalidated),
+	}
+	if result.Validated > 0 {
+		result.Accuracy = float64(result.Validated-result.Mismatches) / float64(result.Validated)
+	}
+	return result
+}
+
+// writeGolden writes the recorded outputs as a golden file of the rows of inputFile, in order, with an
+// empty line for the rows without a recorded output. It returns the number of rows with an output
+func (v *outputValidator) writeGolden(inputFile string, rowSizeBytes int, goldenOutFile string) (int, error) {
+	file, err := os.Create(goldenOutFile)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(file)
+	recorded := 0
+	err = readRows(inputFile, rowSizeBytes, func(row []byte) error {
+		output, ok := v.outputs[rowHash(row)]
+		if ok {
+			recorded++
+		}
+		_, err := fmt.Fprintln(w, formatGoldenLine(output))
+		return err
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return recorded, err
+}
+
+// DecodeJSONOutputs returns the values of the "outputs" field of a JSON inference reply, flattened,
+// e.g. {"outputs": [[0.88, 0.11]]}
+func DecodeJSONOutputs(body []byte) ([]float32, error) {
+	var reply struct {
+		Outputs interface{} `json:"outputs"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, err
+	}
+	var values []float32
+	var flatten func(value interface{}) error
+	flatten = func(value interface{}) error {
+		switch v := value.(type) {
+		case float64:
+			values = append(values, float32(v))
+		case []interface{}:
+			for _, item := range v {
+				if err := flatten(item); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unexpected outputs value %v", value)
+		}
+		return nil
+	}
+	if err := flatten(reply.Outputs); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
@@ -0,0 +1,115 @@
+package inference
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOutputValidator(t *testing.T) {
+	dir := t.TempDir()
+	inputFile := filepath.Join(dir, "input")
+	goldenFile := filepath.Join(dir, "golden")
+	// three rows of two bytes, each batching two inferences of two classes
+	if err := ioutil.WriteFile(inputFile, []byte("aabbcc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(goldenFile, []byte("0.9,0.1,0.2,0.8\n\n0.5,0.25,0.25,0.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mode       string
+		row        string
+		output     []float32
+		mismatches uint64
+	}{
+		{GoldenModeTop1, "aa", []float32{0.6, 0.4, 0.3, 0.7}, 0},
+		{GoldenModeTop1, "aa", []float32{0.4, 0.6, 0.3, 0.7}, 1},
+		{GoldenModeTop1, "aa", []float32{0.4, 0.6}, 2},
+		{GoldenModeTensor, "cc", []float32{0.5, 0.25, 0.25, 0.5}, 0},
+		{GoldenModeTensor, "cc", []float32{0.5, 0.25, 0.25, 0.6}, 1},
+	}
+	for _, tt := range tests {
+		v, err := newOutputValidator(inputFile, 2, 2, goldenFile, tt.mode, 1e-3, false)
+		if err != nil {
+			t.Fatalf("newOutputValidator() error = %v", err)
+		}
+		if got := v.check([]byte(tt.row), tt.output); got != tt.mismatches {
+			t.Errorf("%s check(%s, %v) = %d, want %d", tt.mode, tt.row, tt.output, got, tt.mismatches)
+		}
+	}
+
+	v, err := newOutputValidator(inputFile, 2, 2, goldenFile, GoldenModeTop1, 0, true)
+	if err != nil {
+		t.Fatalf("newOutputValidator() error = %v", err)
+	}
+	v.check([]byte("aa"), []float32{0.6, 0.4, 0.7, 0.3})
+	v.check([]byte("bb"), []float32{1, 0, 0, 1})
+	v.check([]byte("cc"), nil)
+	want := &ValidationResult{GoldenFile: goldenFile, Mode: GoldenModeTop1, Validated: 2, Mismatches: 1, Unvalidated: 4, Accuracy: 0.5}
+	if got := v.result(goldenFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("result() = %+v, want %+v", got, want)
+	}
+
+	goldenOutFile := filepath.Join(dir, "golden_out")
+	recorded, err := v.writeGolden(inputFile, 2, goldenOutFile)
+	if err != nil {
+		t.Fatalf("writeGolden() error = %v", err)
+	}
+	data, _ := ioutil.ReadFile(goldenOutFile)
+	if recorded != 2 || string(data) != "0.6,0.4,0.7,0.3\n1,0,0,1\n\n" {
+		t.Errorf("writeGolden() = %d rows:\n%s", recorded, data)
+	}
+
+	if err := ioutil.WriteFile(goldenFile, []byte("1,0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = newOutputValidator(inputFile, 2, 1, goldenFile, GoldenModeTop1, 0, false); err == nil || !strings.Contains(err.Error(), "less lines") {
+		t.Errorf("newOutputValidator() on a short golden file error = %v", err)
+	}
+}
+
+func TestOutputValidatorLabels(t *testing.T) {
+	dir := t.TempDir()
+	inputFile := filepath.Join(dir, "input")
+	labelsFile := filepath.Join(dir, "labels")
+	if err := ioutil.WriteFile(inputFile, []byte("aabb"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(labelsFile, []byte(GoldenLabelsHeader+"\n1,0\n0,1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newOutputValidator(inputFile, 2, 1, labelsFile, GoldenModeTensor, 1e-3, false); err == nil || !strings.Contains(err.Error(), "labelled classes") {
+		t.Errorf("newOutputValidator() on tensor mode of a labels file error = %v", err)
+	}
+	v, err := newOutputValidator(inputFile, 2, 1, labelsFile, GoldenModeTop1, 0, false)
+	if err != nil {
+		t.Fatalf("newOutputValidator() error = %v", err)
+	}
+	v.check([]byte("aa"), []float32{0.9, 0.1})
+	v.check([]byte("bb"), []float32{0.6, 0.4})
+	want := &ValidationResult{GoldenFile: labelsFile, Mode: GoldenModeLabels, Validated: 2, Mismatches: 1, Accuracy: 0.5}
+	if got := v.result(labelsFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("result() = %+v, want %+v", got, want)
+	}
+
+	if err := ioutil.WriteFile(labelsFile, []byte("1,0\n0,1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = newOutputValidator(inputFile, 2, 1, labelsFile, GoldenModeLabels, 0, false); err == nil || !strings.Contains(err.Error(), "no labels") {
+		t.Errorf("newOutputValidator() on labels mode of a reference outputs file error = %v", err)
+	}
+}
+
+func TestDecodeJSONOutputs(t *testing.T) {
+	got, err := DecodeJSONOutputs([]byte(`{"outputs": [[0.875, 0.125]]}`))
+	if err != nil || !reflect.DeepEqual(got, []float32{0.875, 0.125}) {
+		t.Errorf("DecodeJSONOutputs() = %v, %v", got, err)
+	}
+	if _, err = DecodeJSONOutputs([]byte(`{"outputs": ["a"]}`)); err == nil {
+		t.Errorf("DecodeJSONOutputs() on a non numeric output returned no error")
+	}
+}
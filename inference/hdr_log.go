@@ -0,0 +1,81 @@
+package inference
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"os"
+	"time"
+)
+
+// hdrLogMaxValueUnitRatio scales the interval max values, recorded in microseconds, to milliseconds
+const hdrLogMaxValueUnitRatio = 1000.0
+
+// hdrLog writes the HdrHistogram interval log format, one line per interval histogram:
+//
+//	[Tag=TAG,]START_SECONDS,INTERVAL_SECONDS,MAX_MILLISECONDS,BASE64_COMPRESSED_HISTOGRAM
+//
+// with the interval start relative to the log start time.
+type hdrLog struct {
+	file   *os.File
+	w      *bufio.Writer
+	writer *hdrhistogram.HistogramLogWriter
+	start  time.Time
+}
+
+// newHdrLog creates the interval log file and writes its header
+func newHdrLog(fileName string, start time.Time) (*hdrLog, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	l := &hdrLog{file: file, w: bufio.NewWriter(file), start: start}
+	l.writer = hdrhistogram.NewHistogramLogWriter(l.w)
+	startSeconds := float64(start.UnixNano()) / 1e9
+	if err = l.writer.OutputComment("Logged with aibench"); err == nil {
+		err = l.writer.OutputLogFormatVersion()
+	}
+	if err == nil {
+		_, err = fmt.Fprintf(l.w, "#[StartTime: %.3f (seconds since epoch), %s]\n", startSeconds, start.Format(time.RFC3339))
+	}
+	if err == nil {
+		_, err = fmt.Fprintf(l.w, "#[BaseTime: %.3f (seconds since epoch)]\n", startSeconds)
+	}
+	if err == nil {
+		err = l.writer.OutputLegend()
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// writeInterval writes the histogram of the [from, to) interval, tagged when tag is not empty.
+// Tags can't contain commas, spaces or line breaks
+func (l *hdrLog) writeInterval(tag string, from, to time.Time, histogram *hdrhistogram.Histogram) error {
+	encoded, err := histogram.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err != nil {
+		return err
+	}
+	tagStr := ""
+	if len(tag) > 0 {
+		tagStr = "Tag=" + tag + ","
+	}
+	_, err = fmt.Fprintf(l.w, "%s%.3f,%.3f,%.3f,%s\n",
+		tagStr,
+		from.Sub(l.start).Seconds(),
+		to.Sub(from).Seconds(),
+		float64(histogram.Max())/hdrLogMaxValueUnitRatio,
+		encoded)
+	return err
+}
+
+// close flushes and closes the interval log file
+func (l *hdrLog) close() error {
+	err := l.w.Flush()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
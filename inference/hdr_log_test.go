@@ -0,0 +1,87 @@
+package inference
+
+import (
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHdrLog(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "run.hlog")
+	start := time.Now()
+	l, err := newHdrLog(fileName, start)
+	if err != nil {
+		t.Fatalf("newHdrLog() error = %v", err)
+	}
+	histogram := hdrhistogram.New(1, 30000000, 3)
+	for _, value := range []int64{1000, 2000, 3000} {
+		_ = histogram.RecordValue(value)
+	}
+	if err = l.writeInterval("", start, start.Add(time.Second), histogram); err != nil {
+		t.Fatalf("writeInterval() error = %v", err)
+	}
+	if err = l.writeInterval("phase:serialize", start, start.Add(time.Second), histogram); err != nil {
+		t.Fatalf("writeInterval() error = %v", err)
+	}
+	if err = l.close(); err != nil {
+		t.Fatalf("close() error = %v", err)
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader := hdrhistogram.NewHistogramLogReader(file)
+	for _, wantTag := range []string{"", "phase:serialize"} {
+		got, err := reader.NextIntervalHistogram()
+		if err != nil || got == nil {
+			t.Fatalf("NextIntervalHistogram() = %v, %v", got, err)
+		}
+		if got.Tag() != wantTag || got.TotalCount() != 3 || got.ValueAtQuantile(50) != 2000 {
+			t.Errorf("read histogram tag %q with %d values and median %d, want tag %q with 3 values and median 2000", got.Tag(), got.TotalCount(), got.ValueAtQuantile(50), wantTag)
+		}
+	}
+}
+
+func TestReportLogsTheLastPartialInterval(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "run.hlog")
+	start := time.Now()
+	l, err := newHdrLog(fileName, start)
+	if err != nil {
+		t.Fatalf("newHdrLog() error = %v", err)
+	}
+	limit := uint64(0)
+	b := &BenchmarkRunner{liveMetrics: newLiveMetrics(), sp: &statProcessor{limit: &limit}, hdrLog: l}
+	b.sp.start(1, false)
+	for _, value := range []int64{1000, 2000, 3000} {
+		b.sp.sendStats([]*Stat{GetStat().Init([]byte("q"), value, 1, false, "")})
+	}
+	b.sp.CloseAndWait()
+
+	// the run ends long before the first reporting period
+	done := make(chan struct{})
+	close(done)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	b.report(time.Hour, start, map[int64]interface{}{}, done, &wg)
+	if err = l.close(); err != nil {
+		t.Fatalf("close() error = %v", err)
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	got, err := hdrhistogram.NewHistogramLogReader(file).NextIntervalHistogram()
+	if err != nil || got == nil {
+		t.Fatalf("NextIntervalHistogram() = %v, %v, want the last partial interval", got, err)
+	}
+	if got.TotalCount() != 3 {
+		t.Errorf("last interval holds %d values, want 3", got.TotalCount())
+	}
+}
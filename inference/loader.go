@@ -2,8 +2,10 @@ package inference
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"sync"
@@ -15,10 +17,13 @@ import (
 // program against a database.
 type LoadRunner struct {
 	// flag fields
-	limit    uint64
-	workers  uint
-	fileName string
-	debug    int
+	limit        uint64
+	workers      uint
+	fileName     string
+	debug        int
+	configFile   string
+	jsonOutFile  string
+	ignoreErrors bool
 
 	// non-flag fields
 	br              *bufio.Reader
@@ -42,15 +47,41 @@ func NewLoadRunner() *LoadRunner {
 	flag.StringVar(&runner.fileName, "file", "", "File name to read queries from")
 	flag.IntVar(&runner.debug, "debug", 0, "Whether to print debug messages.")
 	flag.DurationVar(&runner.reportingPeriod, "reporting-period", 1*time.Second, "Period to report write stats")
+	flag.BoolVar(&runner.ignoreErrors, "ignore-errors", false, "Whether to ignore the server runtime stats errors and continue. By default on error the load stops (default false).")
+	flag.StringVar(&runner.jsonOutFile, "json-out-file", "", "Name of json output file to output the load results, including the server runtime stats. If not set, will not print to json.")
+	registerConfigFlag(&runner.configFile)
 
 	return runner
 }
 
+// LoadResult holds the results of a load, saved on -json-out-file
+type LoadResult struct {
+	StartTime      int64  `json:"StartTime"`
+	EndTime        int64  `json:"EndTime"`
+	DurationMillis int64  `json:"DurationMillis"`
+	Commands       uint64 `json:"Commands"`
+	Interrupted    bool   `json:"Interrupted"`
+
+	// Per second ( tick ) server stats
+	ServerRunTimeStats map[int64]interface{} `json:"ServerRunTimeStats"`
+}
+
+// ParseFlags parses the command line flags, setting the ones not given on it from the -config file.
+// Loaders call it instead of flag.Parse
+func (b *LoadRunner) ParseFlags() {
+	parseFlags(&b.configFile)
+}
+
 // SetLimit changes the number of queries to run, with 0 being all of them
 func (b *LoadRunner) SetLimit(limit uint64) {
 	b.limit = limit
 }
 
+// CommandCount returns the number of commands issued so far
+func (b *LoadRunner) CommandCount() uint64 {
+	return atomic.LoadUint64(&b.commandCount)
+}
+
 // LoaderCreate is a function that creates a new Loader (called in Run)
 type LoaderCreate func() Loader
 
@@ -87,7 +118,8 @@ func (b *LoadRunner) GetBufferedReader() *bufio.Reader {
 // Run does the bulk of the benchmark execution.
 // It launches a gorountine to track stats, creates workers to process queries,
 // read in the input, execute the queries, and then does cleanup.
-func (b *LoadRunner) RunLoad(queryPool *sync.Pool, LoaderCreateFn LoaderCreate, rowBenchmarkNBytes int) {
+// The server runtime stats are collected on each reporting period when metricCollectorFn is not nil
+func (b *LoadRunner) RunLoad(queryPool *sync.Pool, LoaderCreateFn LoaderCreate, rowBenchmarkNBytes int, metricCollectorFn MetricCollectorCreate) {
 
 	if b.workers == 0 {
 		panic("must have at least one worker")
@@ -95,7 +127,7 @@ func (b *LoadRunner) RunLoad(queryPool *sync.Pool, LoaderCreateFn LoaderCreate,
 	b.ch = make(chan []byte, b.workers)
 
 	// Launch the stats processor:
-	go b.sp.process(b.workers, false)
+	b.sp.start(b.workers, false)
 
 	// Launch inference processors
 	var wg sync.WaitGroup
@@ -112,14 +144,32 @@ func (b *LoadRunner) RunLoad(queryPool *sync.Pool, LoaderCreateFn LoaderCreate,
 	if b.reportingPeriod.Nanoseconds() > 0 {
 		go b.report(b.reportingPeriod, wallStart)
 	}
+	serverRunTimeStats := make(map[int64]interface{})
+	collectingDone := make(chan struct{})
+	var collectingWg sync.WaitGroup
+	if metricCollectorFn != nil && b.reportingPeriod.Nanoseconds() > 0 {
+		collectingWg.Add(1)
+		go collectRunTimeStats(b.reportingPeriod, metricCollectorFn(), serverRunTimeStats, b.ignoreErrors, collectingDone, &collectingWg)
+	}
 
 	br := b.scanner.setReader(b.GetBufferedReader())
+	interrupted := int32(0)
+	stopSignals := notifyOnInterrupt(func(os.Signal) {
+		atomic.StoreInt32(&interrupted, 1)
+		br.stop()
+	})
 	_ = br.produce(queryPool, b.ch, rowBenchmarkNBytes, 1, b.debug)
 	close(b.ch)
 
 	// Block for workers to finish sending requests, closing the stats channel when done:
 	wg.Wait()
 	b.sp.CloseAndWait()
+	stopSignals()
+	close(collectingDone)
+	collectingWg.Wait()
+	if atomic.LoadInt32(&interrupted) != 0 {
+		fmt.Printf("Load interrupted after %d commands\n", atomic.LoadUint64(&b.commandCount))
+	}
 
 	// Wall clock end time
 	wallEnd := time.Now()
@@ -129,6 +179,25 @@ func (b *LoadRunner) RunLoad(queryPool *sync.Pool, LoaderCreateFn LoaderCreate,
 		log.Fatal(err)
 	}
 
+	if len(b.jsonOutFile) > 0 {
+		result := LoadResult{
+			StartTime:          wallStart.Unix(),
+			EndTime:            wallEnd.Unix(),
+			DurationMillis:     wallTook.Milliseconds(),
+			Commands:           atomic.LoadUint64(&b.commandCount),
+			Interrupted:        atomic.LoadInt32(&interrupted) != 0,
+			ServerRunTimeStats: serverRunTimeStats,
+		}
+		_, _ = fmt.Printf("Saving JSON results to %s\n", b.jsonOutFile)
+		file, err := json.MarshalIndent(result, "", " ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = ioutil.WriteFile(b.jsonOutFile, file, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 }
 
 func (b *LoadRunner) loadHandler(wg *sync.WaitGroup, queryPool *sync.Pool, processor Loader, workerNum int) {
@@ -0,0 +1,148 @@
+package inference
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// metricsQuantiles maps the generateQuantileMap keys to the Prometheus quantile label values
+var metricsQuantiles = []struct {
+	key   string
+	label string
+}{
+	{"q0", "0"},
+	{"q50", "0.5"},
+	{"q95", "0.95"},
+	{"q99", "0.99"},
+	{"q999", "0.999"},
+	{"q100", "1"},
+}
+
+// liveMetrics holds the client metrics of the last reporting period, and the
+// cumulative counts not kept elsewhere, exposed on -metrics-listen-addr
+type liveMetrics struct {
+	mu            sync.Mutex
+	inferenceRate float64
+	quantiles     map[string]float64
+	timedOut      uint64
+	errorsByKind  map[ErrorKind]uint64
+}
+
+func newLiveMetrics() *liveMetrics {
+	return &liveMetrics{
+		quantiles:    map[string]float64{},
+		errorsByKind: map[ErrorKind]uint64{},
+	}
+}
+
+// setPeriod stores the inference rate and latency quantiles of the last reporting period
+func (m *liveMetrics) setPeriod(inferenceRate float64, quantiles map[string]float64) {
+	m.mu.Lock()
+	m.inferenceRate = inferenceRate
+	m.quantiles = quantiles
+	m.mu.Unlock()
+}
+
+// addResponse accounts a request outcome
+func (m *liveMetrics) addResponse(resp *InferenceResponse) {
+	if resp.Err == nil && !resp.TimedOut {
+		return
+	}
+	m.mu.Lock()
+	if resp.Err != nil {
+		m.errorsByKind[resp.Err.Kind]++
+	} else {
+		m.timedOut++
+	}
+	m.mu.Unlock()
+}
+
+// serveMetrics starts the HTTP server exposing the client metrics in the Prometheus text format on /metrics
+func (b *BenchmarkRunner) serveMetrics(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := b.writeMetrics(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error serving the metrics on %s: %v", addr, err)
+		}
+	}()
+	fmt.Printf("Serving the client metrics on http://%s/metrics\n", addr)
+	return server
+}
+
+// writeMetrics writes the client metrics in the Prometheus text format
+func (b *BenchmarkRunner) writeMetrics(w io.Writer) error {
+	b.liveMetrics.mu.Lock()
+	inferenceRate := b.liveMetrics.inferenceRate
+	quantiles := b.liveMetrics.quantiles
+	timedOut := b.liveMetrics.timedOut
+	kinds := make([]string, 0, len(b.liveMetrics.errorsByKind))
+	errorsByKind := make(map[string]uint64, len(b.liveMetrics.errorsByKind))
+	for kind, count := range b.liveMetrics.errorsByKind {
+		kinds = append(kinds, string(kind))
+		errorsByKind[string(kind)] = count
+	}
+	b.liveMetrics.mu.Unlock()
+	sort.Strings(kinds)
+
+	_, err := fmt.Fprintf(w, "# HELP aibench_inference_rate Inferences per second over the last reporting period.\n"+
+		"# TYPE aibench_inference_rate gauge\n"+
+		"aibench_inference_rate %g\n", inferenceRate)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "# HELP aibench_inferences_total Inferences done, including the warmup.\n"+
+		"# TYPE aibench_inferences_total counter\n"+
+		"aibench_inferences_total %d\n", atomic.LoadUint64(&b.inferenceCount))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "# HELP aibench_requests_total Inference requests sent.\n"+
+		"# TYPE aibench_requests_total counter\n"+
+		"aibench_requests_total %d\n", atomic.LoadUint64(&b.requestCount))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "# HELP aibench_timed_out_requests_total Inference requests that exceeded their deadline.\n"+
+		"# TYPE aibench_timed_out_requests_total counter\n"+
+		"aibench_timed_out_requests_total %d\n", timedOut)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "# HELP aibench_errors_total Inference requests that failed, by error kind.\n"+
+		"# TYPE aibench_errors_total counter\n")
+	if err != nil {
+		return err
+	}
+	for _, kind := range kinds {
+		_, err = fmt.Fprintf(w, "aibench_errors_total{kind=%q} %d\n", kind, errorsByKind[kind])
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "# HELP aibench_latency_milliseconds Inference latency quantiles over the last reporting period.\n"+
+		"# TYPE aibench_latency_milliseconds gauge\n")
+	if err != nil {
+		return err
+	}
+	for _, quantile := range metricsQuantiles {
+		if value, ok := quantiles[quantile.key]; ok {
+			_, err = fmt.Fprintf(w, "aibench_latency_milliseconds{quantile=%q} %g\n", quantile.label, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package inference
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	b := &BenchmarkRunner{liveMetrics: newLiveMetrics(), inferenceCount: 12, requestCount: 4}
+	b.liveMetrics.setPeriod(6, map[string]float64{"q50": 1.5, "q99": 3})
+	b.liveMetrics.addResponse(&InferenceResponse{TimedOut: true})
+	b.liveMetrics.addResponse(&InferenceResponse{Err: &InferenceError{Kind: ErrorKindServer, Err: errors.New("ERR")}})
+	b.liveMetrics.addResponse(&InferenceResponse{})
+
+	var out strings.Builder
+	if err := b.writeMetrics(&out); err != nil {
+		t.Fatalf("writeMetrics() error = %v", err)
+	}
+	for _, want := range []string{
+		"aibench_inference_rate 6\n",
+		"aibench_inferences_total 12\n",
+		"aibench_requests_total 4\n",
+		"aibench_timed_out_requests_total 1\n",
+		"aibench_errors_total{kind=\"server\"} 1\n",
+		"aibench_latency_milliseconds{quantile=\"0.5\"} 1.5\n",
+		"aibench_latency_milliseconds{quantile=\"0.99\"} 3\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("writeMetrics() output is missing %q:\n%s", want, out.String())
+		}
+	}
+}
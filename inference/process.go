@@ -0,0 +1,248 @@
+package inference
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicksPerSec is the unit of the /proc/<pid>/stat CPU times, USER_HZ, fixed to 100 by the Linux ABI
+const clockTicksPerSec = 100
+
+// processStatusFields are the /proc/<pid>/status fields kept by the processSampler, by stats name
+var processStatusFields = map[string]string{
+	"VmRSS":                      "rss_bytes",
+	"Threads":                    "threads",
+	"voluntary_ctxt_switches":    "voluntary_ctxt_switches",
+	"nonvoluntary_ctxt_switches": "nonvoluntary_ctxt_switches",
+}
+
+// processSampler is a MetricCollector of the resource usage of a local process, out of /proc/<pid>:
+// its CPU user and sys seconds, RSS, threads and context switches, as cumulated since the process start.
+// The ones of its live descendants, e.g. the worker processes of TorchServe or of a Flask server, are
+// added up to its own, their number being set as processes.
+//
+// The CPU seconds used over the last reporting period are derived as cpu_secs, and divided by the
+// number of inferences over the period as cpu_secs_per_inference. Both are only set from the second
+// sample on. The CPU seconds a descendant used over the period it exited in are not accounted
+type processSampler struct {
+	pid   int
+	count func() uint64
+
+	sampled   bool
+	prevCPU   map[int]float64
+	prevCount uint64
+}
+
+// newProcessSampler returns the sampler of process pid, checking /proc/<pid> can be read.
+// count returns the number of inferences issued so far
+func newProcessSampler(pid int, count func() uint64) (*processSampler, error) {
+	if _, _, err := readProcessCPU(pid); err != nil {
+		return nil, err
+	}
+	return &processSampler{pid: pid, count: count, prevCPU: map[int]float64{}}, nil
+}
+
+// CollectRunTimeMetrics implements MetricCollector
+func (s *processSampler) CollectRunTimeMetrics() (int64, interface{}, error) {
+	ts := time.Now().UnixNano()
+	count := s.count()
+	var user, sys, cpuSecs float64
+	var stats map[string]interface{}
+	cpus := map[int]float64{}
+	for _, pid := range processTree(s.pid) {
+		pidUser, pidSys, err := readProcessCPU(pid)
+		var pidStats map[string]interface{}
+		if err == nil {
+			pidStats, err = readProcessStatus(pid)
+		}
+		if err != nil {
+			if pid == s.pid {
+				return ts, nil, err
+			}
+			// the descendant exited meanwhile
+			continue
+		}
+		if stats == nil {
+			stats = pidStats
+		} else {
+			for name, value := range pidStats {
+				if prev, ok := stats[name].(uint64); ok {
+					stats[name] = prev + value.(uint64)
+				} else {
+					stats[name] = value
+				}
+			}
+		}
+		user += pidUser
+		sys += pidSys
+		cpus[pid] = pidUser + pidSys
+		cpuSecs += cpus[pid] - s.prevCPU[pid]
+	}
+	stats["pid"] = s.pid
+	stats["processes"] = len(cpus)
+	stats["cpu_user_secs"] = user
+	stats["cpu_sys_secs"] = sys
+	if s.sampled {
+		stats["cpu_secs"] = cpuSecs
+		if count > s.prevCount {
+			stats["cpu_secs_per_inference"] = cpuSecs / float64(count-s.prevCount)
+		}
+	}
+	s.sampled = true
+	s.prevCPU = cpus
+	s.prevCount = count
+	return ts, stats, nil
+}
+
+// processTree returns pid followed by the pids of its live descendants, out of the parent pid of
+// each /proc/<pid>/stat
+func processTree(pid int) []int {
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	children := map[int][]int{}
+	for _, dir := range dirs {
+		child, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil || child == pid {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+		if err != nil {
+			continue
+		}
+		if fields, err := processStatFields(string(data)); err == nil {
+			if parent, err := strconv.Atoi(fields[1]); err == nil {
+				children[parent] = append(children[parent], child)
+			}
+		}
+	}
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree
+}
+
+// readProcessCPU returns the user and sys CPU seconds of process pid, out of /proc/<pid>/stat
+func readProcessCPU(pid int) (user float64, sys float64, err error) {
+	data, err := ioutil.ReadFile(procPath(pid, "stat"))
+	if err != nil {
+		return
+	}
+	return parseProcessStat(string(data))
+}
+
+// parseProcessStat parses the utime and stime fields of a /proc/<pid>/stat line
+func parseProcessStat(stat string) (user float64, sys float64, err error) {
+	fields, err := processStatFields(stat)
+	if err != nil {
+		return
+	}
+	// utime and stime are the 14th and 15th fields
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return
+	}
+	return float64(utime) / clockTicksPerSec, float64(stime) / clockTicksPerSec, nil
+}
+
+// processStatFields returns the fields of a /proc/<pid>/stat line from the 3rd one, the process
+// state, on, up to stime. The fields are counted after the command name, which is enclosed in
+// parentheses and may contain spaces
+func processStatFields(stat string) ([]string, error) {
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return nil, fmt.Errorf("malformed process stat %q", stat)
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 13 {
+		return nil, fmt.Errorf("malformed process stat %q", stat)
+	}
+	return fields, nil
+}
+
+// readProcessStatus returns the kept fields of /proc/<pid>/status
+func readProcessStatus(pid int) (map[string]interface{}, error) {
+	file, err := os.Open(procPath(pid, "status"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stats := make(map[string]interface{}, len(processStatusFields))
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		name, ok := processStatusFields[kv[0]]
+		if !ok {
+			continue
+		}
+		// VmRSS is given in kB
+		fields := strings.Fields(kv[1])
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed process status field %s: %v", kv[0], err)
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			value *= 1024
+		}
+		stats[name] = value
+	}
+	return stats, scanner.Err()
+}
+
+// findProcess returns the pid of the single process named name, matched against the command name
+// of /proc/<pid>/comm and the base name of the executable given on /proc/<pid>/cmdline
+func findProcess(name string) (int, error) {
+	dirs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return 0, err
+	}
+	self := os.Getpid()
+	var pids []int
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil || pid == self {
+			continue
+		}
+		if processNamed(pid, name) {
+			pids = append(pids, pid)
+		}
+	}
+	switch len(pids) {
+	case 0:
+		return 0, fmt.Errorf("no process named %s", name)
+	case 1:
+		return pids[0], nil
+	}
+	return 0, fmt.Errorf("%d processes named %s (pids %v), set -server-pid instead", len(pids), name, pids)
+}
+
+func processNamed(pid int, name string) bool {
+	if comm, err := ioutil.ReadFile(procPath(pid, "comm")); err == nil && strings.TrimSpace(string(comm)) == name {
+		return true
+	}
+	cmdline, err := ioutil.ReadFile(procPath(pid, "cmdline"))
+	if err != nil || len(cmdline) == 0 {
+		return false
+	}
+	exe := strings.SplitN(string(cmdline), "\x00", 2)[0]
+	return filepath.Base(exe) == name
+}
+
+func procPath(pid int, file string) string {
+	return filepath.Join("/proc", strconv.Itoa(pid), file)
+}
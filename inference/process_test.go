@@ -0,0 +1,85 @@
+package inference
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestParseProcessStat(t *testing.T) {
+	tests := []struct {
+		stat    string
+		user    float64
+		sys     float64
+		wantErr bool
+	}{
+		{"1234 (redis-server) S 1 1234 1234 0 -1 4194560 1630 0 0 0 250 75 0 0 20 0 5 0 1000 100000 2000 18446744073709551615", 2.5, 0.75, false},
+		{"42 (tf serving) ) R 1 42 42 0 -1 0 0 0 0 0 1 2 0 0 20 0 64 0", 0.01, 0.02, false},
+		{"42 (short) R 1 42", 0, 0, true},
+		{"no parentheses", 0, 0, true},
+	}
+	for _, tt := range tests {
+		user, sys, err := parseProcessStat(tt.stat)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseProcessStat(%q) error = %v, wantErr %v", tt.stat, err, tt.wantErr)
+			continue
+		}
+		if user != tt.user || sys != tt.sys {
+			t.Errorf("parseProcessStat(%q) = %v, %v, want %v, %v", tt.stat, user, sys, tt.user, tt.sys)
+		}
+	}
+}
+
+func TestProcessSampler(t *testing.T) {
+	var count uint64
+	sampler, err := newProcessSampler(os.Getpid(), func() uint64 { return count })
+	if err != nil {
+		t.Skipf("/proc is not available: %v", err)
+	}
+	for sample := 0; sample < 2; sample++ {
+		count += 10
+		_, stats, err := sampler.CollectRunTimeMetrics()
+		if err != nil {
+			t.Fatalf("CollectRunTimeMetrics() error = %v", err)
+		}
+		kvmap := stats.(map[string]interface{})
+		for _, name := range []string{"pid", "processes", "cpu_user_secs", "cpu_sys_secs", "rss_bytes", "threads", "voluntary_ctxt_switches", "nonvoluntary_ctxt_switches"} {
+			if _, ok := kvmap[name]; !ok {
+				t.Errorf("sample %d is missing %s: %v", sample, name, kvmap)
+			}
+		}
+		if _, ok := kvmap["cpu_secs_per_inference"]; ok != (sample > 0) {
+			t.Errorf("sample %d cpu_secs_per_inference set = %v, want %v", sample, ok, sample > 0)
+		}
+	}
+}
+
+func TestProcessSamplerAddsUpTheChildren(t *testing.T) {
+	child := exec.Command("sleep", "10")
+	if err := child.Start(); err != nil {
+		t.Skipf("Error starting a child process: %v", err)
+	}
+	defer func() {
+		_ = child.Process.Kill()
+		_ = child.Wait()
+	}()
+	sampler, err := newProcessSampler(os.Getpid(), func() uint64 { return 0 })
+	if err != nil {
+		t.Skipf("/proc is not available: %v", err)
+	}
+	tree := processTree(os.Getpid())
+	found := false
+	for _, pid := range tree {
+		found = found || pid == child.Process.Pid
+	}
+	if tree[0] != os.Getpid() || !found {
+		t.Errorf("processTree() = %v, want %d followed by its child %d", tree, os.Getpid(), child.Process.Pid)
+	}
+	_, stats, err := sampler.CollectRunTimeMetrics()
+	if err != nil {
+		t.Fatalf("CollectRunTimeMetrics() error = %v", err)
+	}
+	if processes := stats.(map[string]interface{})["processes"].(int); processes < 2 {
+		t.Errorf("CollectRunTimeMetrics() sampled %d processes, want the child one too", processes)
+	}
+}
@@ -0,0 +1,129 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// InferenceRequest is a single inference request handed to a ProcessorV2
+type InferenceRequest struct {
+	// Payload is the row read from the benchmark input
+	Payload               []byte
+	IsWarm                bool
+	WorkerNum             int
+	QueryNumber           int64
+	UseReferenceDataRedis bool
+}
+
+// LatencyPhase is the time spent on a named part of a request, like fetching the reference data
+type LatencyPhase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// InferenceResponse is the outcome of a single inference request
+type InferenceResponse struct {
+	// Label groups the request stats, failed requests without a label are only accounted on the overall stats
+	Label string
+	// Host is the target host the request was sent to, for the per host stats
+	Host    string
+	Latency time.Duration
+	// Phases optionally break Latency down
+	Phases []LatencyPhase
+	// TotalResults is the number of inferences the request did
+	TotalResults uint64
+	// BytesSent and BytesReceived are the size of the request payload and of the reply, as encoded by the runner protocol
+	BytesSent     uint64
+	BytesReceived uint64
+	// Output is the decoded model output, kept on the runs validating or recording the outputs, see BenchmarkRunner.KeepOutputs
+	Output []float32
+	// TimedOut is set when the request exceeded its deadline, with Latency the time at which it was abandoned
+	TimedOut bool
+	// Err is set when the request failed
+	Err *InferenceError
+}
+
+// ProcessorV2Create is a function that creates a new ProcessorV2 (called in RunV2)
+type ProcessorV2Create func() ProcessorV2
+
+// ProcessorV2 is an interface that handles the setup of a inference processing worker and executes requests one at a time.
+// Unlike Processor, requests get a context carrying their deadline and failures are returned on the response
+type ProcessorV2 interface {
+	// Init initializes the worker state, possibly based on its worker number / ID
+	Init(ctx context.Context, workerNum int, totalWorkers int) error
+
+	// Process handles a given inference request. The context is done once the request exceeds -request-timeout
+	Process(ctx context.Context, req *InferenceRequest) *InferenceResponse
+
+	// Close releases the worker resources
+	Close() error
+}
+
+// AsInferenceError returns err as an InferenceError, classifying it with ErrorKindOf when it isn't one
+func AsInferenceError(err error) *InferenceError {
+	if err == nil {
+		return nil
+	}
+	var inferenceErr *InferenceError
+	if errors.As(err, &inferenceErr) {
+		return inferenceErr
+	}
+	return &InferenceError{Kind: ErrorKindOf(err), Err: err}
+}
+
+// processorAdapter runs a Processor as a ProcessorV2
+type processorAdapter struct {
+	processor         Processor
+	wg                *sync.WaitGroup
+	metricsChan       chan uint64
+	responseSizesChan chan uint64
+}
+
+// AdaptProcessor wraps a Processor so that it runs as a ProcessorV2.
+// Processors are single-stat: only the first stat a Processor returns is reported on the response,
+// any other one is dropped. The request context is not passed on either, Processors set their own
+// deadline from -request-timeout, see BenchmarkRunner.RequestContext
+func AdaptProcessor(processor Processor) ProcessorV2 {
+	return &processorAdapter{processor: processor}
+}
+
+func (p *processorAdapter) Init(ctx context.Context, workerNum int, totalWorkers int) error {
+	p.wg = &sync.WaitGroup{}
+	p.wg.Add(1)
+	p.metricsChan = make(chan uint64, totalWorkers)
+	p.responseSizesChan = make(chan uint64, totalWorkers)
+	p.processor.Init(workerNum, totalWorkers, p.wg, p.metricsChan, p.responseSizesChan)
+	return nil
+}
+
+// Process runs the request on the wrapped Processor, ignoring ctx
+func (p *processorAdapter) Process(ctx context.Context, req *InferenceRequest) *InferenceResponse {
+	stats, err := p.processor.ProcessInferenceQuery(req.Payload, req.IsWarm, req.WorkerNum, req.UseReferenceDataRedis, false, req.QueryNumber)
+	resp := &InferenceResponse{Err: AsInferenceError(err)}
+	if len(stats) > 0 {
+		resp.Label = string(stats[0].label)
+		resp.Latency = time.Duration(stats[0].value) * time.Microsecond
+		resp.TotalResults = stats[0].totalResults
+		resp.TimedOut = stats[0].timedOut
+		resp.Host = stats[0].host
+		resp.Output = stats[0].output
+		resp.BytesSent = stats[0].bytesSent
+		resp.BytesReceived = stats[0].bytesReceived
+		for _, phase := range stats[0].phases {
+			resp.Phases = append(resp.Phases, LatencyPhase{phase.name, time.Duration(phase.value) * time.Microsecond})
+		}
+	}
+	for _, stat := range stats {
+		statPool.Put(stat)
+	}
+	return resp
+}
+
+func (p *processorAdapter) Close() error {
+	p.processor.Close()
+	close(p.metricsChan)
+	close(p.responseSizesChan)
+	return nil
+}
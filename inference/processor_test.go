@@ -0,0 +1,53 @@
+package inference
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+type legacyProcessor struct {
+	err error
+}
+
+func (p *legacyProcessor) Init(workerNum int, totalWorkers int, wg *sync.WaitGroup, m chan uint64, rs chan uint64) {
+}
+
+func (p *legacyProcessor) ProcessInferenceQuery(q []byte, isWarm bool, workerNum int, useReferenceDataRedis bool, useReferenceDataMysql bool, queryNumber int64) ([]*Stat, error) {
+	stat := GetStat().Init([]byte("legacy"), 1500, 4, false, "").SetBytes(128, 16)
+	return []*Stat{stat}, p.err
+}
+
+func (p *legacyProcessor) Close() {}
+
+func TestAdaptProcessor(t *testing.T) {
+	processor := AdaptProcessor(&legacyProcessor{})
+	if err := processor.Init(context.Background(), 0, 1); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	resp := processor.Process(context.Background(), &InferenceRequest{Payload: []byte{1}})
+	if resp.Label != "legacy" || resp.Latency != 1500*time.Microsecond || resp.TotalResults != 4 || resp.Err != nil ||
+		resp.BytesSent != 128 || resp.BytesReceived != 16 {
+		t.Errorf("Process() = %+v, want the legacy stat", resp)
+	}
+	if err := processor.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+
+	processor = AdaptProcessor(&legacyProcessor{err: io.EOF})
+	_ = processor.Init(context.Background(), 0, 1)
+	resp = processor.Process(context.Background(), &InferenceRequest{Payload: []byte{1}})
+	if resp.Err == nil || resp.Err.Kind != ErrorKindConnection {
+		t.Errorf("Process() error = %v, want a connection error", resp.Err)
+	}
+}
+
+func TestRunCountsTheLegacyInferences(t *testing.T) {
+	b := newTestRunner(t, 5)
+	runTestRunner(t, b, func() ProcessorV2 { return AdaptProcessor(&legacyProcessor{}) })
+	if count := b.InferenceCount(); count != 20 {
+		t.Errorf("InferenceCount() = %d, want the 4 inferences of each of the 5 requests", count)
+	}
+}
@@ -7,12 +7,16 @@ import (
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Go-encoded and then distribute them to workers
 type producer struct {
-	r     io.Reader
-	limit *uint64
+	r        io.Reader
+	limit    *uint64
+	deadline time.Time
+	rewind   func() (io.Reader, error)
+	stopped  int32
 }
 
 // newScanner returns a new producer for a given Reader and its limit
@@ -26,9 +30,29 @@ func (s *producer) setReader(r io.Reader) *producer {
 	return s
 }
 
+// setDeadline makes the producer stop at the given time
+func (s *producer) setDeadline(deadline time.Time) *producer {
+	s.deadline = deadline
+	return s
+}
+
+// setRewind makes the producer loop over its input. Whenever the input is
+// exhausted, rewind is called to restart reading it from the beginning
+func (s *producer) setRewind(rewind func() (io.Reader, error)) *producer {
+	s.rewind = rewind
+	return s
+}
+
+// stop makes the producer return before reading its next row.
+// It is safe to call from any goroutine
+func (s *producer) stop() {
+	atomic.StoreInt32(&s.stopped, 1)
+}
+
 // produce reads encoded inference queries and places them into a channel
 func (s *producer) produce(pool *sync.Pool, c chan []byte, nbytes int, inferencesPerRow int64, debug int) uint64 {
 	n := uint64(0)
+	rowsSinceRewind := uint64(0)
 	for {
 		bytes := make([]byte, nbytes)
 
@@ -37,7 +61,32 @@ func (s *producer) produce(pool *sync.Pool, c chan []byte, nbytes int, inference
 			// request queries limit reached, time to quit
 			break
 		}
+		if !s.deadline.IsZero() && time.Now().After(s.deadline) {
+			fmt.Println("Reached test time deadline")
+			break
+		}
+		if atomic.LoadInt32(&s.stopped) != 0 {
+			break
+		}
 		readBytes, err := io.ReadFull(s.r, bytes)
+		if readBytes == 0 && s.rewind != nil {
+			// input exhausted, loop over it again.
+			// an input without a single complete row would loop forever, so stop instead
+			if rowsSinceRewind == 0 {
+				log.Error("input has no complete rows to loop over. Stopping the producer")
+				break
+			}
+			s.r, err = s.rewind()
+			if err != nil {
+				log.Error(fmt.Sprintf("unable to rewind the input to keep producing until the deadline: %v. Stopping the producer", err))
+				break
+			}
+			if debug > 0 {
+				fmt.Fprintf(os.Stderr, "Rewinding input after %d rows. \n", rowsSinceRewind)
+			}
+			rowsSinceRewind = 0
+			continue
+		}
 		if readBytes == 0 {
 			break
 		}
@@ -50,6 +99,7 @@ func (s *producer) produce(pool *sync.Pool, c chan []byte, nbytes int, inference
 		}
 		c <- bytes
 		atomic.AddUint64(&n, uint64(inferencesPerRow))
+		rowsSinceRewind++
 	}
 	return n
 }
@@ -0,0 +1,45 @@
+package inference
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestProducerDeadlineLoopsOverInput(t *testing.T) {
+	input := bytes.NewReader([]byte("aabbcc"))
+	var limit uint64 = 0
+	rewinds := 0
+	rewind := func() (io.Reader, error) {
+		rewinds++
+		_, err := input.Seek(0, io.SeekStart)
+		return input, err
+	}
+	c := make(chan []byte)
+	go func() {
+		for range c {
+		}
+	}()
+	s := newScanner(&limit).setReader(input).setDeadline(time.Now().Add(50 * time.Millisecond)).setRewind(rewind)
+	n := s.produce(nil, c, 2, 1, 0)
+	close(c)
+	if rewinds == 0 {
+		t.Errorf("expected the input to be rewound at least once")
+	}
+	if n <= 3 {
+		t.Errorf("expected more rows than the input holds, got %d", n)
+	}
+}
+
+func TestProducerDeadlineStopsOnEmptyInput(t *testing.T) {
+	var limit uint64 = 0
+	rewind := func() (io.Reader, error) {
+		return bytes.NewReader(nil), nil
+	}
+	c := make(chan []byte, 1)
+	s := newScanner(&limit).setReader(bytes.NewReader(nil)).setDeadline(time.Now().Add(time.Hour)).setRewind(rewind)
+	if n := s.produce(nil, c, 2, 1, 0); n != 0 {
+		t.Errorf("expected no rows, got %d", n)
+	}
+}
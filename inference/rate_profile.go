@@ -0,0 +1,201 @@
+package inference
+
+import (
+	"fmt"
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"golang.org/x/time/rate"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateProfileUpdatePeriod is how often the target rate is updated during a ramp
+const rateProfileUpdatePeriod = 100 * time.Millisecond
+
+// rateStage is one segment of a load profile, along which the target rate
+// changes linearly from fromRps to toRps. Constant rates have fromRps == toRps
+type rateStage struct {
+	name     string
+	fromRps  float64
+	toRps    float64
+	duration time.Duration
+}
+
+// rateAt returns the target rate after elapsed time into the stage
+func (s rateStage) rateAt(elapsed time.Duration) float64 {
+	if elapsed >= s.duration {
+		return s.toRps
+	}
+	return s.fromRps + (s.toRps-s.fromRps)*float64(elapsed)/float64(s.duration)
+}
+
+// parseRateProfile parses a comma separated list of load profile stages, each one
+// optionally prefixed by its name as in NAME=TYPE:ARGS. The supported stage types are:
+//
+//	constant:RPS:DURATION
+//	ramp:FROM_RPS:TO_RPS:DURATION
+//	steps:FROM_RPS:STEP_RPS:STEP_DURATION:COUNT (a staircase of COUNT steps, adding STEP_RPS on each)
+//	spike:BASE_RPS:SPIKE_RPS:SPIKE_DURATION:DURATION (a spike followed by BASE_RPS for the rest of DURATION)
+//
+// Steps and spikes are expanded into one rateStage per step, and per spike and recovery, so that
+// each one is reported on its own.
+func parseRateProfile(spec string) ([]rateStage, error) {
+	stages := make([]rateStage, 0)
+	for idx, stageSpec := range strings.Split(spec, ",") {
+		name := ""
+		if eq := strings.Index(stageSpec, "="); eq > -1 {
+			name = stageSpec[:eq]
+			stageSpec = stageSpec[eq+1:]
+		}
+		fields := strings.Split(strings.TrimSpace(stageSpec), ":")
+		stageType := fields[0]
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", stageType, idx+1)
+		}
+		args, err := parseRateStageArgs(stageType, fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate profile stage %q: %v", stageSpec, err)
+		}
+		switch stageType {
+		case "constant":
+			stages = append(stages, rateStage{name, args[0].rps, args[0].rps, args[1].duration})
+		case "ramp":
+			stages = append(stages, rateStage{name, args[0].rps, args[1].rps, args[2].duration})
+		case "steps":
+			for step := 0; step < args[3].count; step++ {
+				stepRps := args[0].rps + float64(step)*args[1].rps
+				stages = append(stages, rateStage{fmt.Sprintf("%s/%.0frps", name, stepRps), stepRps, stepRps, args[2].duration})
+			}
+		case "spike":
+			if args[2].duration > args[3].duration {
+				return nil, fmt.Errorf("invalid rate profile stage %q: spike is longer than the stage", stageSpec)
+			}
+			stages = append(stages,
+				rateStage{name, args[1].rps, args[1].rps, args[2].duration},
+				rateStage{name + "/recovery", args[0].rps, args[0].rps, args[3].duration - args[2].duration},
+			)
+		}
+	}
+	return stages, nil
+}
+
+type rateStageArg struct {
+	rps      float64
+	duration time.Duration
+	count    int
+}
+
+// rateStageArgKinds lists, per stage type, whether each argument is a rate ('r'), a duration ('d') or a count ('c')
+var rateStageArgKinds = map[string]string{
+	"constant": "rd",
+	"ramp":     "rrd",
+	"steps":    "rrdc",
+	"spike":    "rrdd",
+}
+
+func parseRateStageArgs(stageType string, fields []string) ([]rateStageArg, error) {
+	kinds, ok := rateStageArgKinds[stageType]
+	if !ok {
+		return nil, fmt.Errorf("unknown stage type %q, expected one of constant, ramp, steps, spike", stageType)
+	}
+	if len(fields) != len(kinds) {
+		return nil, fmt.Errorf("expected %d arguments for a %s stage, got %d", len(kinds), stageType, len(fields))
+	}
+	args := make([]rateStageArg, len(fields))
+	for i, field := range fields {
+		var err error
+		switch kinds[i] {
+		case 'd':
+			args[i].duration, err = time.ParseDuration(field)
+		case 'c':
+			args[i].count, err = strconv.Atoi(field)
+			if err == nil && args[i].count <= 0 {
+				err = fmt.Errorf("count %s is not positive", field)
+			}
+		default:
+			args[i].rps, err = strconv.ParseFloat(field, 64)
+			if err == nil && args[i].rps < 0 {
+				err = fmt.Errorf("negative value %s", field)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// startRateProfile runs the load profile in the background, calling stop once all of its stages are done.
+// The returned function blocks until the profile returned, on its own or after done was closed, so that
+// all of the stage stats are stored before the results are written
+func (b *BenchmarkRunner) startRateProfile(stages []rateStage, rateLimiter *rate.Limiter, schedule *arrivalSchedule, inferencesPerRow int64, done chan struct{}, stop func()) (wait func()) {
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		b.runRateProfile(stages, rateLimiter, schedule, inferencesPerRow, done)
+		stop()
+	}()
+	return func() {
+		<-finished
+	}
+}
+
+// runRateProfile drives the workers rate along the load profile stages and stores each stage's
+// quantiles and throughput on the client run time stats. It returns once all stages are done, or when done is closed
+func (b *BenchmarkRunner) runRateProfile(stages []rateStage, rateLimiter *rate.Limiter, schedule *arrivalSchedule, inferencesPerRow int64, done chan struct{}) {
+	for _, stage := range stages {
+		start := time.Now()
+		b.currentStage.Store(stage.name)
+		// drop whatever was measured before this stage
+		_ = b.sp.takeWindow()
+		b.setTargetRate(rateLimiter, schedule, stage.fromRps, false)
+		fmt.Printf("Starting load profile stage %s (%.0f -> %.0f rps for %v)\n", stage.name, stage.fromRps, stage.toRps, stage.duration)
+
+		ticker := time.NewTicker(rateProfileUpdatePeriod)
+		stageEnd := time.After(stage.duration)
+		interrupted := false
+	stageLoop:
+		for {
+			select {
+			case <-done:
+				interrupted = true
+				break stageLoop
+			case <-stageEnd:
+				break stageLoop
+			case now := <-ticker.C:
+				if stage.fromRps != stage.toRps {
+					b.setTargetRate(rateLimiter, schedule, stage.rateAt(now.Sub(start)), false)
+				}
+			}
+		}
+		ticker.Stop()
+
+		now := time.Now()
+		window := b.sp.takeWindow()
+		b.addStageStats(now, stage, window, now.Sub(start), inferencesPerRow)
+		if interrupted {
+			return
+		}
+	}
+}
+
+// addStageStats stores the stats of a finished load profile stage on the client run time stats
+func (b *BenchmarkRunner) addStageStats(now time.Time, stage rateStage, window *statGroup, took time.Duration, inferencesPerRow int64) {
+	var stageStats = make(map[string]interface{})
+	stageStats["Stage"] = stage.name
+	stageStats["StageSummary"] = true
+	stageStats["StageFromRps"] = stage.fromRps
+	stageStats["StageToRps"] = stage.toRps
+	stageStats["StageDurationMillis"] = took.Milliseconds()
+	stageStats["InferenceRate"] = float64(window.successCount()*inferencesPerRow) / took.Seconds()
+	_, qm := generateQuantileMap(window.latencyHDRHistogram)
+	stageStats["Quantiles"] = qm
+	encodedHist, err := window.latencyHDRHistogram.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err == nil {
+		stageStats["EncodedHistogram"] = encodedHist
+	}
+	fmt.Printf("Load profile stage %s done: %.2f inferences/sec, p50 %.3f ms, p99 %.3f ms\n", stage.name, stageStats["InferenceRate"], qm["q50"], qm["q99"])
+	b.clientRunTimeStatsMu.Lock()
+	b.testResult.ClientRunTimeStats[now.UnixNano()] = stageStats
+	b.clientRunTimeStatsMu.Unlock()
+}
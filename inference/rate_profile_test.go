@@ -0,0 +1,91 @@
+package inference
+
+import (
+	"encoding/json"
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+func TestParseRateProfile(t *testing.T) {
+	stages, err := parseRateProfile("warmup=ramp:0:100:10s,steps:100:50:5s:3,spike:100:1000:2s:10s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []rateStage{
+		{"warmup", 0, 100, 10 * time.Second},
+		{"steps-2/100rps", 100, 100, 5 * time.Second},
+		{"steps-2/150rps", 150, 150, 5 * time.Second},
+		{"steps-2/200rps", 200, 200, 5 * time.Second},
+		{"spike-3", 1000, 1000, 2 * time.Second},
+		{"spike-3/recovery", 100, 100, 8 * time.Second},
+	}
+	if len(stages) != len(expected) {
+		t.Fatalf("expected %d stages, got %d: %v", len(expected), len(stages), stages)
+	}
+	for i := range expected {
+		if stages[i] != expected[i] {
+			t.Errorf("stage %d: expected %v, got %v", i, expected[i], stages[i])
+		}
+	}
+	if got := stages[0].rateAt(2500 * time.Millisecond); got != 25 {
+		t.Errorf("expected the ramp at 25 rps after 2.5s, got %v", got)
+	}
+}
+
+func TestParseRateProfileInvalid(t *testing.T) {
+	for _, spec := range []string{"", "sine:10:10s", "constant:10", "ramp:10:x:10s", "constant:-1:10s", "spike:10:100:20s:10s", "steps:10:10:1s:2.5", "steps:10:10:1s:0"} {
+		if _, err := parseRateProfile(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestRateProfileStoresEveryStage(t *testing.T) {
+	stages, err := parseRateProfile("warmup=ramp:10:100:30ms,steps:100:100:200ms:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, interrupt := range []bool{false, true} {
+		var limit uint64
+		b := &BenchmarkRunner{sp: &statProcessor{limit: &limit}}
+		b.testResult.ClientRunTimeStats = make(map[int64]interface{})
+		rateLimiter := rate.NewLimiter(rate.Limit(1), 1)
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		// a worker waiting on the rate changed by the profile
+		go func() {
+			for {
+				select {
+				case <-stopped:
+					return
+				case <-done:
+					return
+				default:
+					b.waitForSendTime(rateLimiter, nil, 1, true)
+				}
+			}
+		}()
+		wait := b.startRateProfile(stages, rateLimiter, nil, 1, done, func() { close(stopped) })
+		if interrupt {
+			time.Sleep(100 * time.Millisecond)
+		} else {
+			<-stopped
+		}
+		close(done)
+		wait()
+
+		// the results are written right after the profile is waited for
+		if _, err := json.Marshal(b.testResult); err != nil {
+			t.Fatal(err)
+		}
+		want := len(stages)
+		if interrupt {
+			// the ramp, and the first step cut short
+			want = 2
+		}
+		if got := len(b.testResult.ClientRunTimeStats); got != want {
+			t.Errorf("interrupt %v: expected %d stage stats, got %d", interrupt, want, got)
+		}
+	}
+}
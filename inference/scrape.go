@@ -0,0 +1,264 @@
+package inference
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrometheusCollector is a MetricCollector scraping a Prometheus text format endpoint on each
+// reporting period, e.g. Triton's :8002/metrics, TF Serving's monitoring endpoint or TorchServe's
+// metrics API. It keeps the samples of the selected metrics, by series (name and labels): the
+// counters (and the histograms and summaries cumulative samples) as deltas since the previous
+// scrape, so that the server views of different runs can be compared, and the gauges as they are
+type PrometheusCollector struct {
+	url      string
+	prefixes []string
+	client   *http.Client
+	prev     map[string]float64
+}
+
+// PrometheusFlags describes the Prometheus text format endpoint scraped by a PrometheusCollector
+type PrometheusFlags struct {
+	URL     string
+	Names   string
+	Timeout time.Duration
+}
+
+// RegisterPrometheusFlags registers the metrics endpoint flags on the command line. example is the
+// model server usual endpoint, shown on the usage
+func RegisterPrometheusFlags(example string) *PrometheusFlags {
+	f := &PrometheusFlags{}
+	flag.StringVar(&f.URL, "metrics-url", "", fmt.Sprintf("Prometheus text format endpoint of the model server scraped on each reporting period, e.g. %s. If not set, the model server metrics are not collected", example))
+	flag.StringVar(&f.Names, "metrics-names", "", "Comma separated name prefixes of the scraped metrics to keep. If not set, every metric is kept")
+	flag.DurationVar(&f.Timeout, "metrics-timeout", 5*time.Second, "Metrics endpoint request timeout")
+	return f
+}
+
+// Enabled tells whether the metrics endpoint is set
+func (f *PrometheusFlags) Enabled() bool {
+	return len(f.URL) > 0
+}
+
+// Collector returns the collector of the metrics endpoint
+func (f *PrometheusFlags) Collector() *PrometheusCollector {
+	var prefixes []string
+	if len(f.Names) > 0 {
+		prefixes = strings.Split(f.Names, ",")
+	}
+	return NewPrometheusCollector(f.URL, prefixes, f.Timeout)
+}
+
+// NewPrometheusCollector returns the collector of the metrics of url whose name starts with any
+// of prefixes, or of every metric when there are none. The endpoint is scraped right away, so that
+// the first counter deltas cover the first reporting period
+func NewPrometheusCollector(url string, prefixes []string, timeout time.Duration) *PrometheusCollector {
+	c := &PrometheusCollector{
+		url:      url,
+		prefixes: prefixes,
+		client:   &http.Client{Timeout: timeout},
+	}
+	samples, err := c.scrape()
+	if err != nil {
+		log.Printf("Error scraping the metrics of %s: %v", url, err)
+	}
+	c.setPrev(samples)
+	return c
+}
+
+// CollectRunTimeMetrics implements MetricCollector. The stats are the kept samples, by url
+func (c *PrometheusCollector) CollectRunTimeMetrics() (int64, interface{}, error) {
+	ts := time.Now().UnixNano()
+	samples, err := c.scrape()
+	if err != nil {
+		return ts, nil, err
+	}
+	metrics := make(map[string]interface{}, len(samples))
+	for series, sample := range samples {
+		if !sample.cumulative {
+			metrics[series] = sample.value
+			continue
+		}
+		prev, ok := c.prev[series]
+		if !ok {
+			continue
+		}
+		delta := sample.value - prev
+		if delta < 0 {
+			// the counter was reset, e.g. by a server restart
+			delta = sample.value
+		}
+		metrics[series] = delta
+	}
+	c.setPrev(samples)
+	return ts, map[string]interface{}{c.url: metrics}, nil
+}
+
+// setPrev keeps the samples the next deltas are computed from
+func (c *PrometheusCollector) setPrev(samples map[string]promSample) {
+	c.prev = make(map[string]float64, len(samples))
+	for series, sample := range samples {
+		c.prev[series] = sample.value
+	}
+}
+
+type promSample struct {
+	value      float64
+	cumulative bool
+}
+
+// scrape returns the kept samples of the endpoint, by series
+func (c *PrometheusCollector) scrape() (map[string]promSample, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", c.url, resp.Status)
+	}
+	return parsePrometheusText(resp.Body, c.prefixes)
+}
+
+// parsePrometheusText parses the samples of a Prometheus text format exposition, keeping the metrics
+// whose name starts with any of prefixes. The samples of the counters, histograms and summaries,
+// except the summary quantiles, are flagged as cumulative. The +Inf, -Inf and NaN samples, e.g. the
+// gauges of a model without inferences yet, are dropped, as the json results can not hold them
+func parsePrometheusText(r io.Reader, prefixes []string) (map[string]promSample, error) {
+	types := map[string]string{}
+	samples := map[string]promSample{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+		series, value, err := parsePrometheusSample(line)
+		if err != nil {
+			return nil, err
+		}
+		name := series
+		if idx := strings.IndexByte(series, '{'); idx > -1 {
+			name = series[:idx]
+		}
+		if !hasAnyPrefix(name, prefixes) || math.IsInf(value, 0) || math.IsNaN(value) {
+			continue
+		}
+		samples[series] = promSample{value: value, cumulative: isCumulative(name, series, types)}
+	}
+	return samples, scanner.Err()
+}
+
+// parsePrometheusSample splits a sample line into its series (name and labels) and value,
+// dropping the optional timestamp
+func parsePrometheusSample(line string) (string, float64, error) {
+	end := strings.LastIndexByte(line, '}')
+	if end < 0 {
+		end = strings.IndexAny(line, " \t")
+		if end < 0 {
+			return "", 0, fmt.Errorf("malformed metrics line %q", line)
+		}
+		end--
+	}
+	series := strings.TrimSpace(line[:end+1])
+	fields := strings.Fields(line[end+1:])
+	if len(fields) == 0 {
+		return "", 0, fmt.Errorf("malformed metrics line %q", line)
+	}
+	value, err := parsePrometheusValue(fields[0])
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed metrics line %q: %v", line, err)
+	}
+	return series, value, nil
+}
+
+func parsePrometheusValue(s string) (float64, error) {
+	switch s {
+	case "+Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// isCumulative tells whether the samples of the metric name only grow over time: the counters and
+// the histograms and summaries _sum, _count and _bucket samples, but not the summary quantiles
+func isCumulative(name string, series string, types map[string]string) bool {
+	switch types[name] {
+	case "counter", "histogram":
+		return true
+	case "summary":
+		return !strings.Contains(series, "quantile=")
+	case "gauge":
+		return false
+	}
+	for _, suffix := range []string{"_sum", "_count", "_bucket"} {
+		if base := strings.TrimSuffix(name, suffix); base != name {
+			switch types[base] {
+			case "histogram", "summary":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// multiCollector merges the stats of several collectors, each one keyed by server
+type multiCollector []MetricCollector
+
+// CombineCollectors returns the MetricCollector merging the stats of collectors, which must be
+// maps keyed by server, e.g. a model server and its reference data Redis server
+func CombineCollectors(collectors ...MetricCollector) MetricCollector {
+	if len(collectors) == 1 {
+		return collectors[0]
+	}
+	return multiCollector(collectors)
+}
+
+// CollectRunTimeMetrics implements MetricCollector, failing on the first collector error
+func (m multiCollector) CollectRunTimeMetrics() (int64, interface{}, error) {
+	ts := time.Now().UnixNano()
+	merged := map[string]interface{}{}
+	for _, collector := range m {
+		_, stats, err := collector.CollectRunTimeMetrics()
+		if err != nil {
+			return ts, merged, err
+		}
+		if byServer, ok := stats.(map[string]interface{}); ok {
+			for server, serverStats := range byServer {
+				merged[server] = serverStats
+			}
+		}
+	}
+	return ts, merged, nil
+}
@@ -0,0 +1,131 @@
+package inference
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const scrapeTemplate = `# HELP nv_inference_count Number of inferences performed
+# TYPE nv_inference_count counter
+nv_inference_count{model="mobilenet",version="1"} %d
+# TYPE nv_gpu_utilization gauge
+nv_gpu_utilization{gpu_uuid="GPU-0"} %g
+# TYPE request_duration summary
+request_duration{quantile="0.5"} 2.5
+request_duration_sum %d
+request_duration_count %d
+# TYPE process_cpu_seconds_total counter
+process_cpu_seconds_total 12 1600000000000
+`
+
+func TestPrometheusCollector(t *testing.T) {
+	scrapes := []string{
+		fmt.Sprintf(scrapeTemplate, 100, 0.25, 40, 10),
+		fmt.Sprintf(scrapeTemplate, 130, 0.75, 52, 16),
+		fmt.Sprintf(scrapeTemplate, 5, 0.5, 60, 20),
+	}
+	scrape := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, scrapes[scrape])
+		scrape++
+	}))
+	defer server.Close()
+
+	c := NewPrometheusCollector(server.URL, []string{"nv_", "request_"}, time.Second)
+	for _, want := range []map[string]interface{}{
+		{
+			`nv_inference_count{model="mobilenet",version="1"}`: 30.0,
+			`nv_gpu_utilization{gpu_uuid="GPU-0"}`:              0.75,
+			`request_duration{quantile="0.5"}`:                  2.5,
+			`request_duration_sum`:                              12.0,
+			`request_duration_count`:                            6.0,
+		},
+		{
+			// the inference counter was reset
+			`nv_inference_count{model="mobilenet",version="1"}`: 5.0,
+			`nv_gpu_utilization{gpu_uuid="GPU-0"}`:              0.5,
+			`request_duration{quantile="0.5"}`:                  2.5,
+			`request_duration_sum`:                              8.0,
+			`request_duration_count`:                            4.0,
+		},
+	} {
+		_, stats, err := c.CollectRunTimeMetrics()
+		if err != nil {
+			t.Fatalf("CollectRunTimeMetrics() error = %v", err)
+		}
+		got := stats.(map[string]interface{})[server.URL]
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("CollectRunTimeMetrics() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestParsePrometheusSample(t *testing.T) {
+	tests := []struct {
+		line    string
+		series  string
+		value   float64
+		wantErr bool
+	}{
+		{"up 1", "up", 1, false},
+		{"http_requests_total{code=\"200\",path=\"/a b\"} 1027 1395066363000", "http_requests_total{code=\"200\",path=\"/a b\"}", 1027, false},
+		{"latency_bucket{le=\"+Inf\"} 3.5e+01", "latency_bucket{le=\"+Inf\"}", 35, false},
+		{"up", "", 0, true},
+		{"up{} one", "", 0, true},
+	}
+	for _, tt := range tests {
+		series, value, err := parsePrometheusSample(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePrometheusSample(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if series != tt.series || value != tt.value {
+			t.Errorf("parsePrometheusSample(%q) = %q, %v, want %q, %v", tt.line, series, value, tt.series, tt.value)
+		}
+	}
+}
+
+func TestParsePrometheusTextDropsNonFiniteSamples(t *testing.T) {
+	text := `# TYPE latency histogram
+latency_bucket{le="0.5"} 2
+latency_bucket{le="+Inf"} 3
+latency_sum 1.25
+latency_count 3
+# TYPE queue_latency gauge
+queue_latency NaN
+queue_max_latency +Inf
+queue_min_latency -Inf
+`
+	samples, err := parsePrometheusText(strings.NewReader(text), nil)
+	if err != nil {
+		t.Fatalf("parsePrometheusText() error = %v", err)
+	}
+	want := map[string]promSample{
+		`latency_bucket{le="0.5"}`:  {value: 2, cumulative: true},
+		`latency_bucket{le="+Inf"}`: {value: 3, cumulative: true},
+		`latency_sum`:               {value: 1.25, cumulative: true},
+		`latency_count`:             {value: 3, cumulative: true},
+	}
+	if !reflect.DeepEqual(samples, want) {
+		t.Errorf("parsePrometheusText() = %v, want %v", samples, want)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, text)
+	}))
+	defer server.Close()
+	c := NewPrometheusCollector(server.URL, nil, time.Second)
+	_, stats, err := c.CollectRunTimeMetrics()
+	if err != nil {
+		t.Fatalf("CollectRunTimeMetrics() error = %v", err)
+	}
+	if _, err := json.Marshal(stats); err != nil {
+		t.Errorf("json.Marshal(CollectRunTimeMetrics()) error = %v", err)
+	}
+}
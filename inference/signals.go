@@ -0,0 +1,37 @@
+package inference
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyOnInterrupt calls onInterrupt on the first SIGINT or SIGTERM, so that the
+// benchmark can stop gracefully and still write its results. A second signal exits
+// right away, e.g. when the workers are stuck on an unresponsive server.
+// The returned function stops listening for signals.
+func notifyOnInterrupt(onInterrupt func(os.Signal)) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			fmt.Fprintf(os.Stderr, "Received %v, stopping and saving the results. Send it again to exit right away\n", sig)
+			onInterrupt(sig)
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-sigs:
+			fmt.Fprintf(os.Stderr, "Received %v again, exiting\n", sig)
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
@@ -0,0 +1,99 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// sleepProcessor is a ProcessorV2 whose inferences take a millisecond
+type sleepProcessor struct{}
+
+func (p sleepProcessor) Init(ctx context.Context, workerNum int, totalWorkers int) error { return nil }
+
+func (p sleepProcessor) Process(ctx context.Context, req *InferenceRequest) *InferenceResponse {
+	time.Sleep(time.Millisecond)
+	return &InferenceResponse{Label: "sleep", Latency: time.Millisecond, TotalResults: 1}
+}
+
+func (p sleepProcessor) Close() error { return nil }
+
+func TestInterruptWritesPartialResults(t *testing.T) {
+	dir := t.TempDir()
+	inputFile := filepath.Join(dir, "input")
+	// enough rows to keep a single worker busy for minutes
+	if err := ioutil.WriteFile(inputFile, make([]byte, 100000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		// whether the signal is sent before the run starts, e.g. while the runner sets up its model
+		beforeRun bool
+	}{
+		{"before the run", true},
+		{"during the run", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BenchmarkRunner{
+				workers:     1,
+				fileName:    inputFile,
+				JsonOutFile: filepath.Join(dir, "results.json"),
+				liveMetrics: newLiveMetrics(),
+				sp:          &statProcessor{},
+			}
+			b.scanner = newScanner(&b.limit)
+			b.sp.limit = &b.limit
+			b.handleInterrupts()
+			if tt.beforeRun {
+				if err := syscall.Kill(syscall.Getpid(), syscall.SIGINT); err != nil {
+					t.Fatal(err)
+				}
+				for atomic.LoadInt32(&b.interrupted) == 0 {
+					time.Sleep(time.Millisecond)
+				}
+			} else {
+				go func() {
+					for atomic.LoadUint64(&b.inferenceCount) == 0 {
+						time.Sleep(time.Millisecond)
+					}
+					_ = syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+				}()
+			}
+			finished := make(chan struct{})
+			go func() {
+				b.RunV2(&sync.Pool{New: func() interface{} { return make([]byte, 0, 1) }}, func() ProcessorV2 { return sleepProcessor{} }, 1, 1, nil)
+				close(finished)
+			}()
+			select {
+			case <-finished:
+			case <-time.After(10 * time.Second):
+				t.Fatal("the run didn't stop on the signal")
+			}
+
+			data, err := ioutil.ReadFile(b.JsonOutFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result TestResult
+			if err := json.Unmarshal(data, &result); err != nil {
+				t.Fatal(err)
+			}
+			if !result.Interrupted {
+				t.Errorf("expected the results to be marked as interrupted")
+			}
+			requests, _ := result.Totals["Requests"].(float64)
+			if tt.beforeRun && requests != 0 {
+				t.Errorf("expected no requests, got %v", requests)
+			}
+			if !tt.beforeRun && (requests == 0 || requests >= 100000) {
+				t.Errorf("expected a partial run, got %v requests", requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package inference
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// WorkerSkew holds the throughput and latency of a single worker
+type WorkerSkew struct {
+	Worker      int     `json:"Worker"`
+	Requests    int64   `json:"Requests"`
+	Errors      int64   `json:"Errors"`
+	RequestRate float64 `json:"RequestRate"` // successful requests per second
+	P99         float64 `json:"P99"`         // milliseconds
+}
+
+// HostSkew holds the throughput and latency quantiles of a single target host
+type HostSkew struct {
+	Host        string             `json:"Host"`
+	Requests    int64              `json:"Requests"`
+	Errors      int64              `json:"Errors"`
+	RequestRate float64            `json:"RequestRate"` // successful requests per second
+	Quantiles   map[string]float64 `json:"Quantiles"`
+}
+
+// SkewReport compares the workers, and the target hosts, so that a single
+// slow connection or shard stands out of the overall stats
+type SkewReport struct {
+	Workers         []WorkerSkew `json:"Workers"`
+	MinWorkerRate   float64      `json:"MinWorkerRate"`
+	MaxWorkerRate   float64      `json:"MaxWorkerRate"`
+	WorkerRateRatio float64      `json:"WorkerRateRatio"` // max over min worker rate, 0 when a worker did no request
+	Hosts           []HostSkew   `json:"Hosts"`
+	MinHostP99      float64      `json:"MinHostP99"` // milliseconds
+	MaxHostP99      float64      `json:"MaxHostP99"` // milliseconds
+}
+
+// newSkewReport builds the skew report out of the per worker and per host stats collected over took
+func newSkewReport(workerStats map[int]*statGroup, hostStats map[string]*statGroup, took time.Duration) *SkewReport {
+	report := &SkewReport{
+		Workers: make([]WorkerSkew, 0, len(workerStats)),
+		Hosts:   make([]HostSkew, 0, len(hostStats)),
+	}
+	for worker, group := range workerStats {
+		report.Workers = append(report.Workers, WorkerSkew{
+			Worker:      worker,
+			Requests:    group.count,
+			Errors:      group.errorCount,
+			RequestRate: float64(group.successCount()) / took.Seconds(),
+			P99:         float64(group.latencyHDRHistogram.ValueAtQuantile(99.0)) / 10e2,
+		})
+	}
+	sort.Slice(report.Workers, func(i, j int) bool { return report.Workers[i].Worker < report.Workers[j].Worker })
+	for i, worker := range report.Workers {
+		if i == 0 || worker.RequestRate < report.MinWorkerRate {
+			report.MinWorkerRate = worker.RequestRate
+		}
+		if worker.RequestRate > report.MaxWorkerRate {
+			report.MaxWorkerRate = worker.RequestRate
+		}
+	}
+	if report.MinWorkerRate > 0 {
+		report.WorkerRateRatio = report.MaxWorkerRate / report.MinWorkerRate
+	}
+
+	for host, group := range hostStats {
+		_, qm := generateQuantileMap(group.latencyHDRHistogram)
+		report.Hosts = append(report.Hosts, HostSkew{
+			Host:        host,
+			Requests:    group.count,
+			Errors:      group.errorCount,
+			RequestRate: float64(group.successCount()) / took.Seconds(),
+			Quantiles:   qm,
+		})
+	}
+	sort.Slice(report.Hosts, func(i, j int) bool { return report.Hosts[i].Host < report.Hosts[j].Host })
+	for i, host := range report.Hosts {
+		if i == 0 || host.Quantiles["q99"] < report.MinHostP99 {
+			report.MinHostP99 = host.Quantiles["q99"]
+		}
+		if host.Quantiles["q99"] > report.MaxHostP99 {
+			report.MaxHostP99 = host.Quantiles["q99"]
+		}
+	}
+	return report
+}
+
+func (r *SkewReport) write(w io.Writer) error {
+	if len(r.Workers) > 0 {
+		_, err := fmt.Fprintf(w, "Worker skew: min %.2f requests/sec, max %.2f requests/sec, max/min %.2f\n", r.MinWorkerRate, r.MaxWorkerRate, r.WorkerRateRatio)
+		if err != nil {
+			return err
+		}
+		for _, worker := range r.Workers {
+			_, err = fmt.Fprintf(w, "\tworker %3d: %8.2f requests/sec, %d requests, %d errors, p99: %8.3f ms\n", worker.Worker, worker.RequestRate, worker.Requests, worker.Errors, worker.P99)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(r.Hosts) > 0 {
+		_, err := fmt.Fprintf(w, "Host skew: min p99 %.3f ms, max p99 %.3f ms\n", r.MinHostP99, r.MaxHostP99)
+		if err != nil {
+			return err
+		}
+		for _, host := range r.Hosts {
+			_, err = fmt.Fprintf(w, "\t%s: %8.2f requests/sec, %d requests, %d errors, p50: %8.3f ms, p99: %8.3f ms\n", host.Host, host.RequestRate, host.Requests, host.Errors, host.Quantiles["q50"], host.Quantiles["q99"])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
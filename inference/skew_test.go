@@ -0,0 +1,47 @@
+package inference
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewSkewReport(t *testing.T) {
+	workerStats := map[int]*statGroup{0: newStatGroup(0), 1: newStatGroup(0)}
+	hostStats := map[string]*statGroup{"a:6379": newStatGroup(0), "b:6379": newStatGroup(0)}
+	for i := 0; i < 10; i++ {
+		workerStats[0].push(GetStat().Init([]byte("q"), 1000, 1, false, ""))
+		hostStats["a:6379"].push(GetStat().Init([]byte("q"), 1000, 1, false, ""))
+	}
+	for i := 0; i < 5; i++ {
+		workerStats[1].push(GetStat().Init([]byte("q"), 4000, 1, false, ""))
+		hostStats["b:6379"].push(GetStat().Init([]byte("q"), 4000, 1, false, ""))
+	}
+	report := newSkewReport(workerStats, hostStats, time.Second)
+	if report.MinWorkerRate != 5 || report.MaxWorkerRate != 10 || report.WorkerRateRatio != 2 {
+		t.Errorf("worker rates = %v, %v, %v, want 5, 10, 2", report.MinWorkerRate, report.MaxWorkerRate, report.WorkerRateRatio)
+	}
+	if report.Workers[0].Worker != 0 || report.Hosts[1].Host != "b:6379" {
+		t.Errorf("workers and hosts are not sorted: %+v %+v", report.Workers, report.Hosts)
+	}
+	// the histograms keep 3 significant digits
+	if report.MinHostP99 != 1 || report.MaxHostP99 < 4 || report.MaxHostP99 > 4.01 {
+		t.Errorf("host p99 = %v, %v, want 1, 4", report.MinHostP99, report.MaxHostP99)
+	}
+}
+
+func TestSkewReportStarvedWorkerAndHost(t *testing.T) {
+	limit := uint64(0)
+	sp := &statProcessor{limit: &limit, perWorkerStats: true, perHostStats: true, hosts: []string{"a:6379", "b:6379"}}
+	sp.start(2, false)
+	sp.sendStats([]*Stat{GetStat().Init([]byte("q"), 1000, 1, false, "").SetHost("a:6379")})
+	sp.CloseAndWait()
+	if len(sp.Skew.Workers) != 2 || sp.Skew.Workers[1].Requests != 0 {
+		t.Errorf("workers = %+v, want the starved worker 1 with no requests", sp.Skew.Workers)
+	}
+	if sp.Skew.MinWorkerRate != 0 || sp.Skew.WorkerRateRatio != 0 {
+		t.Errorf("min worker rate = %v, ratio = %v, want 0, 0", sp.Skew.MinWorkerRate, sp.Skew.WorkerRateRatio)
+	}
+	if len(sp.Skew.Hosts) != 2 || sp.Skew.Hosts[1].Host != "b:6379" || sp.Skew.Hosts[1].Requests != 0 {
+		t.Errorf("hosts = %+v, want the starved host b:6379 with no requests", sp.Skew.Hosts)
+	}
+}
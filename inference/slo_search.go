@@ -0,0 +1,129 @@
+package inference
+
+import (
+	"fmt"
+	"golang.org/x/time/rate"
+	"time"
+)
+
+// sloSearchMinAchievedRatio is the fraction of the target rate a search step must
+// achieve to pass. A rate the clients can't even issue is not sustainable
+const sloSearchMinAchievedRatio = 0.95
+
+// SloSearchStep holds the outcome of one sub-run of the max throughput under SLO search
+type SloSearchStep struct {
+	TargetRps       uint64  `json:"TargetRps"`
+	AchievedRps     float64 `json:"AchievedRps"`
+	Inferences      int64   `json:"Inferences"`
+	QuantileLatency float64 `json:"QuantileLatency"` // milliseconds
+	Passed          bool    `json:"Passed"`
+	StartTime       int64   `json:"StartTime"`
+	DurationMillis  int64   `json:"DurationMillis"`
+}
+
+// SloSearchResult holds the search trajectory and the highest rate found to meet the SLO
+type SloSearchResult struct {
+	Quantile       float64         `json:"Quantile"`
+	SloLatency     float64         `json:"SloLatency"` // milliseconds
+	MinRps         uint64          `json:"MinRps"`
+	MaxRps         uint64          `json:"MaxRps"`
+	Precision      uint64          `json:"Precision"`
+	SustainableRps uint64          `json:"SustainableRps"` // 0 when not even MinRps meets the SLO
+	Steps          []SloSearchStep `json:"Steps"`
+}
+
+// searchMaxRate binary searches the highest request rate whose latency quantile stays
+// under the SLO. Every step changes the rate of the already running workers and
+// measures a window of b.sloSearchStepTime, so all steps share the same connections.
+// The search is cut short when done is closed, i.e. when the producer stops on its own.
+func (b *BenchmarkRunner) searchMaxRate(rateLimiter *rate.Limiter, schedule *arrivalSchedule, inferencesPerRow int64, done chan struct{}) *SloSearchResult {
+	return b.binarySearchMaxRate(func(targetRps uint64) (SloSearchStep, bool) {
+		return b.runSloSearchStep(rateLimiter, schedule, inferencesPerRow, targetRps, done)
+	})
+}
+
+// binarySearchMaxRate runs the search steps of searchMaxRate, each one through runStep, which
+// returns false when the search was cut short
+func (b *BenchmarkRunner) binarySearchMaxRate(runStep func(targetRps uint64) (SloSearchStep, bool)) *SloSearchResult {
+	result := &SloSearchResult{
+		Quantile:   b.sloQuantile,
+		SloLatency: float64(b.sloLatency.Microseconds()) / 10e2,
+		MinRps:     b.sloSearchMinRps,
+		MaxRps:     b.sloSearchMaxRps,
+		Precision:  b.sloSearchPrecision,
+		Steps:      make([]SloSearchStep, 0),
+	}
+	fmt.Printf("Searching the max rate in [%d, %d] rps with q%g latency under %v\n", b.sloSearchMinRps, b.sloSearchMaxRps, b.sloQuantile, b.sloLatency)
+
+	// the lower bound needs to pass for the search to make sense
+	step, completed := runStep(b.sloSearchMinRps)
+	if !completed {
+		fmt.Println("SLO search interrupted before its first step completed")
+		return result
+	}
+	result.Steps = append(result.Steps, step)
+	if !step.Passed {
+		fmt.Printf("SLO not met at the minimum rate of %d rps\n", b.sloSearchMinRps)
+		return result
+	}
+	// lo is the highest rate known to meet the SLO and hi the lowest one assumed to miss it, starting
+	// past the max rate so that the search can end at it when the SLO is never missed
+	lo, hi := b.sloSearchMinRps, b.sloSearchMaxRps+1
+	result.SustainableRps = lo
+	for hi-lo > b.sloSearchPrecision {
+		mid := lo + (hi-lo)/2
+		step, completed = runStep(mid)
+		if !completed {
+			fmt.Println("SLO search interrupted, the sustainable rate is a lower bound")
+			break
+		}
+		result.Steps = append(result.Steps, step)
+		if step.Passed {
+			lo = mid
+			result.SustainableRps = mid
+		} else {
+			hi = mid
+		}
+	}
+	fmt.Printf("Max sustainable rate with q%g latency under %v: %d rps\n", b.sloQuantile, b.sloLatency, result.SustainableRps)
+	return result
+}
+
+// runSloSearchStep runs the workers at targetRps for one step and checks the outcome against the SLO.
+// It returns false if done was closed before the step completed
+func (b *BenchmarkRunner) runSloSearchStep(rateLimiter *rate.Limiter, schedule *arrivalSchedule, inferencesPerRow int64, targetRps uint64, done chan struct{}) (SloSearchStep, bool) {
+	start := time.Now()
+	b.setTargetRate(rateLimiter, schedule, float64(targetRps), true)
+	// drop whatever was measured before this step
+	_ = b.sp.takeWindow()
+	select {
+	case <-done:
+		return SloSearchStep{}, false
+	case <-time.After(b.sloSearchStepTime):
+	}
+	window := b.sp.takeWindow()
+	took := time.Since(start)
+
+	inferences := window.successCount() * inferencesPerRow
+	achieved := float64(inferences) / took.Seconds()
+	quantileLatency := float64(window.latencyHDRHistogram.ValueAtQuantile(b.sloQuantile)) / 10e2
+	passed := b.sloStepPassed(targetRps, window.count, achieved, quantileLatency)
+	fmt.Printf("SLO search step: target %d rps, achieved %.2f rps, q%g latency %.3f ms, passed: %v\n", targetRps, achieved, b.sloQuantile, quantileLatency, passed)
+	return SloSearchStep{
+		TargetRps:       targetRps,
+		AchievedRps:     achieved,
+		Inferences:      inferences,
+		QuantileLatency: quantileLatency,
+		Passed:          passed,
+		StartTime:       start.Unix(),
+		DurationMillis:  took.Milliseconds(),
+	}, true
+}
+
+// sloStepPassed tells whether a search step of count requests, achieving the achieved rate with the
+// searched latency quantile at quantileLatency milliseconds, meets the SLO at targetRps
+func (b *BenchmarkRunner) sloStepPassed(targetRps uint64, count int64, achieved float64, quantileLatency float64) bool {
+	return count > 0 &&
+		quantileLatency <= float64(b.sloLatency.Microseconds())/10e2 &&
+		achieved >= float64(targetRps)*sloSearchMinAchievedRatio
+}
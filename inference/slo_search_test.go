@@ -0,0 +1,74 @@
+package inference
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBinarySearchMaxRate(t *testing.T) {
+	tests := []struct {
+		name string
+		// latency returns the q99 latency in milliseconds at a rate, and the rate achieved
+		latency   func(rps uint64) (float64, float64)
+		stopAfter int
+		want      uint64
+		wantSteps int
+	}{
+		// the latency crosses the 10ms SLO at 730 rps
+		{"linear", func(rps uint64) (float64, float64) { return float64(rps) / 73, float64(rps) }, 0, 730, 11},
+		{"slo missed at the min rate", func(rps uint64) (float64, float64) { return 20, float64(rps) }, 0, 0, 1},
+		// the clients can't issue more than 400 rps, which passes up to 400/0.95 rps
+		{"client bound", func(rps uint64) (float64, float64) { return 1, float64(minUint64(rps, 400)) }, 0, 421, 11},
+		// the SLO is never missed, so the search ends at the max rate
+		{"slo never missed", func(rps uint64) (float64, float64) { return 1, float64(rps) }, 0, 1000, 11},
+		// the search stops after its third step, keeping the rate found so far as a lower bound
+		{"interrupted", func(rps uint64) (float64, float64) { return float64(rps) / 73, float64(rps) }, 3, 501, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &BenchmarkRunner{
+				sloLatency:         10 * time.Millisecond,
+				sloQuantile:        99,
+				sloSearchMinRps:    1,
+				sloSearchMaxRps:    1000,
+				sloSearchPrecision: 1,
+			}
+			steps := 0
+			result := b.binarySearchMaxRate(func(targetRps uint64) (SloSearchStep, bool) {
+				if tt.stopAfter > 0 && steps == tt.stopAfter {
+					return SloSearchStep{}, false
+				}
+				steps++
+				latency, achieved := tt.latency(targetRps)
+				return SloSearchStep{
+					TargetRps:       targetRps,
+					AchievedRps:     achieved,
+					QuantileLatency: latency,
+					Passed:          b.sloStepPassed(targetRps, 1, achieved, latency),
+				}, true
+			})
+			// with a precision of 1 rps the search ends within 1 rps of the threshold
+			if result.SustainableRps+1 < tt.want || result.SustainableRps > tt.want {
+				t.Errorf("SustainableRps = %d, want %d", result.SustainableRps, tt.want)
+			}
+			if len(result.Steps) != tt.wantSteps {
+				t.Errorf("got %d steps, want %d: %+v", len(result.Steps), tt.wantSteps, result.Steps)
+			}
+			if last := result.Steps[len(result.Steps)-1]; tt.want == b.sloSearchMaxRps && (last.TargetRps != b.sloSearchMaxRps || !last.Passed) {
+				t.Errorf("last step = %+v, want a passed step at the max rate", last)
+			}
+			for _, step := range result.Steps {
+				if step.Passed && step.TargetRps > result.SustainableRps {
+					t.Errorf("step at %d rps passed above the sustainable rate %d", step.TargetRps, result.SustainableRps)
+				}
+			}
+		})
+	}
+}
+
+func minUint64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
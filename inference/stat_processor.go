@@ -12,14 +12,24 @@ import (
 // statProcessor is used to collect, analyze, and print inference execution statistics.
 type statProcessor struct {
 	prewarmQueries     bool       // PrewarmQueries tells the StatProcessor whether we're running each inference twice to prewarm the cache
+	openLoop           bool       // openLoop tells the StatProcessor to also track the latency not corrected for coordinated omission
 	c                  chan *Stat // c is the channel for Stats to be sent for processing
 	limit              *uint64    // limit is the number of statistics to analyze before stopping
 	burnIn             uint64     // burnIn is the number of statistics to ignore before analyzing
 	printInterval      uint64     // printInterval is how often print intermediate stats (number of queries)
 	wg                 sync.WaitGroup
 	StatsMapping       map[string]*statGroup
-	InstantaneousStats *statGroup
+	instantMu          sync.Mutex
+	InstantaneousStats *statGroup // InstantaneousStats collects the stats of the current reporting period, see takeInstantaneous
 	opsCount           uint64
+	windowMu           sync.Mutex
+	windowStats        *statGroup // windowStats collects the stats since the last takeWindow call. It is nil until the first one
+	perWorkerStats     bool       // perWorkerStats tells the StatProcessor to keep a statGroup per worker
+	perHostStats       bool       // perHostStats tells the StatProcessor to keep a statGroup per target host
+	hosts              []string   // hosts are the target hosts declared by the runner, see BenchmarkRunner.SetHosts
+	WorkerStats        map[int]*statGroup
+	HostStats          map[string]*statGroup
+	Skew               *SkewReport // Skew is set once processing is done, when per worker or per host stats are kept
 }
 
 func (sp *statProcessor) sendStats(stats []*Stat) {
@@ -32,16 +42,36 @@ func (sp *statProcessor) sendStats(stats []*Stat) {
 	}
 }
 
-// process collects latency results, aggregating them into summary
-// statistics. Optionally, they are printed to stderr at regular intervals.
-func (sp *statProcessor) process(workers uint, printStats bool) {
+// start launches the stats processing in the background. The stats channel and groups are
+// set up before it returns, so that the workers and the reporters can use them right away
+func (sp *statProcessor) start(workers uint, printStats bool) {
 	sp.c = make(chan *Stat, workers)
 	sp.wg.Add(1)
-	const allQueriesLabel = labelAllQueries
 	sp.StatsMapping = map[string]*statGroup{
-		allQueriesLabel: newStatGroup(*sp.limit),
+		labelAllQueries: sp.newStatGroup(),
+	}
+	sp.InstantaneousStats = sp.newStatGroup()
+	sp.WorkerStats = map[int]*statGroup{}
+	sp.HostStats = map[string]*statGroup{}
+	// the groups are created upfront, so that the workers and hosts no inference reached
+	// still show up on the skew report, with a zero rate
+	if sp.perWorkerStats {
+		for worker := 0; worker < int(workers); worker++ {
+			sp.WorkerStats[worker] = sp.newStatGroup()
+		}
+	}
+	if sp.perHostStats {
+		for _, host := range sp.hosts {
+			sp.HostStats[host] = sp.newStatGroup()
+		}
 	}
-	sp.InstantaneousStats = newStatGroup(*sp.limit)
+	go sp.process(workers, printStats)
+}
+
+// process collects latency results, aggregating them into summary
+// statistics. Optionally, they are printed to stderr at regular intervals.
+func (sp *statProcessor) process(workers uint, printStats bool) {
+	const allQueriesLabel = labelAllQueries
 
 	i := uint64(0)
 	start := time.Now()
@@ -57,15 +87,37 @@ func (sp *statProcessor) process(workers uint, printStats bool) {
 				log.Fatal(err)
 			}
 		}
-		if _, ok := sp.StatsMapping[string(stat.label)]; !ok {
-			sp.StatsMapping[string(stat.label)] = newStatGroup(*sp.limit)
-		}
+		// failed requests the processor returned no stats for have no label, and are only accounted on the overall stats
+		if len(stat.label) > 0 {
+			if _, ok := sp.StatsMapping[string(stat.label)]; !ok {
+				sp.StatsMapping[string(stat.label)] = sp.newStatGroup()
+			}
 
-		sp.StatsMapping[string(stat.label)].push(stat.value, stat.totalResults, stat.timedOut, stat.query)
+			sp.StatsMapping[string(stat.label)].push(stat)
+		}
 
 		if !stat.isPartial {
-			sp.StatsMapping[allQueriesLabel].push(stat.value, stat.totalResults, stat.timedOut, stat.query)
-			sp.InstantaneousStats.push(stat.value, stat.totalResults, stat.timedOut, stat.query)
+			sp.StatsMapping[allQueriesLabel].push(stat)
+			sp.instantMu.Lock()
+			sp.InstantaneousStats.push(stat)
+			sp.instantMu.Unlock()
+			sp.windowMu.Lock()
+			if sp.windowStats != nil {
+				sp.windowStats.push(stat)
+			}
+			sp.windowMu.Unlock()
+			if sp.perWorkerStats {
+				if _, ok := sp.WorkerStats[stat.workerNum]; !ok {
+					sp.WorkerStats[stat.workerNum] = sp.newStatGroup()
+				}
+				sp.WorkerStats[stat.workerNum].push(stat)
+			}
+			if sp.perHostStats && len(stat.host) > 0 {
+				if _, ok := sp.HostStats[stat.host]; !ok {
+					sp.HostStats[stat.host] = sp.newStatGroup()
+				}
+				sp.HostStats[stat.host].push(stat)
+			}
 
 			// If we're prewarming queries (i.e., running them twice in a row),
 			// only increment the counter for the first (cold) inference. Otherwise,
@@ -78,14 +130,19 @@ func (sp *statProcessor) process(workers uint, printStats bool) {
 		statPool.Put(stat)
 	}
 
+	sinceStart := time.Since(start)
+	if sp.perWorkerStats || sp.perHostStats {
+		sp.Skew = newSkewReport(sp.WorkerStats, sp.HostStats, sinceStart)
+	}
 	if printStats {
-		sinceStart := time.Since(start)
 		overallQueryRate := float64(sp.opsCount) / float64(sinceStart.Seconds())
 		// the final stats output goes to stdout:
-		_, err := fmt.Printf("Run complete after %d inferences with %d workers (Overall inference rate %0.2f inferences/sec):\n",
+		_, err := fmt.Printf("Run complete after %d inferences with %d workers (Overall inference rate %0.2f inferences/sec, %d requests timed out, %d failed):\n",
 			sp.opsCount,
 			workers,
-			overallQueryRate)
+			overallQueryRate,
+			sp.StatsMapping[allQueriesLabel].timedOutCount,
+			sp.StatsMapping[allQueriesLabel].errorCount)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -93,11 +150,48 @@ func (sp *statProcessor) process(workers uint, printStats bool) {
 		if err != nil {
 			log.Fatal(err)
 		}
+		if sp.Skew != nil {
+			err = sp.Skew.write(os.Stdout)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
 	}
 
 	sp.wg.Done()
 }
 
+// newStatGroup returns a StatGroup matching the benchmark mode
+func (sp *statProcessor) newStatGroup() *statGroup {
+	if sp.openLoop {
+		return newOpenLoopStatGroup(*sp.limit)
+	}
+	return newStatGroup(*sp.limit)
+}
+
+// takeWindow returns the stats collected since the previous call, or nil on the
+// first call, and starts collecting a new window. It is safe to call while processing
+func (sp *statProcessor) takeWindow() *statGroup {
+	fresh := sp.newStatGroup()
+	sp.windowMu.Lock()
+	window := sp.windowStats
+	sp.windowStats = fresh
+	sp.windowMu.Unlock()
+	return window
+}
+
+// takeInstantaneous returns the stats of the reporting period that just ended and starts collecting
+// the next one. The returned statGroup is no longer written to, so it can be read from the
+// reporting goroutine while processing goes on
+func (sp *statProcessor) takeInstantaneous() *statGroup {
+	fresh := sp.newStatGroup()
+	sp.instantMu.Lock()
+	period := sp.InstantaneousStats
+	sp.InstantaneousStats = fresh
+	sp.instantMu.Unlock()
+	return period
+}
+
 // CloseAndWait closes the stats channel and blocks until the StatProcessor has finished all the stats on its channel.
 func (sp *statProcessor) CloseAndWait() {
 	close(sp.c)
@@ -7,18 +7,51 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Stat represents one statistical measurement, typically used to store the
 // latency of a inference (or part of inference).
 type Stat struct {
-	label        []byte
-	value        int64 // microseconds latency
-	totalResults uint64
-	isWarm       bool
-	isPartial    bool
-	timedOut     bool
-	query        string
+	label         []byte
+	value         int64 // microseconds latency
+	queueDelay    int64 // microseconds between the intended and the actual send time (open-loop only)
+	totalResults  uint64
+	isWarm        bool
+	isPartial     bool
+	timedOut      bool
+	errorKind     ErrorKind // empty unless the request failed
+	phases        []statPhase
+	workerNum     int
+	host          string    // target host, when the processor reports it
+	output        []float32 // decoded model output, see SetOutput
+	bytesSent     uint64    // request size, see SetBytes
+	bytesReceived uint64    // reply size, see SetBytes
+	query         string
+}
+
+// Latency phase names shared by the runners, see Stat.AddPhase
+const (
+	PhaseReferenceFetch = "reference_fetch"
+	// PhaseSerialize is the time spent building the request out of the inputs
+	PhaseSerialize = "serialize"
+	// PhaseNetworkInference is the round trip of the request, when the server side steps
+	// can't be told apart
+	PhaseNetworkInference = "network+inference"
+	// PhaseDeserialize is the time spent decoding the outputs of the response, only recorded
+	// when the outputs are kept
+	PhaseDeserialize = "deserialize"
+	// PhaseTensorSet, PhaseModelRun and PhaseTensorGet are the round trips of the RedisAI
+	// commands, when they are issued one by one
+	PhaseTensorSet = "tensorset"
+	PhaseModelRun  = "modelrun"
+	PhaseTensorGet = "tensorget"
+)
+
+// statPhase is the latency of a named part of an inference
+type statPhase struct {
+	name  string
+	value int64 // microseconds latency
 }
 
 var statPool = &sync.Pool{
@@ -39,6 +72,8 @@ func GetStat() *Stat {
 // GetPartialStat returns a partial Stat for use from a pool
 
 // Init safely initializes a Stat while minimizing heap allocations.
+// Requests that exceeded their deadline are initialized with timedOut set, and value
+// the latency at which they were abandoned, so that they still show in the tail quantiles.
 func (s *Stat) Init(label []byte, value int64, totalResults uint64, timedOut bool, query string) *Stat {
 	s.query = query
 	s.label = s.label[:0] // clear
@@ -50,12 +85,55 @@ func (s *Stat) Init(label []byte, value int64, totalResults uint64, timedOut boo
 	return s
 }
 
+// RequestStat returns the stat of a request labelled label, started at start, that exceeded its deadline when
+// timedOut is set, or failed otherwise. Its latency is the time elapsed since start
+func RequestStat(label string, start time.Time, timedOut bool) []*Stat {
+	stat := GetStat().Init([]byte(label), time.Since(start).Microseconds(), uint64(0), timedOut, "")
+	return []*Stat{stat}
+}
+
+// AddPhase records the microseconds spent on a named part of the inference, like
+// the reference data fetch. Each phase is reported on its own latency histogram
+func (s *Stat) AddPhase(name string, value int64) *Stat {
+	s.phases = append(s.phases, statPhase{name, value})
+	return s
+}
+
+// SetHost records the target host the inference was sent to, for the per host stats
+func (s *Stat) SetHost(host string) *Stat {
+	s.host = host
+	return s
+}
+
+// SetOutput records the decoded model output, for the output validation. Processors only decode
+// the outputs when BenchmarkRunner.KeepOutputs is set
+func (s *Stat) SetOutput(output []float32) *Stat {
+	s.output = output
+	return s
+}
+
+// SetBytes records the size of the request payload sent and of the reply received, as encoded
+// by the runner protocol
+func (s *Stat) SetBytes(sent uint64, received uint64) *Stat {
+	s.bytesSent = sent
+	s.bytesReceived = received
+	return s
+}
+
 func (s *Stat) reset() *Stat {
 	s.label = s.label[:0]
 	s.value = 0
+	s.queueDelay = 0
 	s.totalResults = uint64(0)
 	s.isWarm = false
 	s.isPartial = false
+	s.errorKind = ""
+	s.phases = s.phases[:0]
+	s.workerNum = 0
+	s.host = ""
+	s.output = nil
+	s.bytesSent = 0
+	s.bytesReceived = 0
 	return s
 }
 
@@ -64,7 +142,15 @@ type statGroup struct {
 	sumTotalResults     uint64
 	count               int64
 	timedOutCount       int64
+	errorCount          int64
+	errorCounts         map[ErrorKind]int64
 	latencyHDRHistogram *hdrhistogram.Histogram
+	// uncorrectedLatencyHDRHistogram is only set on open-loop benchmarks, where
+	// latencyHDRHistogram is measured from the intended send time. It keeps
+	// the plain service time, as measured by the processor
+	uncorrectedLatencyHDRHistogram *hdrhistogram.Histogram
+	// phaseHDRHistograms holds one latency histogram per phase, see Stat.AddPhase
+	phaseHDRHistograms map[string]*hdrhistogram.Histogram
 }
 
 // newStatGroup returns a new StatGroup with an initial size
@@ -80,32 +166,100 @@ func newStatGroup(size uint64) *statGroup {
 	return &statGroup{
 		count:               0,
 		timedOutCount:       0,
+		errorCount:          0,
+		errorCounts:         map[ErrorKind]int64{},
 		sumTotalResults:     0,
 		latencyHDRHistogram: lH,
+		phaseHDRHistograms:  map[string]*hdrhistogram.Histogram{},
 	}
 }
 
-// push updates a StatGroup with a new value.
-// latency is the latency in microseconds
-func (s *statGroup) push(latency_us int64, totalResults uint64, timedOut bool, query string) {
-	_ = s.latencyHDRHistogram.RecordValue(latency_us)
-	s.sumTotalResults += totalResults
-	if timedOut {
+// newOpenLoopStatGroup returns a new StatGroup that also tracks the latency
+// not corrected for coordinated omission
+func newOpenLoopStatGroup(size uint64) *statGroup {
+	sg := newStatGroup(size)
+	sg.uncorrectedLatencyHDRHistogram = hdrhistogram.New(1, 30000000, 3)
+	return sg
+}
+
+// push updates a StatGroup with a new Stat.
+// The latency is recorded including the queue delay, i.e. the microseconds
+// the request was sent after its intended send time.
+// Failed requests, with a non empty errorKind, are counted but their latency is not recorded
+func (s *statGroup) push(stat *Stat) {
+	s.count++
+	if stat.errorKind != "" {
+		s.errorCount++
+		s.errorCounts[stat.errorKind]++
+		return
+	}
+	_ = s.latencyHDRHistogram.RecordValue(stat.value + stat.queueDelay)
+	if s.uncorrectedLatencyHDRHistogram != nil {
+		_ = s.uncorrectedLatencyHDRHistogram.RecordValue(stat.value)
+	}
+	for _, phase := range stat.phases {
+		hist, ok := s.phaseHDRHistograms[phase.name]
+		if !ok {
+			hist = hdrhistogram.New(1, 30000000, 3)
+			s.phaseHDRHistograms[phase.name] = hist
+		}
+		_ = hist.RecordValue(phase.value)
+	}
+	s.sumTotalResults += stat.totalResults
+	if stat.timedOut {
 		s.timedOutCount++
 	}
-	s.count++
+}
+
+// phaseNames returns the names of the recorded latency phases, sorted
+func (s *statGroup) phaseNames() []string {
+	names := make([]string, 0, len(s.phaseHDRHistograms))
+	for name := range s.phaseHDRHistograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// errorCountsByKind returns a copy of the number of failed requests per kind, which can be kept
+// while the group goes on being updated or reset
+func (s *statGroup) errorCountsByKind() map[ErrorKind]int64 {
+	counts := make(map[ErrorKind]int64, len(s.errorCounts))
+	for kind, count := range s.errorCounts {
+		counts[kind] = count
+	}
+	return counts
+}
+
+// successCount returns the number of requests that neither failed nor timed out
+func (s *statGroup) successCount() int64 {
+	return s.count - s.timedOutCount - s.errorCount
+}
+
+// errorRate returns the fraction of failed requests
+func (s *statGroup) errorRate() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return float64(s.errorCount) / float64(s.count)
 }
 
 // reset a StatGroup
 func (s *statGroup) reset() {
 	s.latencyHDRHistogram.Reset()
+	if s.uncorrectedLatencyHDRHistogram != nil {
+		s.uncorrectedLatencyHDRHistogram.Reset()
+	}
 	s.timedOutCount = 0
+	s.errorCount = 0
+	s.errorCounts = map[ErrorKind]int64{}
+	s.phaseHDRHistograms = map[string]*hdrhistogram.Histogram{}
 	s.count = 0
 }
 
 // string makes a simple description of a statGroup.
 func (s *statGroup) stringQueryLatencyStatistical() string {
-	return fmt.Sprintf("+ Inference execution latency (statistical histogram):\n\tmin: %8.2f ms,  mean: %8.2f ms, q25: %8.2f ms, med(q50): %8.2f ms, q75: %8.2f ms, q99: %8.2f ms, max: %8.2f ms, stddev: %8.2fms, count: %d, timedOut count: %d\n",
+	return fmt.Sprintf("+ Inference execution latency (statistical histogram):\n\tmin: %8.2f ms,  mean: %8.2f ms, q25: %8.2f ms, med(q50): %8.2f ms, q75: %8.2f ms, q99: %8.2f ms, max: %8.2f ms, stddev: %8.2fms, count: %d, timedOut count: %d, error count: %d\n",
 		float64(s.latencyHDRHistogram.Min())/10e2,
 		s.latencyHDRHistogram.Mean()/10e2,
 		float64(s.latencyHDRHistogram.ValueAtQuantile(25.0))/10e2,
@@ -114,7 +268,7 @@ func (s *statGroup) stringQueryLatencyStatistical() string {
 		float64(s.latencyHDRHistogram.ValueAtQuantile(99.0))/10e2,
 		float64(s.latencyHDRHistogram.Max())/10e2,
 		s.latencyHDRHistogram.StdDev()/10e2,
-		s.count, s.timedOutCount)
+		s.count, s.timedOutCount, s.errorCount)
 }
 
 // stringQueryResponseSizeFullHistogram returns a string histogram of Query Response Size (#docs)
@@ -126,8 +280,40 @@ func (s *statGroup) stringQueryLatencyFullHistogram() string {
 
 var FormatString1 = "%s,%d\n"
 
+// stringQueryUncorrectedLatency makes a simple description of the latency not corrected for coordinated omission.
+func (s *statGroup) stringQueryUncorrectedLatency() string {
+	return fmt.Sprintf("+ Inference service time, not corrected for coordinated omission:\n\tmin: %8.2f ms,  mean: %8.2f ms, med(q50): %8.2f ms, q99: %8.2f ms, max: %8.2f ms\n",
+		float64(s.uncorrectedLatencyHDRHistogram.Min())/10e2,
+		s.uncorrectedLatencyHDRHistogram.Mean()/10e2,
+		float64(s.uncorrectedLatencyHDRHistogram.ValueAtQuantile(50.0))/10e2,
+		float64(s.uncorrectedLatencyHDRHistogram.ValueAtQuantile(99.0))/10e2,
+		float64(s.uncorrectedLatencyHDRHistogram.Max())/10e2)
+}
+
+// stringPhaseLatency makes a simple description of the latency of one phase.
+func (s *statGroup) stringPhaseLatency(name string) string {
+	hist := s.phaseHDRHistograms[name]
+	return fmt.Sprintf("+ Phase %s latency:\n\tmin: %8.2f ms,  mean: %8.2f ms, med(q50): %8.2f ms, q99: %8.2f ms, max: %8.2f ms, count: %d\n",
+		name,
+		float64(hist.Min())/10e2,
+		hist.Mean()/10e2,
+		float64(hist.ValueAtQuantile(50.0))/10e2,
+		float64(hist.ValueAtQuantile(99.0))/10e2,
+		float64(hist.Max())/10e2,
+		hist.TotalCount())
+}
+
 func (s *statGroup) write(w io.Writer) error {
 	_, err := fmt.Fprintln(w, s.stringQueryLatencyStatistical())
+	if err == nil && s.uncorrectedLatencyHDRHistogram != nil {
+		_, err = fmt.Fprintln(w, s.stringQueryUncorrectedLatency())
+	}
+	for _, name := range s.phaseNames() {
+		if err != nil {
+			break
+		}
+		_, err = fmt.Fprintln(w, s.stringPhaseLatency(name))
+	}
 	return err
 }
 
@@ -3,23 +3,47 @@ package inference
 type TestResult struct {
 
 	// Test Configs
-	ResultFormatVersion  string `json:"ResultFormatVersion"`
-	Limit                uint64 `json:"Limit"`
-	MetadataAutobatching int64  `json:"MetadataAutobatching"`
-	TensorBatchSize      uint64 `json:"TensorBatchSize"`
-	Workers              uint   `json:"Workers"`
-	MaxRps               uint64 `json:"MaxRps"`
+	ResultFormatVersion  string  `json:"ResultFormatVersion"`
+	Limit                uint64  `json:"Limit"`
+	MetadataAutobatching int64   `json:"MetadataAutobatching"`
+	TensorBatchSize      uint64  `json:"TensorBatchSize"`
+	Workers              uint    `json:"Workers"`
+	MaxRps               uint64  `json:"MaxRps"`
+	TestTimeMillis       int64   `json:"TestTimeMillis"`
+	RequestTimeoutMillis int64   `json:"RequestTimeoutMillis"`
+	OpenLoop             bool    `json:"OpenLoop"`
+	ArrivalDistribution  string  `json:"ArrivalDistribution"`
+	MaxErrorRate         float64 `json:"MaxErrorRate"`
 
 	// Test Description
 	TestDescription string `json:"TestDescription"`
 
+	// Run Metadata
+	GitSHA1     string         `json:"GitSHA1"`
+	GitDirty    bool           `json:"GitDirty"`
+	CommandLine []string       `json:"CommandLine"`
+	ClientHost  ClientHostInfo `json:"ClientHost"`
+
+	// Target servers info (e.g. versions), by server address, as reported by each runner
+	ServerInfo map[string]interface{} `json:"ServerInfo"`
+
+	// Models set on the target servers, as reported by each runner
+	Models []ModelConfig `json:"Models"`
+
 	// DB Spefic Configs
 	DBSpecificConfigs map[string]interface{} `json:"DBSpecificConfigs"`
 
-	StartTime      int64 `json:"StartTime`
+	StartTime      int64 `json:"StartTime"`
 	EndTime        int64 `json:"EndTime"`
 	DurationMillis int64 `json:"DurationMillis"`
 
+	// Whether the run was stopped by a signal before completion
+	Interrupted bool `json:"Interrupted"`
+
+	// Whether the run was stopped because of the inference errors, see -max-error-rate
+	Aborted     bool   `json:"Aborted"`
+	AbortReason string `json:"AbortReason"`
+
 	// Totals
 	Totals map[string]interface{} `json:"Totals"`
 
@@ -33,6 +57,24 @@ type TestResult struct {
 	// Per second ( tick ) client stats
 	ClientRunTimeStats map[int64]interface{} `json:"ClientRunTimeStats"`
 
+	// Per worker and per target host throughput and latency, only set on -per-worker-stats or -per-host-stats runs
+	Skew *SkewReport `json:"Skew"`
+
+	// Max throughput under SLO search trajectory, only set on -slo-latency runs
+	SloSearch *SloSearchResult `json:"SloSearch"`
+
+	// Model outputs validation against the golden outputs, only set on -golden-file runs
+	Validation *ValidationResult `json:"Validation"`
+
+	// Per agent summary, only set on the distributed benchmark results merged by the coordinator
+	Agents []AgentResult `json:"Agents"`
+
 	// Per second ( tick ) server stats
 	ServerRunTimeStats map[int64]interface{} `json:"ServerRunTimeStats"`
+
+	// Per second ( tick ) resource usage of the local server process, only set on -server-pid or -server-process-name runs
+	ServerProcessStats map[int64]interface{} `json:"ServerProcessStats"`
+
+	// Per second ( tick ) resource usage of the client process, where /proc is available
+	ClientProcessStats map[int64]interface{} `json:"ClientProcessStats"`
 }
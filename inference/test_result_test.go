@@ -0,0 +1,202 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jsonFields returns the json names of the fields of a struct type
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		fields[name] = true
+	}
+	return fields
+}
+
+func TestResultSchema(t *testing.T) {
+	data, err := ioutil.ReadFile("test_result.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Required   []string `json:"required"`
+		Properties map[string]struct {
+			Const      string                     `json:"const"`
+			Required   []string                   `json:"required"`
+			Properties map[string]json.RawMessage `json:"properties"`
+			Items      struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"items"`
+		} `json:"properties"`
+	}
+	if err = json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema.Properties["ResultFormatVersion"].Const != ResultFormatVersion {
+		t.Errorf("schema ResultFormatVersion = %q, want %q", schema.Properties["ResultFormatVersion"].Const, ResultFormatVersion)
+	}
+
+	fields := jsonFields(reflect.TypeOf(TestResult{}))
+	if len(fields) != len(schema.Properties) || len(fields) != len(schema.Required) {
+		t.Errorf("TestResult has %d fields, the schema %d properties and %d required", len(fields), len(schema.Properties), len(schema.Required))
+	}
+	for name := range fields {
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("TestResult field %s is not in the schema", name)
+		}
+	}
+	for name := range jsonFields(reflect.TypeOf(ClientHostInfo{})) {
+		if _, ok := schema.Properties["ClientHost"].Properties[name]; !ok {
+			t.Errorf("ClientHostInfo field %s is not in the schema", name)
+		}
+	}
+	for name := range jsonFields(reflect.TypeOf(ValidationResult{})) {
+		if _, ok := schema.Properties["Validation"].Properties[name]; !ok {
+			t.Errorf("ValidationResult field %s is not in the schema", name)
+		}
+	}
+	for name := range jsonFields(reflect.TypeOf(ModelConfig{})) {
+		if _, ok := schema.Properties["Models"].Items.Properties[name]; !ok {
+			t.Errorf("ModelConfig field %s is not in the schema", name)
+		}
+	}
+}
+
+// newTestRunner returns a single worker runner reading rows single byte rows and writing its json
+// results into a temporary directory
+func newTestRunner(t *testing.T, rows int) *BenchmarkRunner {
+	dir := t.TempDir()
+	inputFile := filepath.Join(dir, "input")
+	if err := ioutil.WriteFile(inputFile, make([]byte, rows), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := &BenchmarkRunner{
+		workers:     1,
+		fileName:    inputFile,
+		JsonOutFile: filepath.Join(dir, "results.json"),
+		liveMetrics: newLiveMetrics(),
+		sp:          &statProcessor{},
+	}
+	b.scanner = newScanner(&b.limit)
+	b.sp.limit = &b.limit
+	return b
+}
+
+// runTestRunner runs the processors of create with the runner b, returning the json results
+func runTestRunner(t *testing.T, b *BenchmarkRunner, create ProcessorV2Create) TestResult {
+	b.RunV2(&sync.Pool{New: func() interface{} { return make([]byte, 0, 1) }}, create, 1, 1, nil)
+	data, err := ioutil.ReadFile(b.JsonOutFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result TestResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// bytesProcessor is a ProcessorV2 sending 100 bytes and receiving 10 on each inference
+type bytesProcessor struct{}
+
+func (p bytesProcessor) Init(ctx context.Context, workerNum int, totalWorkers int) error { return nil }
+
+func (p bytesProcessor) Process(ctx context.Context, req *InferenceRequest) *InferenceResponse {
+	return &InferenceResponse{Label: "bytes", Latency: time.Millisecond, TotalResults: 1, BytesSent: 100, BytesReceived: 10}
+}
+
+func (p bytesProcessor) Close() error { return nil }
+
+func TestResultTotals(t *testing.T) {
+	result := runTestRunner(t, newTestRunner(t, 5), func() ProcessorV2 { return bytesProcessor{} })
+	if result.Totals["BytesSent"] != 500.0 || result.Totals["BytesReceived"] != 50.0 {
+		t.Errorf("Totals = %v, want 500 bytes sent and 50 received", result.Totals)
+	}
+
+	data, err := ioutil.ReadFile("test_result.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties map[string]struct {
+			Required []string `json:"required"`
+		} `json:"properties"`
+	}
+	if err = json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	var totals []string
+	for name := range result.Totals {
+		totals = append(totals, name)
+	}
+	sort.Strings(totals)
+	required := append([]string{}, schema.Properties["Totals"].Required...)
+	sort.Strings(required)
+	if !reflect.DeepEqual(totals, required) {
+		t.Errorf("Totals = %v, the schema requires %v", totals, required)
+	}
+}
+
+// timeoutProcessor is a ProcessorV2 timing out every other request, each of 4 inferences
+type timeoutProcessor struct{ requests *int }
+
+func (p timeoutProcessor) Init(ctx context.Context, workerNum int, totalWorkers int) error {
+	return nil
+}
+
+func (p timeoutProcessor) Process(ctx context.Context, req *InferenceRequest) *InferenceResponse {
+	*p.requests++
+	resp := &InferenceResponse{Label: "timeout", Latency: time.Millisecond, TotalResults: 4}
+	if *p.requests%2 == 0 {
+		resp.Err = &InferenceError{Kind: ErrorKindTimeout, Err: context.DeadlineExceeded}
+	}
+	return resp
+}
+
+func (p timeoutProcessor) Close() error { return nil }
+
+func TestTimedOutInferencesAreNotCounted(t *testing.T) {
+	var requests int
+	b := newTestRunner(t, 6)
+	result := runTestRunner(t, b, func() ProcessorV2 { return timeoutProcessor{&requests} })
+	if result.Totals["TimedOut"] != 3.0 || result.Totals["Successes"] != 3.0 || result.Totals["Errors"] != 0.0 {
+		t.Errorf("Totals = %v, want 3 timed out requests, 3 successes and no errors", result.Totals)
+	}
+	if b.inferenceCount != 12 || b.benchInferenceCount != 12 {
+		t.Errorf("counted %d inferences, %d in the benchmark, want the 12 of the requests that did not time out", b.inferenceCount, b.benchInferenceCount)
+	}
+	if total := b.sp.StatsMapping[labelAllQueries].sumTotalResults; total != 12 {
+		t.Errorf("stats sum up %v results, want 12", total)
+	}
+}
+
+// slowInitProcessor is a ProcessorV2 taking 200ms to initialize
+type slowInitProcessor struct{ bytesProcessor }
+
+func (p slowInitProcessor) Init(ctx context.Context, workerNum int, totalWorkers int) error {
+	time.Sleep(200 * time.Millisecond)
+	return nil
+}
+
+func TestOpenLoopScheduleStartsAfterInit(t *testing.T) {
+	b := newTestRunner(t, 5)
+	b.openLoop = true
+	b.limitrps = 1000
+	b.arrivalDistribution = arrivalConstant
+	runTestRunner(t, b, func() ProcessorV2 { return slowInitProcessor{} })
+	// the latencies include the queueing delay, that would include the Init time when the schedule
+	// started before it
+	if max := b.sp.StatsMapping[labelAllQueries].latencyHDRHistogram.Max(); max > 100000 {
+		t.Errorf("max latency = %dus, want the Init time left out of the queueing delay", max)
+	}
+}
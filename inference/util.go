@@ -2,9 +2,12 @@ package inference
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"math"
 	"math/rand"
 	"strconv"
+	"strings"
 )
 
 func ConvertSliceStringToFloat(transactionDataString []string) []float32 {
@@ -45,3 +48,27 @@ func Float32bytes(float float32) []byte {
 	binary.LittleEndian.PutUint32(bytes, bits)
 	return bytes
 }
+
+// IsTimeout reports whether err is due to a request timeout or deadline, as returned by
+// the net package, fasthttp, go-redis or a context.Context deadline
+func IsTimeout(err error) bool {
+	var timeoutErr interface{ Timeout() bool }
+	return errors.As(err, &timeoutErr) && timeoutErr.Timeout()
+}
+
+// ParseTensorShape parses comma separated tensor dimensions, e.g. "224,224,3"
+func ParseTensorShape(shape string) ([]int64, error) {
+	fields := strings.Split(shape, ",")
+	dims := make([]int64, len(fields))
+	for i, field := range fields {
+		dim, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tensor shape %q: %v", shape, err)
+		}
+		if dim <= 0 {
+			return nil, fmt.Errorf("invalid tensor shape %q: dimensions must be positive", shape)
+		}
+		dims[i] = dim
+	}
+	return dims, nil
+}
@@ -2,6 +2,9 @@ package inference
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 )
 
@@ -22,3 +25,30 @@ func testIfInInt64Slice(t *testing.T, arr []int64, choice int64) {
 	}
 	t.Errorf("could known find choice in array: %d", choice)
 }
+
+func TestIsTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	if !IsTimeout(ctx.Err()) {
+		t.Errorf("expected a context deadline to be a timeout")
+	}
+	if !IsTimeout(fmt.Errorf("wrapped: %w", ctx.Err())) {
+		t.Errorf("expected a wrapped context deadline to be a timeout")
+	}
+	if IsTimeout(errors.New("connection refused")) || IsTimeout(nil) {
+		t.Errorf("expected plain errors not to be timeouts")
+	}
+}
+
+func TestParseTensorShape(t *testing.T) {
+	dims, err := ParseTensorShape("224, 224,3")
+	if err != nil || len(dims) != 3 || dims[0] != 224 || dims[1] != 224 || dims[2] != 3 {
+		t.Errorf("ParseTensorShape() = %v, %v, want [224 224 3]", dims, err)
+	}
+	for _, shape := range []string{"", "224,x", "224,0"} {
+		if _, err := ParseTensorShape(shape); err == nil {
+			t.Errorf("ParseTensorShape(%q) expected an error", shape)
+		}
+	}
+}
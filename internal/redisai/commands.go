@@ -0,0 +1,206 @@
+// Package redisai builds the RedisAI commands issued by the RedisAI runners, in either the
+// legacy syntax (AI.MODELRUN, AI.DAGRUN) or the one introduced by RedisAI 1.2
+// (AI.MODELEXECUTE, AI.SCRIPTEXECUTE, AI.DAGEXECUTE), so that both can be benchmarked on the
+// same dataset.
+package redisai
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/RedisAI/aibench/inference"
+	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// CommandAPI selects the syntax of the issued commands
+type CommandAPI string
+
+const (
+	// LegacyAPI issues AI.MODELRUN and AI.DAGRUN
+	LegacyAPI CommandAPI = "legacy"
+	// ExecuteAPI issues AI.MODELEXECUTE, AI.SCRIPTEXECUTE and AI.DAGEXECUTE
+	ExecuteAPI CommandAPI = "execute"
+)
+
+// ParseCommandAPI validates the -command-api flag value
+func ParseCommandAPI(s string) (CommandAPI, error) {
+	switch api := CommandAPI(s); api {
+	case LegacyAPI, ExecuteAPI:
+		return api, nil
+	}
+	return "", fmt.Errorf("unknown command api %q, expected %q or %q", s, LegacyAPI, ExecuteAPI)
+}
+
+// ModelCommand returns the name of the model run command
+func (api CommandAPI) ModelCommand() string {
+	if api == ExecuteAPI {
+		return "AI.MODELEXECUTE"
+	}
+	return "AI.MODELRUN"
+}
+
+// ScriptCommand returns the name of the script run command
+func (api CommandAPI) ScriptCommand() string {
+	if api == ExecuteAPI {
+		return "AI.SCRIPTEXECUTE"
+	}
+	return "AI.SCRIPTRUN"
+}
+
+// DAGCommand returns the name of the DAG run command
+func (api CommandAPI) DAGCommand() string {
+	if api == ExecuteAPI {
+		return "AI.DAGEXECUTE"
+	}
+	return "AI.DAGRUN"
+}
+
+// TensorSet returns the AI.TENSORSET arguments of a tensor out of its raw blob,
+// whose syntax is the same on both apis
+func TensorSet(key string, dtype string, shape []string, blob []byte) []string {
+	args := make([]string, 0, len(shape)+5)
+	args = append(args, "AI.TENSORSET", key, dtype)
+	args = append(args, shape...)
+	return append(args, "BLOB", string(blob))
+}
+
+// TensorGet returns the AI.TENSORGET arguments reading the tensor blob
+func TensorGet(key string) []string {
+	return []string{"AI.TENSORGET", key, "BLOB"}
+}
+
+// ModelRun returns the model run command and arguments, the execute api prefixing
+// the inputs and outputs by their count
+func (api CommandAPI) ModelRun(model string, inputs []string, outputs []string) []string {
+	args := []string{api.ModelCommand(), model, "INPUTS"}
+	if api == ExecuteAPI {
+		args = append(args, strconv.Itoa(len(inputs)))
+	}
+	args = append(args, inputs...)
+	args = append(args, "OUTPUTS")
+	if api == ExecuteAPI {
+		args = append(args, strconv.Itoa(len(outputs)))
+	}
+	return append(args, outputs...)
+}
+
+// ScriptRun returns the script run command and arguments calling fn of script. The script
+// functions signature differs between the apis: the execute api passes the inputs as a
+// list of tensors, see RedisAI AI.SCRIPTEXECUTE
+func (api CommandAPI) ScriptRun(script string, fn string, inputs []string, outputs []string) []string {
+	args := []string{api.ScriptCommand(), script, fn, "INPUTS"}
+	if api == ExecuteAPI {
+		args = append(args, strconv.Itoa(len(inputs)))
+	}
+	args = append(args, inputs...)
+	args = append(args, "OUTPUTS")
+	if api == ExecuteAPI {
+		args = append(args, strconv.Itoa(len(outputs)))
+	}
+	return append(args, outputs...)
+}
+
+// ScriptSet returns the command and arguments storing the TorchScript source on device,
+// the execute api declaring the functions called by AI.SCRIPTEXECUTE, its entryPoints
+func (api CommandAPI) ScriptSet(key string, device string, entryPoints []string, source string) []string {
+	if api == ExecuteAPI {
+		args := []string{"AI.SCRIPTSTORE", key, device, "ENTRY_POINTS", strconv.Itoa(len(entryPoints))}
+		args = append(args, entryPoints...)
+		return append(args, "SOURCE", source)
+	}
+	return []string{"AI.SCRIPTSET", key, device, "SOURCE", source}
+}
+
+// OpPhase returns the latency phase name of a command issued on its own round trip
+func OpPhase(op []string) string {
+	switch op[0] {
+	case "AI.TENSORSET":
+		return inference.PhaseTensorSet
+	case "AI.MODELRUN", "AI.MODELEXECUTE":
+		return inference.PhaseModelRun
+	case "AI.TENSORGET":
+		return inference.PhaseTensorGet
+	}
+	return strings.ToLower(strings.TrimPrefix(op[0], "AI."))
+}
+
+// DAG describes a DAG run: the keys loaded from and persisted to the keyspace,
+// and the operations, each one being a command and its arguments
+type DAG struct {
+	Load    []string
+	Persist []string
+	// Routing is the key routing the DAG to its shard, required by AI.DAGEXECUTE when
+	// the DAG neither loads nor persists keys. It is ignored by the legacy api
+	Routing string
+	Ops     [][]string
+}
+
+// DAGRun returns the DAG run command name and its arguments
+func (api CommandAPI) DAGRun(dag DAG) (string, []string) {
+	var args []string
+	if len(dag.Load) > 0 {
+		args = append(args, "LOAD", strconv.Itoa(len(dag.Load)))
+		args = append(args, dag.Load...)
+	}
+	if len(dag.Persist) > 0 {
+		args = append(args, "PERSIST", strconv.Itoa(len(dag.Persist)))
+		args = append(args, dag.Persist...)
+	}
+	if api == ExecuteAPI && len(dag.Load) == 0 && len(dag.Persist) == 0 {
+		args = append(args, "ROUTING", dag.Routing)
+	}
+	for _, op := range dag.Ops {
+		args = append(args, "|>")
+		args = append(args, op...)
+	}
+	return api.DAGCommand(), args
+}
+
+// DAGOutput returns the tensor blob read by the last op of a DAG reply, a TensorGet, or nil when the
+// reply doesn't end with a blob
+func DAGOutput(reply []interface{}) []byte {
+	if len(reply) == 0 {
+		return nil
+	}
+	blob, _ := reply[len(reply)-1].([]byte)
+	return blob
+}
+
+// SizedCmd returns radix.Cmd(rcv, cmd, args...), adding the RESP encoded size of the command to *sent,
+// and the one of its reply to *received once it is read. It is still a plain radix command, so that
+// the pools keep pipelining it implicitly
+func SizedCmd(sent *uint64, received *uint64, rcv interface{}, cmd string, args ...string) radix.CmdAction {
+	*sent += commandSize(cmd, args)
+	return radix.Cmd(sizedReply{rcv: rcv, size: received}, cmd, args...)
+}
+
+// commandSize returns the RESP encoded size of a command, an array of bulk strings
+func commandSize(cmd string, args []string) uint64 {
+	bulkSize := func(s string) int {
+		return 1 + len(strconv.Itoa(len(s))) + 2 + len(s) + 2
+	}
+	size := 1 + len(strconv.Itoa(len(args)+1)) + 2 + bulkSize(cmd)
+	for _, arg := range args {
+		size += bulkSize(arg)
+	}
+	return uint64(size)
+}
+
+// sizedReply decodes a reply into rcv as radix.Cmd does, adding its RESP encoded size to *size
+type sizedReply struct {
+	rcv  interface{}
+	size *uint64
+}
+
+// UnmarshalRESP implements resp.Unmarshaler. Error replies are returned as resp2.Error, once read
+func (r sizedReply) UnmarshalRESP(br *bufio.Reader) error {
+	var raw resp2.RawMessage
+	if err := raw.UnmarshalRESP(br); err != nil {
+		return err
+	}
+	*r.size += uint64(len(raw))
+	return raw.UnmarshalInto(resp2.Any{I: r.rcv})
+}
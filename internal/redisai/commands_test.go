@@ -0,0 +1,126 @@
+package redisai
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+func TestParseCommandAPI(t *testing.T) {
+	for _, s := range []string{"legacy", "execute"} {
+		if api, err := ParseCommandAPI(s); err != nil || string(api) != s {
+			t.Errorf("ParseCommandAPI(%q) = %q, %v", s, api, err)
+		}
+	}
+	if _, err := ParseCommandAPI("v2"); err == nil {
+		t.Errorf("ParseCommandAPI(\"v2\") expected an error")
+	}
+}
+
+func TestModelRun(t *testing.T) {
+	tests := []struct {
+		api  CommandAPI
+		want []string
+	}{
+		{LegacyAPI, []string{"AI.MODELRUN", "m", "INPUTS", "a", "b", "OUTPUTS", "c"}},
+		{ExecuteAPI, []string{"AI.MODELEXECUTE", "m", "INPUTS", "2", "a", "b", "OUTPUTS", "1", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.api), func(t *testing.T) {
+			if got := tt.api.ModelRun("m", []string{"a", "b"}, []string{"c"}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ModelRun() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScriptRun(t *testing.T) {
+	tests := []struct {
+		api  CommandAPI
+		want []string
+	}{
+		{LegacyAPI, []string{"AI.SCRIPTRUN", "s", "pre", "INPUTS", "a", "OUTPUTS", "b"}},
+		{ExecuteAPI, []string{"AI.SCRIPTEXECUTE", "s", "pre", "INPUTS", "1", "a", "OUTPUTS", "1", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.api), func(t *testing.T) {
+			if got := tt.api.ScriptRun("s", "pre", []string{"a"}, []string{"b"}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ScriptRun() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpPhase(t *testing.T) {
+	tests := []struct {
+		op   []string
+		want string
+	}{
+		{TensorSet("a", "FLOAT", []string{"1"}, nil), "tensorset"},
+		{LegacyAPI.ModelRun("m", []string{"a"}, []string{"b"}), "modelrun"},
+		{ExecuteAPI.ModelRun("m", []string{"a"}, []string{"b"}), "modelrun"},
+		{TensorGet("b"), "tensorget"},
+		{ExecuteAPI.ScriptRun("s", "pre", []string{"a"}, []string{"b"}), "scriptexecute"},
+	}
+	for _, tt := range tests {
+		if got := OpPhase(tt.op); got != tt.want {
+			t.Errorf("OpPhase(%v) = %q, want %q", tt.op[0], got, tt.want)
+		}
+	}
+}
+
+func TestDAGRun(t *testing.T) {
+	ops := [][]string{{"AI.TENSORGET", "c", "BLOB"}}
+	tests := []struct {
+		name     string
+		api      CommandAPI
+		dag      DAG
+		wantCmd  string
+		wantArgs []string
+	}{
+		{"legacy", LegacyAPI, DAG{Routing: "a", Ops: ops},
+			"AI.DAGRUN", []string{"|>", "AI.TENSORGET", "c", "BLOB"}},
+		{"legacy load and persist", LegacyAPI, DAG{Load: []string{"a"}, Persist: []string{"c"}, Ops: ops},
+			"AI.DAGRUN", []string{"LOAD", "1", "a", "PERSIST", "1", "c", "|>", "AI.TENSORGET", "c", "BLOB"}},
+		{"execute routing", ExecuteAPI, DAG{Routing: "a", Ops: ops},
+			"AI.DAGEXECUTE", []string{"ROUTING", "a", "|>", "AI.TENSORGET", "c", "BLOB"}},
+		{"execute load", ExecuteAPI, DAG{Load: []string{"a"}, Routing: "a", Ops: ops},
+			"AI.DAGEXECUTE", []string{"LOAD", "1", "a", "|>", "AI.TENSORGET", "c", "BLOB"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, args := tt.api.DAGRun(tt.dag)
+			if cmd != tt.wantCmd || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("DAGRun() = %s %v, want %s %v", cmd, args, tt.wantCmd, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestSizedCmd(t *testing.T) {
+	conn := radix.Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		if args[0] == "FAIL" {
+			return resp2.Error{E: errors.New("ERR failed")}
+		}
+		return []byte("blob")
+	})
+	var sent, received uint64
+	var blob []byte
+	if err := conn.Do(SizedCmd(&sent, &received, &blob, "AI.TENSORGET", "t", "BLOB")); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	wantSent := uint64(len("*3\r\n$12\r\nAI.TENSORGET\r\n$1\r\nt\r\n$4\r\nBLOB\r\n"))
+	if string(blob) != "blob" || sent != wantSent || received != uint64(len("$4\r\nblob\r\n")) {
+		t.Errorf("Do() = %q, %d bytes sent and %d received, want \"blob\", %d and 10", blob, sent, received, wantSent)
+	}
+
+	sent, received = 0, 0
+	err := conn.Do(SizedCmd(&sent, &received, nil, "FAIL"))
+	var serverErr resp2.Error
+	if !errors.As(err, &serverErr) || received != uint64(len("-ERR failed\r\n")) {
+		t.Errorf("Do() on an error reply = %v with %d bytes received, want the server error and 13 bytes", err, received)
+	}
+}
@@ -0,0 +1,199 @@
+package redisai
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/RedisAI/aibench/inference"
+	"github.com/mediocregopher/radix/v3"
+)
+
+// aiInfoFields are the AI.INFO fields kept by the Collector
+var aiInfoFields = []string{"duration", "samples", "calls", "errors"}
+
+// Collector is an inference.MetricCollector of the Redis servers runtime stats, by host: the AI.INFO
+// stats of the benchmarked models and scripts, the INFO COMMANDSTATS, INFO MEMORY and INFO CPU fields,
+// and the ai_cpu section of INFO MODULES. The AI.INFO and the command stats are reset on each
+// collection, so they cover the last reporting period.
+//
+// The server CPU seconds used over the last reporting period are derived out of INFO CPU as
+// server_cpu_secs. The ones of all of the hosts are summed up and divided by the number of inferences
+// over the period as server_cpu_secs_per_inference, set on each host, see CountPer. Both are only set
+// from the second collection on
+type Collector struct {
+	hosts    []string
+	clients  []radix.Client
+	keys     []string
+	hostKeys map[string][]string
+
+	unit  string
+	count func() uint64
+
+	collected bool
+	prevCPU   []float64
+	prevCount uint64
+}
+
+// NewCollector returns the Collector of the servers at hosts, through clients. The AI.INFO stats
+// of the first of keys (the benchmarked model) are stored as ai_info.<field>, and the ones of
+// the other keys (e.g. scripts) as ai_info.<key>.<field>
+func NewCollector(hosts []string, clients []radix.Client, keys ...string) *Collector {
+	return &Collector{
+		hosts:   hosts,
+		clients: clients,
+		keys:    keys,
+		unit:    "inference",
+		prevCPU: make([]float64, len(hosts)),
+	}
+}
+
+// NewServingCollector returns the MetricCollector of the runners of the model servers other than
+// RedisAI: the model server metrics scraped on metricsFlags, when enabled, combined with the Collector
+// of the reference data Redis server at redisHost, when the runner uses it
+func NewServingCollector(runner *inference.BenchmarkRunner, metricsFlags *inference.PrometheusFlags, redisHost string) inference.MetricCollector {
+	var collectors []inference.MetricCollector
+	if metricsFlags.Enabled() {
+		collectors = append(collectors, metricsFlags.Collector())
+	}
+	if runner.UseReferenceDataRedis() {
+		conn, err := radix.Dial("tcp", redisHost)
+		if err != nil {
+			log.Fatalf("Error preparing for metrics collectors, while connecting to %s. error = %v", redisHost, err)
+		}
+		collectors = append(collectors, NewCollector([]string{redisHost}, []radix.Client{conn}).CountPer("inference", runner.InferenceCount))
+	}
+	return inference.CombineCollectors(collectors...)
+}
+
+// HostKeys sets the keys of some of the hosts, instead of the NewCollector ones, e.g. the
+// copy of the model of each shard of a cluster
+func (c *Collector) HostKeys(keys map[string][]string) *Collector {
+	c.hostKeys = keys
+	return c
+}
+
+// CountPer sets the count of units (e.g. inferences, or commands for the loaders) issued so far,
+// the server CPU seconds per unit are derived from
+func (c *Collector) CountPer(unit string, count func() uint64) *Collector {
+	c.unit = unit
+	c.count = count
+	return c
+}
+
+// CollectRunTimeMetrics implements inference.MetricCollector
+func (c *Collector) CollectRunTimeMetrics() (ts int64, stats interface{}, err error) {
+	var count uint64
+	if c.count != nil {
+		count = c.count()
+	}
+	hostsMetrics := make(map[string]interface{})
+	var cpuSecs float64
+	for pos, client := range c.clients {
+		var modulesInfo, commandStats, memoryInfo, cpuInfo string
+		keys := c.keys
+		if hostKeys, ok := c.hostKeys[c.hosts[pos]]; ok {
+			keys = hostKeys
+		}
+		aiInfos := make([][]string, len(keys))
+		cmds := []radix.CmdAction{radix.FlatCmd(&modulesInfo, "INFO", "MODULES")}
+		for i, key := range keys {
+			cmds = append(cmds,
+				radix.FlatCmd(&aiInfos[i], "AI.INFO", key),
+				radix.FlatCmd(nil, "AI.INFO", key, "RESETSTAT"))
+		}
+		cmds = append(cmds,
+			radix.FlatCmd(&commandStats, "INFO", "COMMANDSTATS"),
+			radix.FlatCmd(&memoryInfo, "INFO", "MEMORY"),
+			radix.FlatCmd(&cpuInfo, "INFO", "CPU"),
+			radix.FlatCmd(nil, "CONFIG", "RESETSTAT"),
+		)
+		if err = client.Do(radix.Pipeline(cmds...)); err != nil {
+			return
+		}
+		kvmap := make(map[string]interface{})
+		for i, key := range keys {
+			prefix := "ai_info."
+			if i > 0 {
+				prefix += key + "."
+			}
+			parseAIInfo(aiInfos[i], prefix, kvmap)
+		}
+		parseInfoSection(commandStats, "Commandstats", kvmap)
+		parseInfoSection(memoryInfo, "Memory", kvmap)
+		parseInfoSection(cpuInfo, "CPU", kvmap)
+		parseInfoSection(modulesInfo, "ai_cpu", kvmap)
+		hostCPUSecs, ok := c.deriveCPU(pos, kvmap)
+		cpuSecs += hostCPUSecs
+		if !ok {
+			cpuSecs = math.NaN()
+		}
+		hostsMetrics[c.hosts[pos]] = kvmap
+	}
+	c.setCPUPerUnit(cpuSecs, count, hostsMetrics)
+	c.collected = true
+	c.prevCount = count
+	stats = hostsMetrics
+	return
+}
+
+// deriveCPU sets and returns the server CPU seconds used since the previous collection of the host
+// at pos. ok is false when they are unknown
+func (c *Collector) deriveCPU(pos int, kvmap map[string]interface{}) (cpuSecs float64, ok bool) {
+	sys, errSys := strconv.ParseFloat(fmt.Sprint(kvmap["used_cpu_sys"]), 64)
+	user, errUser := strconv.ParseFloat(fmt.Sprint(kvmap["used_cpu_user"]), 64)
+	if errSys != nil || errUser != nil {
+		return 0, false
+	}
+	cpu := sys + user
+	if c.collected {
+		cpuSecs, ok = cpu-c.prevCPU[pos], true
+		kvmap["server_cpu_secs"] = cpuSecs
+	}
+	c.prevCPU[pos] = cpu
+	return
+}
+
+// setCPUPerUnit sets the server CPU seconds of all of the hosts per unit issued since the previous
+// collection on each host, as the units are not accounted per host. It is left unset when the CPU
+// seconds of any host are unknown
+func (c *Collector) setCPUPerUnit(cpuSecs float64, count uint64, hostsMetrics map[string]interface{}) {
+	if !c.collected || count <= c.prevCount || math.IsNaN(cpuSecs) {
+		return
+	}
+	for _, kvmap := range hostsMetrics {
+		kvmap.(map[string]interface{})["server_cpu_secs_per_"+c.unit] = cpuSecs / float64(count-c.prevCount)
+	}
+}
+
+// parseAIInfo stores the kept fields of an AI.INFO reply, a list of field names and values
+func parseAIInfo(reply []string, prefix string, kvmap map[string]interface{}) {
+	for i := 0; i+1 < len(reply); i += 2 {
+		for _, field := range aiInfoFields {
+			if reply[i] == field {
+				kvmap[prefix+field] = reply[i+1]
+			}
+		}
+	}
+}
+
+// parseInfoSection stores the "key:value" lines of an INFO reply, from the line holding section
+// up to the next section header
+func parseInfoSection(info string, section string, kvmap map[string]interface{}) {
+	idx := strings.Index(info, section)
+	if idx < 0 {
+		return
+	}
+	info = info[idx:]
+	if end := strings.Index(info, "# "); end > -1 {
+		info = info[:end]
+	}
+	for _, line := range strings.Split(info, "\r\n")[1:] {
+		kv := strings.Split(line, ":")
+		if len(kv) == 2 {
+			kvmap[kv[0]] = kv[1]
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package redisai
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestParseInfoSection(t *testing.T) {
+	modules := "# Modules\r\nmodule:name=ai,ver=10003\r\n\r\n# ai_git\r\nai_git_sha:abc\r\n\r\n# ai_cpu\r\nai_self_used_cpu_sys:1.5\r\nai_self_used_cpu_user:2.5\r\n\r\n# ai_backends_info\r\nai_TensorFlow_version:1.15.0\r\n"
+	kvmap := map[string]interface{}{}
+	parseInfoSection(modules, "ai_cpu", kvmap)
+	if len(kvmap) != 2 || kvmap["ai_self_used_cpu_sys"] != "1.5" || kvmap["ai_self_used_cpu_user"] != "2.5" {
+		t.Errorf("parseInfoSection(ai_cpu) = %v", kvmap)
+	}
+
+	kvmap = map[string]interface{}{}
+	parseInfoSection("# Commandstats\r\ncmdstat_ai.dagrun:calls=10,usec=100,usec_per_call=10.00\r\n", "Commandstats", kvmap)
+	if kvmap["cmdstat_ai.dagrun"] != "calls=10,usec=100,usec_per_call=10.00" {
+		t.Errorf("parseInfoSection(Commandstats) = %v", kvmap)
+	}
+	parseAIInfo([]string{"key", "m", "type", "MODEL", "calls", "10", "samples", "20"}, "ai_info.", kvmap)
+	if kvmap["ai_info.calls"] != "10" || kvmap["ai_info.samples"] != "20" || kvmap["ai_info.key"] != nil {
+		t.Errorf("parseAIInfo() = %v", kvmap)
+	}
+}
+
+func TestCollectorDeriveCPU(t *testing.T) {
+	c := NewCollector([]string{"a", "b"}, nil)
+	first := map[string]interface{}{
+		"a": map[string]interface{}{"used_cpu_sys": "1.0", "used_cpu_user": "2.0"},
+		"b": map[string]interface{}{"used_cpu_sys": "0.5", "used_cpu_user": "0.5"},
+	}
+	var cpuSecs float64
+	for pos, host := range c.hosts {
+		if _, ok := c.deriveCPU(pos, first[host].(map[string]interface{})); ok {
+			t.Errorf("first collection derived %v, want no previous cpu", first[host])
+		}
+	}
+	c.setCPUPerUnit(cpuSecs, 100, first)
+	if _, ok := first["a"].(map[string]interface{})["server_cpu_secs_per_inference"]; ok {
+		t.Errorf("first collection derived %v, want no previous count", first)
+	}
+	c.collected, c.prevCount = true, 100
+	second := map[string]interface{}{
+		"a": map[string]interface{}{"used_cpu_sys": "1.5", "used_cpu_user": "3.5"},
+		"b": map[string]interface{}{"used_cpu_sys": "1.0", "used_cpu_user": "2.0"},
+	}
+	for pos, host := range c.hosts {
+		hostCPUSecs, ok := c.deriveCPU(pos, second[host].(map[string]interface{}))
+		if !ok || hostCPUSecs != 2.0 {
+			t.Errorf("second collection derived %v cpu secs of %s, want 2", hostCPUSecs, host)
+		}
+		cpuSecs += hostCPUSecs
+	}
+	// the inferences are not accounted per host, so the cpu secs of both hosts are divided by all of them
+	c.setCPUPerUnit(cpuSecs, 300, second)
+	for host, kvmap := range second {
+		if kvmap.(map[string]interface{})["server_cpu_secs_per_inference"] != 0.02 {
+			t.Errorf("second collection of %s derived %v, want 0.02 cpu secs per inference", host, kvmap)
+		}
+	}
+}
+
+func TestCollectorCPUPerInference(t *testing.T) {
+	// each collection reads one more cpu second
+	var cpuSecs int
+	conn := radix.Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		if len(args) == 2 && args[0] == "INFO" && args[1] == "CPU" {
+			cpuSecs++
+			return fmt.Sprintf("# CPU\r\nused_cpu_sys:%d.0\r\nused_cpu_user:0.0\r\n", cpuSecs)
+		}
+		return "OK"
+	})
+	var inferences uint64
+	c := NewCollector([]string{"a"}, []radix.Client{conn}).CountPer("inference", func() uint64 { return inferences })
+	collections := []struct {
+		inferences uint64
+		want       interface{}
+	}{
+		{0, nil},
+		{4, 0.25},
+		{4, nil}, // no inferences over the period
+	}
+	for i, collection := range collections {
+		inferences = collection.inferences
+		_, stats, err := c.CollectRunTimeMetrics()
+		if err != nil {
+			t.Fatalf("CollectRunTimeMetrics() error = %v", err)
+		}
+		if got := stats.(map[string]interface{})["a"].(map[string]interface{})["server_cpu_secs_per_inference"]; got != collection.want {
+			t.Errorf("collection %d derived %v cpu secs per inference, want %v", i, got, collection.want)
+		}
+	}
+}
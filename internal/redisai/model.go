@@ -0,0 +1,239 @@
+package redisai
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/RedisAI/aibench/inference"
+	"github.com/mediocregopher/radix/v3"
+)
+
+// ModelFlags describes the model set out of a -model-filename blob
+type ModelFlags struct {
+	Backend      string
+	Device       string
+	Tag          string
+	BatchSize    int64
+	MinBatchSize int64
+	Inputs       string
+	Outputs      string
+	ChunkSize    int
+}
+
+// RegisterModelFlags registers the model flags on the command line
+func RegisterModelFlags() *ModelFlags {
+	f := &ModelFlags{}
+	flag.StringVar(&f.Backend, "backend", "TF", "Model backend: TF, TFLITE, TORCH or ONNX")
+	flag.StringVar(&f.Device, "device", "CPU", "Device the model runs on, e.g. CPU or GPU:0")
+	flag.StringVar(&f.Tag, "tag", "", "Model tag, e.g. its version")
+	flag.Int64Var(&f.BatchSize, "model-batch-size", 0, "Server side auto-batching max batch size. 0 disables auto-batching")
+	flag.Int64Var(&f.MinBatchSize, "model-min-batch-size", 0, "Server side auto-batching min batch size")
+	flag.StringVar(&f.Inputs, "model-inputs", "", "Comma separated model input names, required by the TF backend")
+	flag.StringVar(&f.Outputs, "model-outputs", "", "Comma separated model output names, required by the TF backend")
+	flag.IntVar(&f.ChunkSize, "model-chunk-size", 64<<20, "Max size in bytes of each chunk the model blob is uploaded in, bounded server side by proto-max-bulk-len. 0 uploads the blob in a single chunk")
+	return f
+}
+
+// Config returns the expected config of model key
+func (f *ModelFlags) Config(key string) inference.ModelConfig {
+	return inference.ModelConfig{
+		Key:          key,
+		Backend:      f.Backend,
+		Device:       f.Device,
+		Tag:          f.Tag,
+		BatchSize:    f.BatchSize,
+		MinBatchSize: f.MinBatchSize,
+		Inputs:       splitNames(f.Inputs),
+		Outputs:      splitNames(f.Outputs),
+	}
+}
+
+func splitNames(names string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+	return strings.Split(names, ",")
+}
+
+// ModelSet returns the command and arguments setting the model out of its blob, split in chunks
+// of at most chunkSize bytes, or a single one when chunkSize is not positive
+func (api CommandAPI) ModelSet(model inference.ModelConfig, blob []byte, chunkSize int) []string {
+	args := []string{"AI.MODELSET", model.Key, model.Backend, model.Device}
+	if api == ExecuteAPI {
+		args[0] = "AI.MODELSTORE"
+	}
+	if len(model.Tag) > 0 {
+		args = append(args, "TAG", model.Tag)
+	}
+	if model.BatchSize > 0 {
+		args = append(args, "BATCHSIZE", strconv.FormatInt(model.BatchSize, 10))
+		if model.MinBatchSize > 0 {
+			args = append(args, "MINBATCHSIZE", strconv.FormatInt(model.MinBatchSize, 10))
+		}
+	}
+	if len(model.Inputs) > 0 {
+		args = append(args, "INPUTS")
+		if api == ExecuteAPI {
+			args = append(args, strconv.Itoa(len(model.Inputs)))
+		}
+		args = append(args, model.Inputs...)
+	}
+	if len(model.Outputs) > 0 {
+		args = append(args, "OUTPUTS")
+		if api == ExecuteAPI {
+			args = append(args, strconv.Itoa(len(model.Outputs)))
+		}
+		args = append(args, model.Outputs...)
+	}
+	args = append(args, "BLOB")
+	if chunkSize <= 0 || len(blob) <= chunkSize {
+		return append(args, string(blob))
+	}
+	for start := 0; start < len(blob); start += chunkSize {
+		end := start + chunkSize
+		if end > len(blob) {
+			end = len(blob)
+		}
+		args = append(args, string(blob[start:end]))
+	}
+	return args
+}
+
+// GetModelConfig returns the config of model key, as reported by AI.MODELGET META
+func GetModelConfig(client radix.Client, key string) (inference.ModelConfig, error) {
+	var reply []interface{}
+	if err := client.Do(radix.Cmd(&reply, "AI.MODELGET", key, "META")); err != nil {
+		return inference.ModelConfig{}, err
+	}
+	model := parseModelMeta(reply)
+	model.Key = key
+	return model, nil
+}
+
+// parseModelMeta parses the AI.MODELGET META reply, a list of field names and values
+func parseModelMeta(reply []interface{}) inference.ModelConfig {
+	var model inference.ModelConfig
+	for i := 0; i+1 < len(reply); i += 2 {
+		value := reply[i+1]
+		switch metaString(reply[i]) {
+		case "backend":
+			model.Backend = metaString(value)
+		case "device":
+			model.Device = metaString(value)
+		case "tag":
+			model.Tag = metaString(value)
+		case "batchsize":
+			model.BatchSize, _ = strconv.ParseInt(metaString(value), 10, 64)
+		case "minbatchsize":
+			model.MinBatchSize, _ = strconv.ParseInt(metaString(value), 10, 64)
+		case "inputs":
+			model.Inputs = metaStrings(value)
+		case "outputs":
+			model.Outputs = metaStrings(value)
+		}
+	}
+	return model
+}
+
+func metaString(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func metaStrings(value interface{}) []string {
+	values, _ := value.([]interface{})
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = metaString(v)
+	}
+	return names
+}
+
+// checkModelConfig returns an error when the config reported by the server differs from the
+// expected one. The inputs and outputs are only checked when expected, as some backends
+// don't require them
+func checkModelConfig(want inference.ModelConfig, got inference.ModelConfig) error {
+	var diffs []string
+	if !strings.EqualFold(want.Backend, got.Backend) {
+		diffs = append(diffs, fmt.Sprintf("backend %s, want %s", got.Backend, want.Backend))
+	}
+	if !strings.EqualFold(want.Device, got.Device) {
+		diffs = append(diffs, fmt.Sprintf("device %s, want %s", got.Device, want.Device))
+	}
+	if want.Tag != got.Tag {
+		diffs = append(diffs, fmt.Sprintf("tag %q, want %q", got.Tag, want.Tag))
+	}
+	if want.BatchSize != got.BatchSize || want.MinBatchSize != got.MinBatchSize {
+		diffs = append(diffs, fmt.Sprintf("batch size %d (min %d), want %d (min %d)", got.BatchSize, got.MinBatchSize, want.BatchSize, want.MinBatchSize))
+	}
+	if len(want.Inputs) > 0 && !reflect.DeepEqual(want.Inputs, got.Inputs) {
+		diffs = append(diffs, fmt.Sprintf("inputs %v, want %v", got.Inputs, want.Inputs))
+	}
+	if len(want.Outputs) > 0 && !reflect.DeepEqual(want.Outputs, got.Outputs) {
+		diffs = append(diffs, fmt.Sprintf("outputs %v, want %v", got.Outputs, want.Outputs))
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("model %s was set with %s", want.Key, strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// LoadModel sets the model out of its blob and checks the config reported back by the server,
+// which is returned
+func LoadModel(client radix.Client, api CommandAPI, model inference.ModelConfig, blob []byte, chunkSize int) (inference.ModelConfig, error) {
+	args := api.ModelSet(model, blob, chunkSize)
+	if err := client.Do(radix.Cmd(nil, args[0], args[1:]...)); err != nil {
+		return inference.ModelConfig{}, fmt.Errorf("%s %s: %w", args[0], model.Key, err)
+	}
+	got, err := GetModelConfig(client, model.Key)
+	if err != nil {
+		return inference.ModelConfig{}, fmt.Errorf("AI.MODELGET %s: %w", model.Key, err)
+	}
+	return got, checkModelConfig(model, got)
+}
+
+// SetupModel loads model key out of fileName on each of addrs, when fileName is set, and records the
+// model config reported by each server on the runner results. The loading errors are returned,
+// while the servers failing to report the config, e.g. when the model is not set yet, are only logged
+func SetupModel(runner *inference.BenchmarkRunner, addrs []string, api CommandAPI, key string, fileName string, flags *ModelFlags) error {
+	var blob []byte
+	if len(fileName) > 0 {
+		var err error
+		if blob, err = ioutil.ReadFile(fileName); err != nil {
+			return err
+		}
+	}
+	for _, addr := range addrs {
+		conn, err := radix.Dial("tcp", addr)
+		if err != nil {
+			return err
+		}
+		var model inference.ModelConfig
+		if blob != nil {
+			model, err = LoadModel(conn, api, flags.Config(key), blob, flags.ChunkSize)
+			if err != nil {
+				conn.Close()
+				return fmt.Errorf("%s: %w", addr, err)
+			}
+			fmt.Printf("Set model %s on %s out of %s (%d bytes)\n", key, addr, fileName, len(blob))
+		} else if model, err = GetModelConfig(conn, key); err != nil {
+			log.Printf("Error getting the model %s config of %s: %v", key, addr, err)
+			conn.Close()
+			continue
+		}
+		conn.Close()
+		model.Host = addr
+		runner.AddModelConfig(model)
+	}
+	return nil
+}
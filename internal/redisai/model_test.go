@@ -0,0 +1,57 @@
+package redisai
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/RedisAI/aibench/inference"
+)
+
+func TestModelSet(t *testing.T) {
+	model := inference.ModelConfig{Key: "m", Backend: "TF", Device: "CPU", BatchSize: 8, MinBatchSize: 2, Inputs: []string{"a", "b"}, Outputs: []string{"c"}}
+	tests := []struct {
+		name      string
+		api       CommandAPI
+		chunkSize int
+		want      []string
+	}{
+		{"legacy single chunk", LegacyAPI, 0,
+			[]string{"AI.MODELSET", "m", "TF", "CPU", "BATCHSIZE", "8", "MINBATCHSIZE", "2", "INPUTS", "a", "b", "OUTPUTS", "c", "BLOB", "12345"}},
+		{"legacy chunks", LegacyAPI, 2,
+			[]string{"AI.MODELSET", "m", "TF", "CPU", "BATCHSIZE", "8", "MINBATCHSIZE", "2", "INPUTS", "a", "b", "OUTPUTS", "c", "BLOB", "12", "34", "5"}},
+		{"execute", ExecuteAPI, 8,
+			[]string{"AI.MODELSTORE", "m", "TF", "CPU", "BATCHSIZE", "8", "MINBATCHSIZE", "2", "INPUTS", "2", "a", "b", "OUTPUTS", "1", "c", "BLOB", "12345"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.api.ModelSet(model, []byte("12345"), tt.chunkSize); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ModelSet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseModelMeta(t *testing.T) {
+	reply := []interface{}{
+		[]byte("backend"), []byte("TF"),
+		[]byte("device"), []byte("CPU"),
+		[]byte("tag"), []byte("v1"),
+		[]byte("batchsize"), int64(8),
+		[]byte("minbatchsize"), int64(2),
+		[]byte("inputs"), []interface{}{[]byte("transaction"), []byte("reference")},
+		[]byte("outputs"), []interface{}{[]byte("output")},
+	}
+	want := inference.ModelConfig{Backend: "TF", Device: "CPU", Tag: "v1", BatchSize: 8, MinBatchSize: 2,
+		Inputs: []string{"transaction", "reference"}, Outputs: []string{"output"}}
+	got := parseModelMeta(reply)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseModelMeta() = %+v, want %+v", got, want)
+	}
+	if err := checkModelConfig(want, got); err != nil {
+		t.Errorf("checkModelConfig() = %v, want nil", err)
+	}
+	want.Key, want.Device, want.BatchSize = "m", "GPU", 4
+	if err := checkModelConfig(want, got); err == nil {
+		t.Errorf("checkModelConfig() expected the device and batch size mismatch")
+	}
+}
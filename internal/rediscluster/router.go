@@ -0,0 +1,190 @@
+// Package rediscluster routes the RedisAI runners requests among the shards of a Redis Cluster.
+// The topology is discovered with CLUSTER SLOTS, each request is sent to the primary owning its
+// hash-tagged keys, and the MOVED and ASK redirects are followed.
+package rediscluster
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// maxRedirects bounds the redirects followed by a single request
+const maxRedirects = 5
+
+// Router sends requests to the primary owning their keys
+type Router struct {
+	cluster   *radix.Cluster
+	poolFunc  radix.ClientFunc
+	redirects uint64
+
+	// pools of the redirect targets left out of the topology, e.g. a
+	// new node with no slot yet which a slot is being migrated to
+	extraLock sync.Mutex
+	extra     map[string]radix.Client
+}
+
+// NewRouter discovers the cluster topology out of any of its nodes addrs. The pool of each
+// node is created with poolFunc, or radix.DefaultClientFunc when nil
+func NewRouter(addrs []string, poolFunc radix.ClientFunc) (*Router, error) {
+	if poolFunc == nil {
+		poolFunc = radix.DefaultClientFunc
+	}
+	cluster, err := radix.NewCluster(addrs, radix.ClusterPoolFunc(poolFunc))
+	if err != nil {
+		return nil, err
+	}
+	return &Router{cluster: cluster, poolFunc: poolFunc, extra: map[string]radix.Client{}}, nil
+}
+
+// Primaries returns the addresses of the cluster primaries
+func (r *Router) Primaries() []string {
+	primaries := r.cluster.Topo().Primaries()
+	addrs := make([]string, len(primaries))
+	for i, node := range primaries {
+		addrs[i] = node.Addr
+	}
+	return addrs
+}
+
+// AddrForKey returns the address of the primary owning the slot of key, empty when unknown
+func (r *Router) AddrForKey(key string) string {
+	slot := radix.ClusterSlot([]byte(key))
+	for _, node := range r.cluster.Topo().Primaries() {
+		for _, slots := range node.Slots {
+			if slot >= slots[0] && slot < slots[1] {
+				return node.Addr
+			}
+		}
+	}
+	return ""
+}
+
+// ShardTags returns, for each primary, a hash tag whose slot it owns, e.g. "{3}". The keys holding
+// it, like the copy of the model of each shard, are owned by that primary
+func (r *Router) ShardTags() map[string]string {
+	tags := map[string]string{}
+	for _, node := range r.cluster.Topo().Primaries() {
+		if tag := tagOwnedBy(node.Slots); len(tag) > 0 {
+			tags[node.Addr] = tag
+		}
+	}
+	return tags
+}
+
+// tagOwnedBy returns the first numeric hash tag whose slot is in slots, ranges with an exclusive
+// end, empty when slots are empty
+func tagOwnedBy(slots [][2]uint16) string {
+	if len(slots) == 0 {
+		return ""
+	}
+	// the numbers up to a few times the number of slots cover all of them
+	for i := 0; i < 1<<20; i++ {
+		tag := "{" + strconv.Itoa(i) + "}"
+		slot := radix.ClusterSlot([]byte(tag))
+		for _, r := range slots {
+			if slot >= r[0] && slot < r[1] {
+				return tag
+			}
+		}
+	}
+	return ""
+}
+
+// Do sends cmds, pipelined on a single connection, to the primary owning key, following the MOVED
+// and ASK redirects. All of the cmds keys are expected on the key slot, e.g. through a hash tag.
+// It returns the address of the node that replied
+func (r *Router) Do(key string, cmds ...radix.CmdAction) (string, error) {
+	addr := r.AddrForKey(key)
+	ask := false
+	for redirects := 0; ; redirects++ {
+		client, err := r.client(addr)
+		if err != nil {
+			return addr, err
+		}
+		action := Pipeline(cmds...)
+		if ask {
+			action = askingPipeline(cmds)
+		}
+		err = client.Do(action)
+		redirect, redirectAddr := parseRedirect(err)
+		if len(redirect) == 0 || redirects == maxRedirects {
+			return addr, err
+		}
+		atomic.AddUint64(&r.redirects, 1)
+		if redirect == "MOVED" {
+			// the slot moved for good, refresh the topology for the next requests
+			_ = r.cluster.Sync()
+		}
+		addr, ask = redirectAddr, redirect == "ASK"
+	}
+}
+
+// client returns the pool of the node at addr, creating it when addr is out of the topology
+func (r *Router) client(addr string) (radix.Client, error) {
+	if client, err := r.cluster.Client(addr); err == nil {
+		return client, nil
+	}
+	r.extraLock.Lock()
+	defer r.extraLock.Unlock()
+	if client, ok := r.extra[addr]; ok {
+		return client, nil
+	}
+	client, err := r.poolFunc("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	r.extra[addr] = client
+	return client, nil
+}
+
+// Redirects returns the number of MOVED and ASK redirects followed so far
+func (r *Router) Redirects() uint64 {
+	return atomic.LoadUint64(&r.redirects)
+}
+
+// Close closes the connections to every node
+func (r *Router) Close() error {
+	r.extraLock.Lock()
+	for _, client := range r.extra {
+		_ = client.Close()
+	}
+	r.extraLock.Unlock()
+	return r.cluster.Close()
+}
+
+// Pipeline returns the single command, or the pipeline of cmds
+func Pipeline(cmds ...radix.CmdAction) radix.Action {
+	if len(cmds) == 1 {
+		return cmds[0]
+	}
+	return radix.Pipeline(cmds...)
+}
+
+// askingPipeline precedes each command by ASKING, which only holds for the next command
+func askingPipeline(cmds []radix.CmdAction) radix.Action {
+	asking := make([]radix.CmdAction, 0, 2*len(cmds))
+	for _, cmd := range cmds {
+		asking = append(asking, radix.Cmd(nil, "ASKING"), cmd)
+	}
+	return radix.Pipeline(asking...)
+}
+
+// parseRedirect returns the kind (MOVED or ASK) and the target address of a redirect error,
+// and an empty kind for any other error
+func parseRedirect(err error) (string, string) {
+	var serverErr resp2.Error
+	if !errors.As(err, &serverErr) {
+		return "", ""
+	}
+	fields := strings.Fields(serverErr.E.Error())
+	if len(fields) < 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return "", ""
+	}
+	return fields[0], fields[2]
+}
@@ -0,0 +1,213 @@
+package rediscluster
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+func TestParseRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantKind string
+		wantAddr string
+	}{
+		{"moved", resp2.Error{E: errors.New("MOVED 3999 127.0.0.1:30002")}, "MOVED", "127.0.0.1:30002"},
+		{"wrapped ask", fmt.Errorf("pipeline: %w", resp2.Error{E: errors.New("ASK 3999 127.0.0.1:30003")}), "ASK", "127.0.0.1:30003"},
+		{"other server error", resp2.Error{E: errors.New("ERR model key is empty")}, "", ""},
+		{"connection error", errors.New("connection refused"), "", ""},
+		{"no error", nil, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, addr := parseRedirect(tt.err)
+			if kind != tt.wantKind || addr != tt.wantAddr {
+				t.Errorf("parseRedirect() = %q, %q, want %q, %q", kind, addr, tt.wantKind, tt.wantAddr)
+			}
+		})
+	}
+}
+
+// fakeNode is a minimal Redis Cluster node, owning every slot in its CLUSTER SLOTS reply,
+// and replying to any other command with reply
+type fakeNode struct {
+	listener net.Listener
+	mu       sync.Mutex
+	reply    func(cmd []string) string
+	commands [][]string
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &fakeNode{listener: listener, reply: func([]string) string { return "+OK\r\n" }}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go n.serve(conn)
+		}
+	}()
+	return n
+}
+
+func (n *fakeNode) addr() string {
+	return n.listener.Addr().String()
+}
+
+func (n *fakeNode) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		n.mu.Lock()
+		n.commands = append(n.commands, cmd)
+		reply := n.reply
+		n.mu.Unlock()
+		if strings.EqualFold(cmd[0], "CLUSTER") {
+			host, port, _ := net.SplitHostPort(n.addr())
+			fmt.Fprintf(conn, "*1\r\n*3\r\n:0\r\n:16383\r\n*3\r\n$%d\r\n%s\r\n:%s\r\n$2\r\nid\r\n", len(host), host, port)
+			continue
+		}
+		_, _ = conn.Write([]byte(reply(cmd)))
+	}
+}
+
+func (n *fakeNode) names() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	names := make([]string, 0, len(n.commands))
+	for _, cmd := range n.commands {
+		names = append(names, cmd[0])
+	}
+	return names
+}
+
+// readCommand reads a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	cmd := make([]string, count)
+	for i := range cmd {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		cmd[i] = string(buf[:size])
+	}
+	return cmd, nil
+}
+
+func TestRouterRedirects(t *testing.T) {
+	owner := newFakeNode(t)
+	defer owner.listener.Close()
+	target := newFakeNode(t)
+	defer target.listener.Close()
+
+	router, err := NewRouter([]string{owner.addr()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+	if primaries := router.Primaries(); len(primaries) != 1 || primaries[0] != owner.addr() {
+		t.Fatalf("Primaries() = %v, want [%s]", primaries, owner.addr())
+	}
+	if tags := router.ShardTags(); len(tags) != 1 || tags[owner.addr()] != "{0}" {
+		t.Errorf("ShardTags() = %v, want {0} for %s", tags, owner.addr())
+	}
+
+	// the slot is being migrated: ASK to target, without moving the slot
+	owner.mu.Lock()
+	owner.reply = func(cmd []string) string {
+		if cmd[0] == "AI.DAGRUN" {
+			return "-ASK 1 " + target.addr() + "\r\n"
+		}
+		return "+OK\r\n"
+	}
+	owner.mu.Unlock()
+	addr, err := router.Do("imageTensor:{w1}", radix.Cmd(nil, "AI.DAGRUN", "|>", "AI.TENSORGET", "imageTensor:{w1}"))
+	if err != nil || addr != target.addr() {
+		t.Fatalf("Do() = %s, %v, want %s, nil", addr, err, target.addr())
+	}
+	if names := target.names(); len(names) != 2 || names[0] != "ASKING" || names[1] != "AI.DAGRUN" {
+		t.Errorf("target got %v, want [ASKING AI.DAGRUN]", names)
+	}
+	if router.Redirects() != 1 {
+		t.Errorf("Redirects() = %d, want 1", router.Redirects())
+	}
+
+	// a pipeline MOVED on its first command is retried as a whole
+	owner.mu.Lock()
+	owner.reply = func(cmd []string) string {
+		if cmd[0] == "AI.TENSORSET" {
+			return "-MOVED 1 " + target.addr() + "\r\n"
+		}
+		return "-ERR tensor key is empty\r\n"
+	}
+	owner.mu.Unlock()
+	addr, err = router.Do("imageTensor:{w1}",
+		radix.Cmd(nil, "AI.TENSORSET", "imageTensor:{w1}"),
+		radix.Cmd(nil, "AI.TENSORGET", "imageTensor:{w1}"))
+	if err != nil || addr != target.addr() {
+		t.Fatalf("Do() = %s, %v, want %s, nil", addr, err, target.addr())
+	}
+	if router.Redirects() != 2 {
+		t.Errorf("Redirects() = %d, want 2", router.Redirects())
+	}
+}
+
+func TestTagOwnedBy(t *testing.T) {
+	tests := []struct {
+		name  string
+		slots [][2]uint16
+	}{
+		{"every slot", [][2]uint16{{0, 16384}}},
+		{"first half", [][2]uint16{{0, 8192}}},
+		{"second half", [][2]uint16{{8192, 16384}}},
+		{"single slot", [][2]uint16{{1000, 1001}}},
+		{"several ranges", [][2]uint16{{10, 11}, {16000, 16001}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag := tagOwnedBy(tt.slots)
+			slot := radix.ClusterSlot([]byte("model" + tag))
+			owned := false
+			for _, r := range tt.slots {
+				owned = owned || (slot >= r[0] && slot < r[1])
+			}
+			if !owned {
+				t.Errorf("tagOwnedBy(%v) = %q, whose slot %d is out of the ranges", tt.slots, tag, slot)
+			}
+		})
+	}
+	if tag := tagOwnedBy(nil); tag != "" {
+		t.Errorf("tagOwnedBy(nil) = %q, want none", tag)
+	}
+}
@@ -0,0 +1,63 @@
+import json
+import sys
+
+# Outputs the server and client process CPU usage of each reporting period of an aibench
+# json result, as sampled out of /proc on -server-pid or -server-process-name runs
+
+
+def sample(stats, timestamps, tick):
+    if tick >= len(timestamps):
+        return None, 0
+    timeframe = (float(timestamps[tick]) - float(timestamps[tick - 1])) / 1000000000.0
+    return stats[timestamps[tick]], timeframe
+
+
+def cpu_pct(stats, timeframe):
+    if stats is None or "cpu_secs" not in stats or timeframe <= 0:
+        return ""
+    return float(stats["cpu_secs"]) / timeframe * 100.0
+
+
+def cpu_secs_per_inference(stats):
+    if stats is None:
+        return ""
+    return stats.get("cpu_secs_per_inference", "")
+
+
+with open(sys.argv[1]) as json_file:
+    dd = json.load(json_file)
+    server_stats = dd["ServerProcessStats"] or {}
+    client_stats = dd["ClientProcessStats"] or {}
+    if len(server_stats) == 0:
+        print(
+            "Warning! There are no server process stats on this result. Run the benchmark with -server-pid or -server-process-name to collect them.",
+        )
+    print(
+        "{},{},{},{},{},{},{}".format(
+            "timeframe",
+            "server_cpu_pct [0,100*#CORES]",
+            "server_cpu_secs_per_inference",
+            "server_rss_bytes",
+            "server_threads",
+            "client_cpu_pct [0,100*#CORES]",
+            "client_cpu_secs_per_inference",
+        )
+    )
+
+    # both processes are sampled on each reporting period, by their own tickers
+    server_ts = sorted(server_stats.keys(), key=int)
+    client_ts = sorted(client_stats.keys(), key=int)
+    for tick in range(1, max(len(server_ts), len(client_ts))):
+        server, server_period = sample(server_stats, server_ts, tick)
+        client, client_period = sample(client_stats, client_ts, tick)
+        print(
+            "{},{},{},{},{},{},{}".format(
+                server_period or client_period,
+                cpu_pct(server, server_period),
+                cpu_secs_per_inference(server),
+                server["rss_bytes"] if server is not None else "",
+                server["threads"] if server is not None else "",
+                cpu_pct(client, client_period),
+                cpu_secs_per_inference(client),
+            )
+        )
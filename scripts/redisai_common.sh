@@ -22,6 +22,8 @@ DATA_SEED=${DATA_SEED:-12345}
 MODEL_NAME=${MODEL_NAME:-"financialNet"}
 MODEL_NAME_NOREFERENCE=${MODEL_NAME_NOREFERENCE:-"financialNet_NoReference"}
 SETUP_MODEL=${SETUP_MODEL:-"true"}
+# RedisAI commands syntax: legacy (AI.MODELRUN, AI.DAGRUN) or execute (AI.MODELEXECUTE, AI.DAGEXECUTE)
+COMMAND_API=${COMMAND_API:-"legacy"}
 REDIS_PIPELINE_SIZE=${REDIS_PIPELINE_SIZE:-100}
 DEBUG=${DEBUG:-0}
 DATA_FILE_NAME=${DATA_FILE_NAME:-aibench_generate_data-creditcard-fraud.dat}
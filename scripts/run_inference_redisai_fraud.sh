@@ -47,6 +47,7 @@ for REFERENCE_DATA in "false"; do
           -enable-reference-data-redis=${REFERENCE_DATA} \
           -host=${DATABASE_HOST} \
           -port=${DATABASE_PORT} \
+          -command-api=${COMMAND_API} \
           -output-file-stats-hdr-response-latency-hist=~/HIST_${FILENAME_SUFFIX} \
           2>&1 | tee ~/RAW_${FILENAME_SUFFIX}
 
@@ -105,6 +105,7 @@ if [[ "${BACKEND}" = "TF" ]]; then
           -reporting-period=1000ms \
           -host=${DATABASE_HOST} \
           -port=${DATABASE_PORT} \
+          -command-api=${COMMAND_API} \
           -json-out-file=./results/JSON_${FILENAME_SUFFIX}.json \
           2>&1 | tee ./results/RAW_${FILENAME_SUFFIX}.txt
 
@@ -183,6 +184,7 @@ for NUM_WORKERS in $(seq ${MIN_CLIENTS} ${CLIENTS_STEP} ${MAX_CLIENTS}); do
         -reporting-period=1000ms \
         -host=${DATABASE_HOST} \
         -port=${DATABASE_PORT} \
+        -command-api=${COMMAND_API} \
         -json-out-file=./results/JSON_${FILENAME_SUFFIX}.json \
         2>&1 | tee ./results/RAW_${FILENAME_SUFFIX}.txt
 
@@ -0,0 +1,13 @@
+# TorchScript pre/post-processing of the mobilenet_v1_100_224 vision benchmark (AI.SCRIPTRUN, -command-api=legacy)
+# Loaded by: aibench_run_inference_redisai_vision -script-filename tests/models/torch/mobilenet/pre_post_processing.py
+
+
+def pre_process(image):
+    # raw N x H x W x C uint8 pixels, to the model N x H x W x C float32 input in [0,1]
+    return image.float().div(255.0)
+
+
+def post_process(predictions):
+    # N x 1001 class probabilities, to the N x 5 top classes
+    values, indices = torch.topk(predictions, 5, dim=1)
+    return indices.float()
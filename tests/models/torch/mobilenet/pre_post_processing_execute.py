@@ -0,0 +1,13 @@
+# TorchScript pre/post-processing of the mobilenet_v1_100_224 vision benchmark (AI.SCRIPTEXECUTE, -command-api=execute)
+# Loaded by: aibench_run_inference_redisai_vision -command-api execute -script-filename tests/models/torch/mobilenet/pre_post_processing_execute.py
+
+
+def pre_process(tensors: List[Tensor], keys: List[str], args: List[str]):
+    # raw N x H x W x C uint8 pixels, to the model N x H x W x C float32 input in [0,1]
+    return tensors[0].float().div(255.0)
+
+
+def post_process(tensors: List[Tensor], keys: List[str], args: List[str]):
+    # N x 1001 class probabilities, to the N x 5 top classes
+    values, indices = torch.topk(tensors[0], 5, dim=1)
+    return indices.float()
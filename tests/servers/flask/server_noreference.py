@@ -2,7 +2,7 @@ import logging
 import numpy as np
 import os
 import tensorflow as tf
-from flask import Flask, request, jsonify
+from flask import Flask, request, jsonify, __version__ as flask_version
 from flask_api import status
 
 # change it to local
@@ -73,5 +73,11 @@ def v2_predict():
     return jsonify(response), rcode
 
 
+# the server version, recorded on the benchmark results
+@app.route('/version', methods=['GET'])
+def version():
+    return jsonify({'flask': flask_version, 'tensorflow': tf.__version__})
+
+
 if __name__ == '__main__':
     app.run(host='0.0.0.0', port=8000, debug=False)